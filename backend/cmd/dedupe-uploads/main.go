@@ -0,0 +1,64 @@
+// 把以随机文件名保存的旧上传文件改为按内容（SHA-256）命名，内容相同的合并为一份，并改写文档中的链接：
+//
+//	go run ./cmd/dedupe-uploads -dry-run
+//	go run ./cmd/dedupe-uploads
+//
+// 需先执行 databaseinit/migration_add_upload_blobs.sql。数据库、Redis 与存储参数取自 .env / 环境变量；
+// 可在服务运行时执行，中断后可直接重跑；引用旧文件的文档正在编辑时跳过该文件，稍后重跑即可。
+// 默认保留旧文件（外部仍可能引用旧地址），-delete-old 时删除不再被任何文档或修订引用的旧文件
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/config"
+	"markdown-editor-backend/internal/database"
+	"markdown-editor-backend/internal/handlers"
+	"markdown-editor-backend/internal/storage"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "只统计将要重命名的文件，不实际修改")
+	deleteOld := flag.Bool("delete-old", false, "重命名后删除旧文件")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("未找到 .env 文件，使用系统环境变量")
+	}
+	cfg := config.Load()
+	db, err := database.InitMySQL(cfg.Database, false)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+	rcache := cache.New(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+	defer rcache.Close()
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+
+	report, err := handlers.DedupeUploads(context.Background(), db, store, rcache, *dryRun, *deleteOld)
+	if err != nil {
+		log.Fatal("去重失败: ", err)
+	}
+	for _, key := range report.Missing {
+		log.Printf("文件不存在: %s", key)
+	}
+	verb := "已重命名"
+	if *dryRun {
+		verb = "将重命名"
+	}
+	log.Printf("%s %d 个文件（其中 %d 个与已有文件内容相同，已合并），改写 %d 篇文档，删除旧文件 %d 个（仍被修订或回收站引用而保留 %d 个），"+
+		"文档正在编辑跳过 %d 个，缺失 %d 个，失败 %d 个",
+		verb, report.Renamed, report.Merged, report.Documents, report.Deleted, report.Kept, report.Locked, len(report.Missing), report.Failed)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
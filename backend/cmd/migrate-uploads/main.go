@@ -0,0 +1,90 @@
+// 在存储后端之间复制上传文件，如从本机 uploads/ 迁移到 S3/MinIO：
+//
+//	go run ./cmd/migrate-uploads -from local -to s3
+//
+// 两端的连接参数都取自 .env / 环境变量中的 STORAGE_LOCAL_DIR、S3_* 配置。目标端已存在且大小相同的对象会跳过，
+// 中断后可直接重跑。不删除源文件：确认新后端工作正常后再切换 STORAGE_DRIVER 并手动清理
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"markdown-editor-backend/internal/config"
+	"markdown-editor-backend/internal/storage"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	from := flag.String("from", "local", "源存储驱动：local 或 s3")
+	to := flag.String("to", "s3", "目标存储驱动：local 或 s3")
+	prefix := flag.String("prefix", "", "只复制以此开头的对象键，如 images/")
+	dryRun := flag.Bool("dry-run", false, "只列出将要复制的对象，不实际写入")
+	overwrite := flag.Bool("overwrite", false, "目标端已存在同名对象时也重新复制")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("未找到 .env 文件，使用系统环境变量")
+	}
+	cfg := config.Load()
+	if *from == *to {
+		log.Fatal("源与目标不能相同")
+	}
+	src := open(cfg.Storage, *from)
+	dst := open(cfg.Storage, *to)
+
+	ctx := context.Background()
+	var copied, skipped, failed int
+	var total int64
+	err := src.List(ctx, *prefix, func(info storage.Info) error {
+		if !*overwrite {
+			existing, err := dst.Stat(ctx, info.Key)
+			if err == nil && existing.Size == info.Size {
+				skipped++
+				return nil
+			}
+			if err != nil && !errors.Is(err, storage.ErrNotExist) {
+				return err
+			}
+		}
+		if *dryRun {
+			log.Printf("将复制 %s (%d 字节)", info.Key, info.Size)
+			copied++
+			total += info.Size
+			return nil
+		}
+		if err := storage.Copy(ctx, dst, src, info.Key); err != nil {
+			log.Printf("复制失败 %s: %v", info.Key, err)
+			failed++
+			return nil
+		}
+		copied++
+		total += info.Size
+		return nil
+	})
+	if err != nil {
+		log.Fatal("遍历源存储失败: ", err)
+	}
+	verb := "已复制"
+	if *dryRun {
+		verb = "将复制"
+	}
+	log.Printf("%s %d 个对象（%d 字节），跳过 %d 个，失败 %d 个", verb, copied, total, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// open 按 driver 创建存储，其余参数取自配置
+func open(cfg config.StorageConfig, driver string) storage.Storage {
+	cfg.Driver = driver
+	s, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
@@ -7,6 +7,7 @@ import (
 	"markdown-editor-backend/internal/config"
 	"markdown-editor-backend/internal/database"
 	"markdown-editor-backend/internal/server"
+	"markdown-editor-backend/internal/storage"
 
 	"github.com/joho/godotenv"
 )
@@ -31,8 +32,14 @@ func main() {
 	rcache := cache.New(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
 	defer rcache.Close()
 
+	// 初始化上传文件存储
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to init storage:", err)
+	}
+
 	// 启动服务器
-	srv := server.NewServer(cfg, db, rcache)
+	srv := server.NewServer(cfg, db, rcache, store)
 	if err := srv.Run(); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
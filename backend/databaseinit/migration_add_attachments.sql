@@ -0,0 +1,103 @@
+-- ============================================================
+-- 数据库迁移：附件
+-- 上传的文件（图片、PDF、压缩包、音频等）记录在 attachments，属于上传者，
+-- 可经 document_attachments 关联到多篇文档；不再为每张图片创建一条文档。
+-- 已有的图片文档（image_path 非空）迁移为附件：文件原地保留，内容中引用该图片的文档自动关联。
+-- 内容仍是上传时生成的 `![](/uploads/...)` 的图片文档随后删除（连同修订、标签、元数据等记录，并为同步客户端写入删除墓碑）；
+-- 内容已被用户编辑过的保留为普通文档，只清空 image_path。最后删除 documents.image_path 列。
+-- 依赖 change_log、tags、revisions、shares、document_meta、links 等迁移；document_locks 表可以不存在。
+-- 中途失败时可重新执行：已迁移的附件不会重复写入。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_attachments.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `attachments` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL COMMENT '上传者',
+  `filename` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '上传时的原始文件名',
+  `storage_path` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '相对 uploads 的路径，如 images/xxx.png、files/xxx.pdf',
+  `kind` varchar(20) NOT NULL COMMENT '类型：image / pdf / document / archive / audio / video',
+  `mime_type` varchar(100) NOT NULL DEFAULT 'application/octet-stream',
+  `size` bigint NOT NULL DEFAULT '0' COMMENT '字节数',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_created` (`user_id`, `created_at`, `id`),
+  KEY `idx_storage_path` (`storage_path`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `document_attachments` (
+  `document_id` int NOT NULL,
+  `attachment_id` int NOT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`document_id`, `attachment_id`),
+  KEY `idx_attachment` (`attachment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 图片文档 → 附件（含回收站中的，文件仍可能被其他文档引用）
+INSERT INTO `attachments` (`user_id`, `filename`, `storage_path`, `kind`, `mime_type`, `size`, `created_at`)
+SELECT `user_id`, `title`, REPLACE(`image_path`, '\\', '/'), 'image',
+  CASE LOWER(SUBSTRING_INDEX(`image_path`, '.', -1))
+    WHEN 'jpg' THEN 'image/jpeg'
+    WHEN 'jpeg' THEN 'image/jpeg'
+    WHEN 'png' THEN 'image/png'
+    WHEN 'gif' THEN 'image/gif'
+    WHEN 'webp' THEN 'image/webp'
+    ELSE 'application/octet-stream'
+  END,
+  `file_size`, `created_at`
+FROM `documents` d
+WHERE `image_path` IS NOT NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM `attachments` a
+    WHERE a.`user_id` = d.`user_id` AND a.`storage_path` = REPLACE(d.`image_path`, '\\', '/')
+  );
+
+-- 内容已被编辑过（不再是上传时生成的那一行图片链接）的图片文档保留为普通文档
+UPDATE `documents`
+SET `image_path` = NULL, `updated_at` = `updated_at`
+WHERE `image_path` IS NOT NULL
+  AND `content` <> CONCAT('![](/uploads/', REPLACE(`image_path`, '\\', '/'), ')');
+
+-- 同一用户内容中引用了该图片的文档（含上面保留的）建立关联
+INSERT IGNORE INTO `document_attachments` (`document_id`, `attachment_id`)
+SELECT d.`id`, a.`id`
+FROM `attachments` a
+INNER JOIN `documents` d ON d.`user_id` = a.`user_id` AND d.`image_path` IS NULL
+WHERE d.`content` LIKE CONCAT('%/uploads/', a.`storage_path`, '%');
+
+-- 图片文档的删除墓碑：序号接在各用户已分配的最大序号之后
+INSERT INTO `change_log` (`user_id`, `seq`, `entity`, `entity_id`, `related_id`, `op`)
+SELECT d.`user_id`, COALESCE(s.`seq`, 0) + ROW_NUMBER() OVER (PARTITION BY d.`user_id` ORDER BY d.`id`), 'document', d.`id`, 0, 'delete'
+FROM `documents` d
+LEFT JOIN `sync_sequences` s ON s.`user_id` = d.`user_id`
+WHERE d.`image_path` IS NOT NULL
+ON DUPLICATE KEY UPDATE `seq` = VALUES(`seq`), `op` = 'delete', `changed_at` = CURRENT_TIMESTAMP;
+
+INSERT INTO `sync_sequences` (`user_id`, `seq`)
+SELECT `user_id`, MAX(`seq`) FROM `change_log` GROUP BY `user_id`
+ON DUPLICATE KEY UPDATE `seq` = VALUES(`seq`);
+
+-- 删除图片文档及其附属记录（不删除文件）
+DELETE r FROM `document_revisions` r INNER JOIN `documents` d ON d.`id` = r.`document_id` WHERE d.`image_path` IS NOT NULL;
+DELETE t FROM `document_tags` t INNER JOIN `documents` d ON d.`id` = t.`document_id` WHERE d.`image_path` IS NOT NULL;
+DELETE l FROM `document_likes` l INNER JOIN `documents` d ON d.`id` = l.`document_id` WHERE d.`image_path` IS NOT NULL;
+DELETE s FROM `document_shares` s INNER JOIN `documents` d ON d.`id` = s.`document_id` WHERE d.`image_path` IS NOT NULL;
+DELETE s FROM `document_share_links` s INNER JOIN `documents` d ON d.`id` = s.`document_id` WHERE d.`image_path` IS NOT NULL;
+DELETE m FROM `document_meta` m INNER JOIN `documents` d ON d.`id` = m.`document_id` WHERE d.`image_path` IS NOT NULL;
+-- document_locks 仅在未启用 Redis 时需要，表可能不存在
+SET @sql := IF(
+  (SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'document_locks') > 0,
+  'DELETE k FROM `document_locks` k INNER JOIN `documents` d ON d.`id` = k.`document_id` WHERE d.`image_path` IS NOT NULL',
+  'DO 0'
+);
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+DELETE k FROM `document_links` k INNER JOIN `documents` d ON d.`id` = k.`source_id` WHERE d.`image_path` IS NOT NULL;
+UPDATE `document_links` k INNER JOIN `documents` d ON d.`id` = k.`target_id` SET k.`target_id` = NULL WHERE d.`image_path` IS NOT NULL;
+DELETE FROM `documents` WHERE `image_path` IS NOT NULL;
+
+-- 图片已全部改为附件，image_path 不再使用
+ALTER TABLE `documents` DROP COLUMN `image_path`;
@@ -0,0 +1,48 @@
+-- ============================================================
+-- 数据库迁移：离线同步变更日志
+-- change_log 按用户记录文档、标签、文档-标签关联与任务的变更（upsert / delete 墓碑），
+-- seq 为每个用户单调递增的序号，由 sync_sequences 在事务内分配；同一实体只保留最新一条。
+-- 迁移时为已有数据各写入一条 upsert，客户端从 since=0 开始即可拉取全量。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_change_log.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `sync_sequences` (
+  `user_id` int NOT NULL,
+  `seq` bigint NOT NULL DEFAULT '0' COMMENT '该用户已分配的最大序号',
+  PRIMARY KEY (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `change_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `seq` bigint NOT NULL COMMENT '用户内单调递增的序号',
+  `entity` enum('document','tag','document_tag','task') NOT NULL,
+  `entity_id` int NOT NULL COMMENT '实体ID；document_tag 为文档ID',
+  `related_id` int NOT NULL DEFAULT '0' COMMENT 'document_tag 的标签ID，其余为 0',
+  `op` enum('upsert','delete') NOT NULL,
+  `changed_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uniq_user_seq` (`user_id`, `seq`),
+  UNIQUE KEY `uniq_user_entity` (`user_id`, `entity`, `entity_id`, `related_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 已有数据写入初始 upsert（回收站中的文档不计）
+INSERT INTO `change_log` (`user_id`, `seq`, `entity`, `entity_id`, `related_id`, `op`)
+SELECT `user_id`, ROW_NUMBER() OVER (PARTITION BY `user_id` ORDER BY `ord`, `entity_id`, `related_id`), `entity`, `entity_id`, `related_id`, 'upsert'
+FROM (
+  SELECT `user_id`, 1 AS `ord`, 'tag' AS `entity`, `id` AS `entity_id`, 0 AS `related_id` FROM `tags`
+  UNION ALL
+  SELECT `user_id`, 2, 'document', `id`, 0 FROM `documents` WHERE `deleted_at` IS NULL
+  UNION ALL
+  SELECT d.`user_id`, 3, 'document_tag', dt.`document_id`, dt.`tag_id`
+  FROM `document_tags` dt INNER JOIN `documents` d ON d.`id` = dt.`document_id`
+  WHERE d.`deleted_at` IS NULL
+  UNION ALL
+  SELECT `user_id`, 4, 'task', `id`, 0 FROM `tasks`
+) s;
+
+INSERT INTO `sync_sequences` (`user_id`, `seq`)
+SELECT `user_id`, MAX(`seq`) FROM `change_log` GROUP BY `user_id`;
@@ -0,0 +1,19 @@
+-- ============================================================
+-- 数据库迁移：文档评论
+-- document_comments：作者与 commenter、editor 角色的被授权用户可发表评论，viewer 只能查看；
+--   评论不改动文档内容，删除评论限评论者本人与文档作者
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_document_comments.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `document_comments` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `document_id` int NOT NULL COMMENT '文档ID',
+  `user_id` int NOT NULL COMMENT '评论者',
+  `content` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_document_id` (`document_id`, `id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
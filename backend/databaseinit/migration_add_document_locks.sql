@@ -0,0 +1,17 @@
+-- ============================================================
+-- 数据库迁移：文档编辑锁（MySQL 回退存储）
+-- 编辑锁默认存于 Redis（lock:doc:{id}）；未配置或连不上 Redis 时改用本表，
+-- 每篇文档至多一条租约，expires_at 之后视为已释放，下次获取时覆盖。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_document_locks.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `document_locks` (
+  `document_id` int NOT NULL,
+  `user_id` int NOT NULL COMMENT '持有者',
+  `expires_at` datetime(3) NOT NULL COMMENT '租约到期时间',
+  `acquired_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`document_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
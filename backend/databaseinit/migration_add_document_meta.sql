@@ -0,0 +1,19 @@
+-- ============================================================
+-- 数据库迁移：front matter 自定义元数据
+-- 保存文档时解析 YAML front matter：title 同步到 documents.title / filename，tags 同步到 tags / document_tags，
+-- 其余键写入 document_meta 供按键值筛选；列表值每项一行，嵌套对象以 JSON 保存
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_document_meta.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `document_meta` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `document_id` int NOT NULL COMMENT '文档ID',
+  `meta_key` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `meta_value` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_document_id` (`document_id`),
+  KEY `idx_key_value` (`meta_key`, `meta_value`(191))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,15 @@
+-- ============================================================
+-- 数据库迁移：文档版本号（乐观并发控制）
+-- GetDocument 以 version 作为 ETag 返回，PUT 携带 If-Match 时版本不符返回 409
+-- 依赖 migration_add_revisions.sql
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_document_version.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE documents
+  ADD COLUMN `version` int NOT NULL DEFAULT '1' COMMENT '版本号，每次保存 +1' AFTER `file_size`;
+
+ALTER TABLE document_revisions
+  ADD COLUMN `version` int NOT NULL DEFAULT '1' COMMENT '该次保存后的文档版本号' AFTER `source`;
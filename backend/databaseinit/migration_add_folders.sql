@@ -0,0 +1,24 @@
+-- ============================================================
+-- 数据库迁移：文件夹（按用户的多级目录）
+-- 文档通过 documents.folder_id 归属某个文件夹，NULL 表示位于根目录
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_folders.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+DROP TABLE IF EXISTS `folders`;
+CREATE TABLE `folders` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL COMMENT '所属用户ID',
+  `parent_id` int DEFAULT NULL COMMENT '上级文件夹ID，NULL 为根目录',
+  `name` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '文件夹名称',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_parent` (`user_id`, `parent_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE `documents`
+  ADD COLUMN `folder_id` int DEFAULT NULL COMMENT '所属文件夹ID，NULL 为根目录' AFTER `user_id`,
+  ADD KEY `idx_user_folder` (`user_id`, `folder_id`);
@@ -0,0 +1,15 @@
+-- ============================================================
+-- 数据库迁移：复制文档与复刻社区贴文
+-- 从社区贴文复刻（fork）的文档记录来源：原文档 ID、原作者与复刻时的标题快照，
+-- 原文档之后被删除或取消发布时仍可展示署名。直接复制（duplicate）的文档三列均为 NULL。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_forks.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD COLUMN `forked_from_id` int NULL DEFAULT NULL COMMENT '复刻来源文档ID',
+  ADD COLUMN `forked_from_user_id` int NULL DEFAULT NULL COMMENT '来源文档作者',
+  ADD COLUMN `forked_from_title` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NULL DEFAULT NULL COMMENT '复刻时来源文档的标题',
+  ADD KEY `idx_forked_from` (`forked_from_id`);
@@ -0,0 +1,13 @@
+-- ============================================================
+-- 数据库迁移：文档全文检索
+-- 使用 MySQL 内置 ngram 解析器（默认 ngram_token_size=2，即按二元组切分），
+-- 中文无需分词词典即可检索；InnoDB 会在每次 INSERT/UPDATE/DELETE 提交时同步维护该索引。
+-- 要求 MySQL 5.7.6+。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_fulltext.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE documents
+  ADD FULLTEXT INDEX `ft_title_content` (`title`, `content`) WITH PARSER ngram;
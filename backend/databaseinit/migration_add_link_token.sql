@@ -0,0 +1,18 @@
+-- ============================================================
+-- 数据库迁移：unlisted 文档的链接令牌
+-- unlisted 文档只能凭不可猜测的令牌访问（GET /api/posts/:token 等），不再接受顺序的数字 ID
+-- 现有 unlisted 文档各生成一个令牌，作者可在 GET /api/documents/:id 的 link_token 中取得新链接
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_link_token.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD COLUMN `link_token` varchar(32) CHARACTER SET ascii COLLATE ascii_bin DEFAULT NULL COMMENT 'unlisted 文档的链接令牌' AFTER `visibility`,
+  ADD UNIQUE KEY `uk_link_token` (`link_token`);
+
+-- 16 字节随机数的 base64url 编码（22 个字符），与应用生成的格式一致
+UPDATE `documents`
+SET `link_token` = REPLACE(REPLACE(REPLACE(TO_BASE64(RANDOM_BYTES(16)), '+', '-'), '/', '_'), '=', '')
+WHERE `visibility` = 'unlisted' AND `link_token` IS NULL;
@@ -0,0 +1,23 @@
+-- ============================================================
+-- 数据库迁移：文档链接（wiki-link 与相对 .md 链接）
+-- 每次保存文档时重新解析其中的链接；target_key 为规范化后的目标名（去目录、去 .md、小写），
+-- 在同一作者的文档中按标题匹配，target_id 为 NULL 表示未解析（目标文档不存在）
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_links.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `document_links` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `source_id` int NOT NULL COMMENT '链接所在文档ID',
+  `target_id` int DEFAULT NULL COMMENT '目标文档ID，NULL 表示未解析',
+  `target` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '链接中写的目标',
+  `target_key` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '规范化目标名',
+  `kind` enum('wiki','markdown') NOT NULL DEFAULT 'wiki',
+  `context` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '链接所在行摘录',
+  PRIMARY KEY (`id`),
+  KEY `idx_source_id` (`source_id`),
+  KEY `idx_target_id` (`target_id`),
+  KEY `idx_target_key` (`target_key`(191))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
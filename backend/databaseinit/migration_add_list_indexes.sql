@@ -0,0 +1,22 @@
+-- ============================================================
+-- 数据库迁移：列表游标分页与排序索引
+-- 文档、标签、任务列表改为按 (排序列, id) 的 keyset 分页，为各排序字段补 (user_id, 排序列) 复合索引；
+-- InnoDB 二级索引末尾隐含主键，可直接满足 ORDER BY 排序列, id，无需 filesort。
+-- 已有的索引不再重复创建：documents 的 (user_id, created_at) 与 (user_id, updated_at)，tags 的唯一键 (user_id, name)。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_list_indexes.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD KEY `idx_user_title` (`user_id`, `title`),
+  ADD KEY `idx_user_size` (`user_id`, `file_size`);
+
+ALTER TABLE `tags`
+  ADD KEY `idx_user_created` (`user_id`, `created_at`),
+  ADD KEY `idx_user_updated` (`user_id`, `updated_at`);
+
+ALTER TABLE `tasks`
+  ADD KEY `idx_user_created` (`user_id`, `created_at`),
+  ADD KEY `idx_user_updated` (`user_id`, `updated_at`);
@@ -0,0 +1,29 @@
+-- ============================================================
+-- 数据库迁移：文档修订历史
+-- 每次保存文档都会写入一条修订，旧修订按 REVISION_MAX_PER_DOCUMENT /
+-- REVISION_RETENTION_DAYS 清理
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_revisions.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+DROP TABLE IF EXISTS `document_revisions`;
+CREATE TABLE `document_revisions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `document_id` int NOT NULL COMMENT '文档ID',
+  `user_id` int NOT NULL COMMENT '保存者用户ID',
+  `title` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `content` longtext CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL,
+  `file_size` bigint NOT NULL DEFAULT '0',
+  `source` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'update' COMMENT '来源：create/update/restore',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_document_id` (`document_id`, `id`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 为现有文档补一条初始修订，使其立即可被还原/对比
+INSERT INTO `document_revisions` (`document_id`, `user_id`, `title`, `content`, `file_size`, `source`, `created_at`)
+SELECT `id`, `user_id`, `title`, `content`, `file_size`, 'create', `updated_at`
+FROM `documents`;
@@ -0,0 +1,35 @@
+-- ============================================================
+-- 数据库迁移：文档共享
+-- document_shares：按用户授权，角色 viewer（只读）/ commenter（可评论）/ editor（可编辑）
+-- document_share_links：分享链接，可设置过期时间与访问密码，供未登录用户只读访问；
+--   链接令牌由 id 与服务端密钥签名生成，不入库；吊销后令牌立即失效
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_shares.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `document_shares` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `document_id` int NOT NULL COMMENT '文档ID',
+  `user_id` int NOT NULL COMMENT '被授权用户',
+  `role` enum('viewer','commenter','editor') NOT NULL DEFAULT 'viewer',
+  `created_by` int NOT NULL COMMENT '授权人（文档作者）',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uniq_document_user` (`document_id`, `user_id`),
+  KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `document_share_links` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `document_id` int NOT NULL COMMENT '文档ID',
+  `created_by` int NOT NULL,
+  `password_hash` varchar(255) DEFAULT NULL COMMENT 'bcrypt，NULL 表示无需密码',
+  `expires_at` timestamp NULL DEFAULT NULL COMMENT 'NULL 表示永不过期',
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_document_id` (`document_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
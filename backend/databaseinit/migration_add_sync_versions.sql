@@ -0,0 +1,25 @@
+-- ============================================================
+-- 数据库迁移：标签、任务版本号与同步新建的幂等键
+-- tags / tasks 增加 version，每次修改 +1，同步推送以 base_version 检测冲突（取代按 updated_at 比较）；
+-- sync_client_ids 记录同步推送新建记录时客户端给出的 client_id，重复推送同一 client_id 不会重复新建。
+-- 依赖 migration_add_change_log.sql
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_sync_versions.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE tags
+  ADD COLUMN `version` int NOT NULL DEFAULT '1' COMMENT '版本号，每次修改 +1' AFTER `color`;
+
+ALTER TABLE tasks
+  ADD COLUMN `version` int NOT NULL DEFAULT '1' COMMENT '版本号，每次修改 +1' AFTER `completed_at`;
+
+CREATE TABLE IF NOT EXISTS `sync_client_ids` (
+  `user_id` int NOT NULL,
+  `entity` enum('document','tag','task') NOT NULL,
+  `client_id` varchar(64) NOT NULL COMMENT '客户端为新建记录生成的唯一标识',
+  `entity_id` int NOT NULL COMMENT '首次推送时新建的记录ID',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`, `entity`, `client_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
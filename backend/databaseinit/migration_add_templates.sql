@@ -0,0 +1,13 @@
+-- ============================================================
+-- 数据库迁移：文档模板
+-- 用户可把自己的文档标记为模板，从模板新建文档时替换 {{date}}、{{username}}、{{title}} 等占位符并复制标签；
+-- 系统模板内置于服务端代码，不入库
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_templates.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD COLUMN `is_template` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否为模板' AFTER `visibility`,
+  ADD KEY `idx_user_template` (`user_id`, `is_template`);
@@ -0,0 +1,14 @@
+-- ============================================================
+-- 数据库迁移：回收站（软删除）
+-- 删除文档时只写入 deleted_at，回收站中的文档对列表、搜索与社区贴文不可见；
+-- 超过 TRASH_RETENTION_DAYS 天后由后台任务永久清除（连同图片文件）
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_trash.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD COLUMN `deleted_at` timestamp NULL DEFAULT NULL COMMENT '移入回收站的时间，NULL 表示未删除',
+  ADD KEY `idx_user_deleted` (`user_id`, `deleted_at`),
+  ADD KEY `idx_deleted_at` (`deleted_at`);
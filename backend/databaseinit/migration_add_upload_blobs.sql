@@ -0,0 +1,27 @@
+-- ============================================================
+-- 数据库迁移：上传文件按内容寻址去重
+-- 新上传的文件以内容的 SHA-256 命名（images/<hash>.png），相同内容只存一份；
+-- upload_blobs 记录每个存储对象被多少条附件引用，引用数降为 0 时才删除文件。
+-- 已有附件按 storage_path 汇总写入引用数，原随机文件名的文件照常可用；
+-- 如需把它们也改为按内容命名并合并重复文件，执行 go run ./cmd/dedupe-uploads（见 README）。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_upload_blobs.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `upload_blobs` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `storage_path` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '对象键，与 attachments.storage_path 对应',
+  `size` bigint NOT NULL DEFAULT '0' COMMENT '字节数',
+  `ref_count` int NOT NULL DEFAULT '0' COMMENT '引用该对象的附件数',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_storage_path` (`storage_path`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO `upload_blobs` (`storage_path`, `size`, `ref_count`)
+SELECT `storage_path`, MAX(`size`), COUNT(*)
+FROM `attachments`
+GROUP BY `storage_path`
+ON DUPLICATE KEY UPDATE `ref_count` = VALUES(`ref_count`);
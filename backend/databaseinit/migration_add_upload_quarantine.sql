@@ -0,0 +1,19 @@
+-- ============================================================
+-- 数据库迁移：孤儿上传文件隔离区
+-- 孤儿文件清理把没有被任何文档、修订或附件引用的文件移到存储的 quarantine/ 下并记录在此表，
+-- 隔离期（UPLOAD_GC_GRACE_DAYS）内重新被引用的文件移回原处，期满仍无引用的永久删除。
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_upload_quarantine.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `upload_quarantine` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `storage_path` varchar(500) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '原对象键；隔离中的文件位于 quarantine/<对象键>',
+  `size` bigint NOT NULL DEFAULT '0' COMMENT '字节数',
+  `quarantined_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_storage_path` (`storage_path`),
+  KEY `idx_quarantined_at` (`quarantined_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,14 @@
+-- ============================================================
+-- 数据库迁移：文档可见性
+-- private：仅作者可见（默认）；unlisted：知道链接即可查看，不进入社区列表；public：出现在社区列表
+-- 现有文档一律设为 private，需要公开的由作者重新发布
+-- 执行方式：mysql -u root -p markdown_editor < databaseinit/migration_add_visibility.sql
+-- ============================================================
+
+USE markdown_editor;
+SET NAMES utf8mb4;
+
+ALTER TABLE `documents`
+  ADD COLUMN `visibility` enum('private','unlisted','public') NOT NULL DEFAULT 'private' COMMENT '可见性' AFTER `file_size`,
+  ADD COLUMN `published_at` timestamp NULL DEFAULT NULL COMMENT '最近一次发布时间' AFTER `visibility`,
+  ADD KEY `idx_visibility_updated` (`visibility`, `updated_at`);
@@ -115,8 +115,8 @@ func (c *Cache) delByPrefix(ctx context.Context, prefix string) {
 }
 
 // ── 贴文缓存 ──────────────────────────────────────────────────────────────────
-// 列表分页 key：posts:list:p{page}:l{limit}
-// 详情     key：post:{docID}
+// 列表分页 key：posts:list:public:p{page}:l{limit}[:html]（列表只含 public 文档）
+// 详情     key：post:{docID}[:html]（:html 为附带 rendered_html 的变体）
 // 失效策略：延迟双删（见 InvalidatePosts）。
 
 const (
@@ -128,24 +128,56 @@ const (
 	invalidationDelay = 500 * time.Millisecond
 )
 
-// PostsListKey 拼贴文列表分页缓存 key。
-func PostsListKey(page, limit int) string {
-	return fmt.Sprintf("%sp%d:l%d", postsListPrefix, page, limit)
+// PostsListKey 拼贴文列表分页缓存 key；rendered 为 true 时是附带渲染 HTML 的变体。
+func PostsListKey(page, limit int, rendered bool) string {
+	key := fmt.Sprintf("%spublic:p%d:l%d", postsListPrefix, page, limit)
+	if rendered {
+		key += ":html"
+	}
+	return key
 }
 
-// PostDetailKey 拼贴文详情缓存 key。
-func PostDetailKey(docID int64) string {
-	return postDetailPrefix + strconv.FormatInt(docID, 10)
+// PostDetailKey 拼贴文详情缓存 key；rendered 为 true 时是附带渲染 HTML 的变体。
+func PostDetailKey(docID int64, rendered bool) string {
+	key := postDetailPrefix + strconv.FormatInt(docID, 10)
+	if rendered {
+		key += ":html"
+	}
+	return key
 }
 
-// delPosts 删除列表全部分页缓存；docID>0 时一并删除该贴文详情缓存。
+// delPosts 删除列表全部分页缓存；docID>0 时一并删除该贴文详情缓存（两种变体）。
+// 文档内容、可见性变化或删除时都需调用（经 InvalidatePosts）。
 func (c *Cache) delPosts(ctx context.Context, docID int64) {
 	c.delByPrefix(ctx, postsListPrefix)
 	if docID > 0 {
-		c.Del(ctx, PostDetailKey(docID))
+		c.Del(ctx, PostDetailKey(docID, false), PostDetailKey(docID, true))
 	}
 }
 
+// ── Markdown 渲染缓存 ─────────────────────────────────────────────────────────
+// key 格式：render:v2:{sha256(content)}
+// 以内容哈希为 key，相同内容（不同文档、不同版本）共用一份结果，内容变化后自然换 key，无需主动失效。
+// 渲染规则变化时调高版本号即可让旧结果整体作废。
+
+const renderKeyPrefix = "render:v2:"
+
+// RenderKey 拼渲染结果缓存 key，contentHash 为 Markdown 原文的 sha256 十六进制串。
+func RenderKey(contentHash string) string {
+	return renderKeyPrefix + contentHash
+}
+
+// ── 文档大纲缓存 ──────────────────────────────────────────────────────────────
+// key 格式：outline:v1:{docID}:{version}
+// 文档每次保存版本号都会递增，旧版本的 key 不再被读取，随 TTL 过期，无需主动失效。
+
+const outlineKeyPrefix = "outline:v1:"
+
+// OutlineKey 拼文档大纲缓存 key。
+func OutlineKey(docID int64, version int) string {
+	return fmt.Sprintf("%s%d:%d", outlineKeyPrefix, docID, version)
+}
+
 // InvalidatePosts 以「延迟双删」失效贴文缓存，调用方应在更新 DB 后调用：
 //  1. 立即删除一次（同步）。
 //  2. 延迟 invalidationDelay 后再删一次，清掉并发读可能回填的旧值。
@@ -254,3 +286,404 @@ func (c *Cache) RefreshTokenExists(ctx context.Context, jti string) bool {
 	return c.whitelistExists(ctx, refreshKey(jti))
 }
 
+// Enabled 返回 Redis 是否可用；nil 接收者返回 false。
+// 仅供需要区分「单实例内存模式」与「多实例 Redis 模式」的功能使用，普通读缓存无需调用。
+func (c *Cache) Enabled() bool {
+	return c != nil
+}
+
+// Publish 向频道发布消息；失败仅记日志。
+func (c *Cache) Publish(ctx context.Context, channel string, payload []byte) {
+	if c == nil {
+		return
+	}
+	if err := c.rdb.Publish(ctx, channel, payload).Err(); err != nil {
+		log.Printf("缓存 PUBLISH 失败 channel=%s: %v", channel, err)
+	}
+}
+
+// Subscribe 订阅频道，返回消息通道与取消函数。
+// 返回前已确认订阅生效，调用方随后读取的状态不会漏掉之后发布的消息。
+// 取消函数关闭订阅，消息通道随之关闭。
+func (c *Cache) Subscribe(ctx context.Context, channel string) (<-chan string, func(), error) {
+	if c == nil {
+		return nil, nil, fmt.Errorf("redis 不可用")
+	}
+	ps := c.rdb.Subscribe(ctx, channel)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, nil, err
+	}
+	out := make(chan string, 256)
+	go func() {
+		defer close(out)
+		for msg := range ps.Channel() {
+			out <- msg.Payload
+		}
+	}()
+	return out, func() { _ = ps.Close() }, nil
+}
+
+// ── 失败尝试计数 ──────────────────────────────────────────────────────────────
+// key 格式：attempts:{scope}，value 为窗口内的失败次数，首次失败时设置 TTL = 窗口长度。
+// 用于限制分享链接访问密码等需要 bcrypt 校验的接口被暴力尝试。
+// Redis 不可用时返回 ok=false，由调用方改用进程内计数。
+
+const attemptsKeyPrefix = "attempts:"
+
+var incrAttemptsScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// IncrAttempts 失败次数 +1，返回窗口内的累计次数。
+func (c *Cache) IncrAttempts(ctx context.Context, scope string, window time.Duration) (n int64, ok bool) {
+	if c == nil {
+		return 0, false
+	}
+	n, err := incrAttemptsScript.Run(ctx, c.rdb, []string{attemptsKeyPrefix + scope}, window.Milliseconds()).Int64()
+	if err != nil {
+		log.Printf("失败计数写入失败 scope=%s: %v", scope, err)
+		return 0, false
+	}
+	return n, true
+}
+
+// Attempts 返回窗口内的失败次数及剩余窗口时长。
+func (c *Cache) Attempts(ctx context.Context, scope string) (n int64, ttl time.Duration, ok bool) {
+	if c == nil {
+		return 0, 0, false
+	}
+	key := attemptsKeyPrefix + scope
+	pipe := c.rdb.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, 0, false
+	}
+	n, err := get.Int64()
+	if err == redis.Nil {
+		return 0, 0, true
+	}
+	if err != nil {
+		return 0, 0, false
+	}
+	return n, pttl.Val(), true
+}
+
+// ResetAttempts 清除失败计数（如密码校验成功后）。
+func (c *Cache) ResetAttempts(ctx context.Context, scope string) {
+	c.Del(ctx, attemptsKeyPrefix+scope)
+}
+
+// ── 协同编辑 ──────────────────────────────────────────────────────────────────
+// 多实例通过 Redis 对同一文档的操作定序：
+//   collab:doc:{id}:base      会话起点的文档内容（rev 0）
+//   collab:doc:{id}:version   会话最近一次写回后 MySQL 中的文档版本号
+//   collab:doc:{id}:ops       操作日志，第 i 个元素对应 rev i+1
+//   collab:doc:{id}:presence  在线成员（hash：clientID → JSON）
+//   collab:doc:{id}:saved     已持久化到 MySQL 的 rev
+//   频道 collab:doc:{id}      操作以 "{rev}:{payload}" 发布，其他消息由调用方自定格式
+// 追加操作用 Lua 脚本原子完成「校验版本 → RPUSH → PUBLISH」，因此频道内操作顺序与 rev 顺序一致。
+// 最后一个成员离开时删除会话 key（CollabEnd）；实例异常退出残留的 key 空闲 collabTTL 后过期，
+// 在此之前重新打开时若文档版本已变化也会丢弃旧会话，从 MySQL 重新建立。
+
+const collabTTL = 24 * time.Hour
+
+func collabKey(docID int64, suffix string) string {
+	return "collab:doc:" + strconv.FormatInt(docID, 10) + suffix
+}
+
+// CollabChannel 返回文档协同会话的 pub/sub 频道名。
+func CollabChannel(docID int64) string { return collabKey(docID, "") }
+
+var collabAppendScript = redis.NewScript(`
+local len = redis.call('LLEN', KEYS[1])
+if len ~= tonumber(ARGV[1]) then
+	return -1
+end
+redis.call('RPUSH', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+redis.call('PUBLISH', KEYS[3], (len + 1) .. ':' .. ARGV[2])
+return len + 1
+`)
+
+var collabClaimSaveScript = redis.NewScript(`
+local saved = tonumber(redis.call('GET', KEYS[1]) or '0')
+if saved >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`)
+
+// collabInitScript 建立或加入会话：已有会话无人在线且版本号与 MySQL 不同（会话之外保存过）时丢弃重建
+var collabInitScript = redis.NewScript(`
+local base = redis.call('GET', KEYS[1])
+if base and redis.call('HLEN', KEYS[4]) == 0 and redis.call('GET', KEYS[2]) ~= ARGV[2] then
+	redis.call('DEL', KEYS[1], KEYS[2], KEYS[3], KEYS[5])
+	base = false
+end
+if not base then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[3])
+	redis.call('SET', KEYS[2], ARGV[2], 'EX', ARGV[3])
+	base = ARGV[1]
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+redis.call('EXPIRE', KEYS[3], ARGV[3])
+return {base, redis.call('GET', KEYS[2]) or '0', redis.call('LRANGE', KEYS[3], 0, -1)}
+`)
+
+// collabEndScript 没有在线成员时删除会话
+var collabEndScript = redis.NewScript(`
+if redis.call('HLEN', KEYS[4]) > 0 then
+	return 0
+end
+redis.call('DEL', KEYS[1], KEYS[2], KEYS[3], KEYS[5])
+return 1
+`)
+
+func collabSessionKeys(docID int64) []string {
+	return []string{
+		collabKey(docID, ":base"), collabKey(docID, ":version"), collabKey(docID, ":ops"),
+		collabKey(docID, ":presence"), collabKey(docID, ":saved"),
+	}
+}
+
+// CollabInit 加入（或建立）文档协同会话：会话不存在时以 MySQL 中的 content / version 初始化，
+// 返回会话起点内容、会话对应的文档版本号与全部已追加的操作。
+func (c *Cache) CollabInit(ctx context.Context, docID int64, content string, version int) (string, int, []string, error) {
+	if c == nil {
+		return "", 0, nil, fmt.Errorf("redis 不可用")
+	}
+	res, err := collabInitScript.Run(ctx, c.rdb, collabSessionKeys(docID), content, version, int(collabTTL.Seconds())).Slice()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(res) != 3 {
+		return "", 0, nil, fmt.Errorf("协同会话初始化返回格式错误")
+	}
+	base, _ := res[0].(string)
+	s, _ := res[1].(string)
+	baseVersion, _ := strconv.Atoi(s)
+	raw, _ := res[2].([]interface{})
+	ops := make([]string, 0, len(raw))
+	for _, op := range raw {
+		if s, ok := op.(string); ok {
+			ops = append(ops, s)
+		}
+	}
+	return base, baseVersion, ops, nil
+}
+
+// CollabVersion 返回会话最近一次写回后的文档版本号，不存在或出错时为 0。
+func (c *Cache) CollabVersion(ctx context.Context, docID int64) int {
+	if c == nil {
+		return 0
+	}
+	n, _ := c.rdb.Get(ctx, collabKey(docID, ":version")).Int()
+	return n
+}
+
+// CollabSetVersion 记录写回后的文档版本号，供其他实例下次写回时作为 If-Match。
+func (c *Cache) CollabSetVersion(ctx context.Context, docID int64, version int) {
+	if c == nil {
+		return
+	}
+	if err := c.rdb.Set(ctx, collabKey(docID, ":version"), version, collabTTL).Err(); err != nil {
+		log.Printf("协同会话版本号写入失败 doc=%d: %v", docID, err)
+	}
+}
+
+// CollabEnd 会话已写回且没有在线成员时删除会话 key，下次打开从 MySQL 重新建立。
+func (c *Cache) CollabEnd(ctx context.Context, docID int64) {
+	if c == nil {
+		return
+	}
+	if err := collabEndScript.Run(ctx, c.rdb, collabSessionKeys(docID)).Err(); err != nil {
+		log.Printf("协同会话清理失败 doc=%d: %v", docID, err)
+	}
+}
+
+// CollabReset 丢弃会话（不论是否有人在线），并在频道发布 payload 通知其他实例。
+func (c *Cache) CollabReset(ctx context.Context, docID int64, payload []byte) {
+	if c == nil {
+		return
+	}
+	if err := c.rdb.Del(ctx, collabSessionKeys(docID)...).Err(); err != nil {
+		log.Printf("协同会话清理失败 doc=%d: %v", docID, err)
+	}
+	c.Publish(ctx, CollabChannel(docID), payload)
+}
+
+// CollabAppend 在 expectedRev 之后追加一条操作并发布；
+// 日志长度与 expectedRev 不符时返回 ok=false，调用方应追平后重试。
+func (c *Cache) CollabAppend(ctx context.Context, docID int64, expectedRev int, payload []byte) (rev int, ok bool, err error) {
+	if c == nil {
+		return 0, false, fmt.Errorf("redis 不可用")
+	}
+	keys := []string{collabKey(docID, ":ops"), collabKey(docID, ":base"), CollabChannel(docID)}
+	n, err := collabAppendScript.Run(ctx, c.rdb, keys, expectedRev, payload, int(collabTTL.Seconds())).Int()
+	if err != nil {
+		return 0, false, err
+	}
+	if n < 0 {
+		return 0, false, nil
+	}
+	return n, true, nil
+}
+
+// CollabOps 返回 rev 大于 fromRev 的全部操作（按 rev 升序）。
+func (c *Cache) CollabOps(ctx context.Context, docID int64, fromRev int) ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("redis 不可用")
+	}
+	return c.rdb.LRange(ctx, collabKey(docID, ":ops"), int64(fromRev), -1).Result()
+}
+
+// CollabRev 返回操作日志长度，即会话当前 rev。
+func (c *Cache) CollabRev(ctx context.Context, docID int64) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("redis 不可用")
+	}
+	n, err := c.rdb.LLen(ctx, collabKey(docID, ":ops")).Result()
+	return int(n), err
+}
+
+// CollabClaimSave 多实例间抢占某个 rev 的持久化权；返回 true 表示应由调用方写 MySQL。
+// Redis 不可用时返回 true。
+func (c *Cache) CollabClaimSave(ctx context.Context, docID int64, rev int) bool {
+	if c == nil {
+		return true
+	}
+	n, err := collabClaimSaveScript.Run(ctx, c.rdb, []string{collabKey(docID, ":saved")}, rev, int(collabTTL.Seconds())).Int()
+	if err != nil {
+		log.Printf("协同持久化抢占失败 doc=%d，降级为直接保存: %v", docID, err)
+		return true
+	}
+	return n == 1
+}
+
+// CollabSetPresence 记录在线成员；失败仅记日志。
+func (c *Cache) CollabSetPresence(ctx context.Context, docID int64, clientID string, payload []byte) {
+	if c == nil {
+		return
+	}
+	key := collabKey(docID, ":presence")
+	if err := c.rdb.HSet(ctx, key, clientID, payload).Err(); err != nil {
+		log.Printf("协同在线状态写入失败 doc=%d: %v", docID, err)
+		return
+	}
+	c.rdb.Expire(ctx, key, collabTTL)
+}
+
+// CollabDelPresence 移除在线成员。
+func (c *Cache) CollabDelPresence(ctx context.Context, docID int64, clientID string) {
+	if c == nil {
+		return
+	}
+	if err := c.rdb.HDel(ctx, collabKey(docID, ":presence"), clientID).Err(); err != nil {
+		log.Printf("协同在线状态删除失败 doc=%d: %v", docID, err)
+	}
+}
+
+// CollabPresence 返回全部在线成员的 JSON。
+func (c *Cache) CollabPresence(ctx context.Context, docID int64) []string {
+	if c == nil {
+		return nil
+	}
+	m, err := c.rdb.HGetAll(ctx, collabKey(docID, ":presence")).Result()
+	if err != nil {
+		return nil
+	}
+	list := make([]string, 0, len(m))
+	for _, v := range m {
+		list = append(list, v)
+	}
+	return list
+}
+
+// ── 文档编辑锁 ────────────────────────────────────────────────────────────────
+// key 格式：lock:doc:{id}（hash：owner → 持有者，data → 租约 JSON），TTL 即租约有效期。
+// 获取、续期、释放都用 Lua 脚本原子完成「校验持有者 → 写入 / 删除」，过期后 key 自然消失即视为释放。
+// Redis 不可用时各方法返回错误，调用方应改用 MySQL 存储租约。
+
+func lockKey(docID int64) string {
+	return "lock:doc:" + strconv.FormatInt(docID, 10)
+}
+
+// ARGV: owner, data, ttl(ms), renew；返回 {1, data} 表示已持有，{0, 他人的 data} 表示被占用
+var lockAcquireScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if (owner and owner ~= ARGV[1]) or (ARGV[4] == '1' and not owner) then
+	return {0, redis.call('HGET', KEYS[1], 'data') or ''}
+end
+redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'data', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, ARGV[2]}
+`)
+
+// ARGV: owner（空串表示强制释放）；返回 1 已释放，0 无锁，-1 由他人持有
+var lockReleaseScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if not owner then
+	return 0
+end
+if ARGV[1] ~= '' and owner ~= ARGV[1] then
+	return -1
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// LockAcquire 以 owner 身份获取文档编辑锁并把租约设为 data、有效期 ttl；已由 owner 持有时即续期。
+// renew 为 true 时只续期，锁不存在不会新建。
+// 成功返回 (data, true)；被他人持有时返回 (持有者的 data, false)，只续期且锁已不存在时 data 为空。
+func (c *Cache) LockAcquire(ctx context.Context, docID int64, owner string, data []byte, ttl time.Duration, renew bool) ([]byte, bool, error) {
+	if c == nil {
+		return nil, false, fmt.Errorf("redis 不可用")
+	}
+	flag := "0"
+	if renew {
+		flag = "1"
+	}
+	res, err := lockAcquireScript.Run(ctx, c.rdb, []string{lockKey(docID)}, owner, data, ttl.Milliseconds(), flag).Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) != 2 {
+		return nil, false, fmt.Errorf("锁脚本返回值异常: %v", res)
+	}
+	ok, _ := res[0].(int64)
+	held, _ := res[1].(string)
+	return []byte(held), ok == 1, nil
+}
+
+// LockRelease 释放文档编辑锁；owner 为空时不论持有者强制释放。
+// 返回 1 已释放，0 当前无锁，-1 锁由他人持有（未释放）。
+func (c *Cache) LockRelease(ctx context.Context, docID int64, owner string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("redis 不可用")
+	}
+	return lockReleaseScript.Run(ctx, c.rdb, []string{lockKey(docID)}, owner).Int()
+}
+
+// LockGet 返回当前租约的 data；无锁时返回 (nil, false, nil)。
+func (c *Cache) LockGet(ctx context.Context, docID int64) ([]byte, bool, error) {
+	if c == nil {
+		return nil, false, fmt.Errorf("redis 不可用")
+	}
+	b, err := c.rdb.HGet(ctx, lockKey(docID), "data").Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
@@ -0,0 +1,144 @@
+// Package changelog 维护离线同步用的按用户变更日志。
+//
+// 每次文档、标签、文档-标签关联或任务被创建、修改、删除后记录一条变更，序号 seq 在用户内单调递增：
+// 分配序号与写入日志在同一事务内完成，并锁住该用户的 sync_sequences 行，因此同一用户的变更按序号顺序提交，
+// 客户端按 seq > since 拉取不会漏掉并发写入的变更。
+//
+// 日志只记录「哪个实体变了」，不保存内容；读取时返回实体的当前状态。同一实体只保留最新一条
+// （新序号覆盖旧序号），删除留下墓碑，日志大小与实体数量成正比。
+package changelog
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// 实体类型
+const (
+	EntityDocument    = "document"
+	EntityTag         = "tag"
+	EntityDocumentTag = "document_tag"
+	EntityTask        = "task"
+)
+
+// 变更类型
+const (
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+)
+
+// Change 是一条待记录的变更
+type Change struct {
+	Entity    string
+	ID        int64 // 实体 ID；document_tag 为文档 ID
+	RelatedID int64 // document_tag 的标签 ID，其余为 0
+	Op        string
+}
+
+// Upsert 表示实体被创建或修改
+func Upsert(entity string, id int64) Change {
+	return Change{Entity: entity, ID: id, Op: OpUpsert}
+}
+
+// Delete 表示实体被删除
+func Delete(entity string, id int64) Change {
+	return Change{Entity: entity, ID: id, Op: OpDelete}
+}
+
+// DocumentTag 表示文档与标签的关联被建立（OpUpsert）或解除（OpDelete）
+func DocumentTag(op string, docID, tagID int64) Change {
+	return Change{Entity: EntityDocumentTag, ID: docID, RelatedID: tagID, Op: op}
+}
+
+// Entry 是日志中的一条记录
+type Entry struct {
+	Seq       int64
+	Entity    string
+	ID        int64
+	RelatedID int64
+	Op        string
+	ChangedAt time.Time
+}
+
+// Record 为 userID 追加变更，返回分配到的最大序号；changes 为空时不做任何事
+func Record(db *sql.DB, userID int64, changes ...Change) (int64, error) {
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	last, err := RecordTx(tx, userID, changes...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return last, tx.Commit()
+}
+
+// RecordTx 同 Record，在调用方的事务内写入，变更与实体的修改一同提交或回滚
+func RecordTx(tx *sql.Tx, userID int64, changes ...Change) (int64, error) {
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	// 行锁持续到提交，同一用户的记录串行执行
+	result, err := tx.Exec(
+		"INSERT INTO sync_sequences (user_id, seq) VALUES (?, LAST_INSERT_ID(?)) ON DUPLICATE KEY UPDATE seq = LAST_INSERT_ID(seq + ?)",
+		userID, len(changes), len(changes),
+	)
+	if err != nil {
+		return 0, err
+	}
+	last, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	first := last - int64(len(changes)) + 1
+	args := make([]interface{}, 0, len(changes)*6)
+	for i, ch := range changes {
+		args = append(args, userID, first+int64(i), ch.Entity, ch.ID, ch.RelatedID, ch.Op)
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?),", len(changes)), ",")
+	if _, err := tx.Exec(
+		"INSERT INTO change_log (user_id, seq, entity, entity_id, related_id, op) VALUES "+values+
+			" ON DUPLICATE KEY UPDATE seq = VALUES(seq), op = VALUES(op), changed_at = CURRENT_TIMESTAMP",
+		args...,
+	); err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+// Since 按序号升序返回 userID 在 since 之后的变更，最多 limit 条
+func Since(db *sql.DB, userID, since int64, limit int) ([]Entry, error) {
+	rows, err := db.Query(
+		"SELECT seq, entity, entity_id, related_id, op, changed_at FROM change_log WHERE user_id = ? AND seq > ? ORDER BY seq LIMIT ?",
+		userID, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Seq, &e.Entity, &e.ID, &e.RelatedID, &e.Op, &e.ChangedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Current 返回 userID 当前的最大序号，没有任何变更时为 0
+func Current(db *sql.DB, userID int64) (int64, error) {
+	var seq int64
+	err := db.QueryRow("SELECT seq FROM sync_sequences WHERE user_id = ?", userID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
@@ -0,0 +1,674 @@
+package collab
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"markdown-editor-backend/internal/cache"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// persistInterval 是会话内容定期写回 MySQL 的间隔
+	persistInterval = 10 * time.Second
+	// maxHistory 是内存中保留的历史操作条数；客户端基于更早版本提交时需重新同步
+	maxHistory = 2000
+	// maxAppendRetries 是 Redis 模式下追加操作遇到版本竞争时的重试次数
+	maxAppendRetries = 5
+	// sendBuffer 是每个连接的待发送消息缓冲，写满说明客户端过慢，直接断开
+	sendBuffer = 64
+)
+
+var errResync = errors.New("collab session reset, please reconnect")
+
+// ErrStale 表示文档在会话之外被修改（或被他人锁定），会话内容不能再写回，须丢弃会话让客户端重新加入
+var ErrStale = errors.New("document changed outside the collab session, please reconnect")
+
+// PersistFunc 把会话的合并结果写回文档：version 为会话所基于的文档版本号（If-Match），
+// userID 为最后一次修改的作者。返回写回后的版本号；内容未变化时直接返回当前版本号，
+// 文档已在会话之外被修改时返回 ErrStale。
+type PersistFunc func(docID int64, version int, userID int64, content string) (int, error)
+
+// Hub 管理本实例上所有文档的协同会话。
+// cache 可用时由 Redis 为操作定序并在实例间广播；不可用时退化为单实例内存模式。
+type Hub struct {
+	cache    *cache.Cache
+	persist  PersistFunc
+	instance string
+
+	mu    sync.Mutex // 只保护 rooms 与 locks 两个映射，持有期间不做 Redis 或 MySQL 读写
+	rooms map[int64]*room
+	locks map[int64]*docLock
+}
+
+// NewHub 创建 Hub；c 为 nil 时为单实例模式。
+func NewHub(c *cache.Cache, persist PersistFunc) *Hub {
+	return &Hub{
+		cache:    c,
+		persist:  persist,
+		instance: randomID(),
+		rooms:    make(map[int64]*room),
+		locks:    make(map[int64]*docLock),
+	}
+}
+
+// docLock 串行化同一文档的会话建立与关闭（含其中的 Redis 读写与写回），不同文档互不阻塞。
+type docLock struct {
+	mu   sync.Mutex
+	refs int // 持有或等待该锁的数量，降为 0 时从 Hub.locks 删除
+}
+
+// lockDoc 获取文档 docID 的会话锁，返回释放函数。
+func (h *Hub) lockDoc(docID int64) func() {
+	h.mu.Lock()
+	l := h.locks[docID]
+	if l == nil {
+		l = &docLock{}
+		h.locks[docID] = l
+	}
+	l.refs++
+	h.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		h.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(h.locks, docID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Member 是协同会话中的一个连接，随 init/join/cursor 消息下发给其他成员。
+type Member struct {
+	ClientID string `json:"client_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Anchor   int    `json:"anchor"`
+	Head     int    `json:"head"`
+}
+
+// message 是客户端与服务端之间的 JSON 消息。
+//
+//	客户端 → 服务端：
+//	  {"type":"op","rev":3,"op":[5,"abc",-2]}     基于 rev 3 提交操作
+//	  {"type":"cursor","anchor":4,"head":9}       光标 / 选区
+//	服务端 → 客户端：
+//	  init（当前内容、rev、在线成员）、ack（自己的操作已定序）、op（他人的操作）、
+//	  join / leave / cursor（在线状态）、error
+type message struct {
+	Type     string     `json:"type"`
+	Rev      int        `json:"rev,omitempty"`
+	Op       *Operation `json:"op,omitempty"`
+	ClientID string     `json:"client_id,omitempty"`
+	UserID   int64      `json:"user_id,omitempty"`
+	Username string     `json:"username,omitempty"`
+	Anchor   int        `json:"anchor,omitempty"`
+	Head     int        `json:"head,omitempty"`
+	Content  *string    `json:"content,omitempty"`
+	Members  []Member   `json:"members,omitempty"`
+	Message  string     `json:"message,omitempty"`
+	Instance string     `json:"instance,omitempty"` // 仅用于实例间广播，识别自身发布的消息
+}
+
+type client struct {
+	Member
+	conn *websocket.Conn
+	send chan []byte
+	once sync.Once
+}
+
+func (cl *client) close() {
+	cl.once.Do(func() {
+		close(cl.send)
+	})
+}
+
+// room 是一篇文档的协同会话状态。
+type room struct {
+	hub   *Hub
+	docID int64
+
+	mu       sync.Mutex
+	content  string
+	rev      int
+	baseRev  int          // history[0] 对应 rev baseRev+1
+	history  []*Operation // 最近的已定序操作
+	savedRev int
+	version  int   // 会话内容所基于的文档版本号，写回时作为 If-Match
+	lastUser int64 // 最近一次操作的作者，写回时记为修订作者
+	clients  map[string]*client
+	closed   bool
+	stale    bool // 会话已作废，不再写回
+
+	unsubscribe func()
+	stop        chan struct{}
+}
+
+// Serve 处理一个已鉴权的 WebSocket 连接，直到连接断开。
+// content / version 为文档在 MySQL 中的当前内容与版本号，仅在会话尚未建立时作为起点。
+func (h *Hub) Serve(ws *websocket.Conn, docID, userID int64, username, content string, version int) {
+	cl := &client{
+		Member: Member{ClientID: randomID(), UserID: userID, Username: username},
+		conn:   ws,
+		send:   make(chan []byte, sendBuffer),
+	}
+
+	r, err := h.join(docID, content, version, cl)
+	if err != nil {
+		log.Printf("协同会话建立失败 doc=%d: %v", docID, err)
+		_ = websocket.JSON.Send(ws, message{Type: "error", Message: "协同会话建立失败"})
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for b := range cl.send {
+			if _, err := ws.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+
+loop:
+	for {
+		var msg message
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			break
+		}
+		switch msg.Type {
+		case "op":
+			if msg.Op == nil {
+				r.sendTo(cl, message{Type: "error", Message: "缺少操作内容"})
+				continue
+			}
+			if err := r.submit(cl, msg.Rev, msg.Op); err != nil {
+				r.sendTo(cl, message{Type: "error", Message: err.Error()})
+				if errors.Is(err, errResync) {
+					break loop
+				}
+			}
+		case "cursor":
+			r.updateCursor(cl, msg.Anchor, msg.Head)
+		}
+	}
+
+	h.leave(r, cl)
+	cl.close()
+	<-done
+}
+
+// join 把客户端加入文档会话，会话不存在时创建。
+// 持有该文档的会话锁（见 lockDoc），与最后一个成员离开时的写回和会话关闭串行；Redis 读写期间不持有 h.mu。
+func (h *Hub) join(docID int64, content string, version int, cl *client) (*room, error) {
+	unlock := h.lockDoc(docID)
+	h.mu.Lock()
+	r, ok := h.rooms[docID]
+	h.mu.Unlock()
+	if !ok {
+		r = &room{
+			hub:     h,
+			docID:   docID,
+			clients: make(map[string]*client),
+			stop:    make(chan struct{}),
+		}
+		if err := r.init(content, version); err != nil {
+			unlock()
+			return nil, err
+		}
+		h.mu.Lock()
+		h.rooms[docID] = r
+		h.mu.Unlock()
+		go r.persistLoop()
+	}
+
+	remote := r.remotePresence()
+	r.mu.Lock()
+	r.clients[cl.ClientID] = cl
+	init := message{
+		Type:     "init",
+		Rev:      r.rev,
+		ClientID: cl.ClientID,
+		Content:  &r.content,
+		Members:  r.membersLocked(remote),
+	}
+	r.sendLocked(cl, init)
+	r.mu.Unlock()
+	unlock()
+
+	r.broadcastPresence(message{Type: "join", ClientID: cl.ClientID, UserID: cl.UserID, Username: cl.Username}, cl)
+	return r, nil
+}
+
+// leave 移除客户端；最后一个本地客户端离开时写回内容并关闭会话。
+// 写回与关闭期间持有该文档的会话锁，同时加入的客户端等会话关闭后再建立新会话。
+func (h *Hub) leave(r *room, cl *client) {
+	r.broadcastPresence(message{Type: "leave", ClientID: cl.ClientID, UserID: cl.UserID, Username: cl.Username}, cl)
+
+	unlock := h.lockDoc(r.docID)
+	defer unlock()
+	r.mu.Lock()
+	delete(r.clients, cl.ClientID)
+	empty := len(r.clients) == 0
+	if empty {
+		r.closed = true
+	}
+	r.mu.Unlock()
+	if !empty {
+		return
+	}
+
+	h.mu.Lock()
+	if h.rooms[r.docID] == r {
+		delete(h.rooms, r.docID)
+	}
+	h.mu.Unlock()
+	close(r.stop)
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+	if r.flush() == nil && !r.isStale() {
+		// 已写回：其他实例也无人在线时删除 Redis 中的会话，下次从 MySQL 重新建立
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		r.hub.cache.CollabEnd(ctx, r.docID)
+		cancel()
+	}
+}
+
+// init 建立会话状态；Redis 模式下先订阅再读取日志，保证不漏消息。
+func (r *room) init(content string, version int) error {
+	c := r.hub.cache
+	if !c.Enabled() {
+		r.content, r.version = content, version
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, unsubscribe, err := c.Subscribe(ctx, cache.CollabChannel(r.docID))
+	if err != nil {
+		return err
+	}
+	base, baseVersion, ops, err := c.CollabInit(ctx, r.docID, content, version)
+	if err != nil {
+		unsubscribe()
+		return err
+	}
+	r.content, r.version = base, baseVersion
+	for _, payload := range ops {
+		if err := r.applyPayloadLocked(r.rev+1, payload); err != nil {
+			unsubscribe()
+			return err
+		}
+	}
+	r.savedRev = r.rev
+	r.unsubscribe = unsubscribe
+	go r.receiveLoop(ch)
+	return nil
+}
+
+// submit 变换并提交客户端基于 clientRev 的操作。
+func (r *room) submit(cl *client, clientRev int, op *Operation) error {
+	for attempt := 0; attempt < maxAppendRetries; attempt++ {
+		r.mu.Lock()
+		if clientRev < r.baseRev || clientRev > r.rev {
+			r.mu.Unlock()
+			return errResync
+		}
+		transformed := op
+		for _, past := range r.history[clientRev-r.baseRev:] {
+			var err error
+			if transformed, _, err = Transform(transformed, past); err != nil {
+				r.mu.Unlock()
+				return err
+			}
+		}
+		if transformed.BaseLen() != utf16Len(r.content) {
+			r.mu.Unlock()
+			return ErrBadOperation
+		}
+		expected := r.rev
+
+		if !r.hub.cache.Enabled() {
+			err := r.applyLocked(expected+1, transformed, cl.ClientID, cl.UserID)
+			r.mu.Unlock()
+			return err
+		}
+		r.mu.Unlock()
+
+		payload, err := json.Marshal(message{Type: "op", Op: transformed, ClientID: cl.ClientID, UserID: cl.UserID})
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, ok, err := r.hub.cache.CollabAppend(ctx, r.docID, expected, payload)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if ok {
+			// 定序成功：本实例的订阅回调会应用该操作并给 cl 发 ack
+			return nil
+		}
+		if err := r.catchUp(); err != nil {
+			return err
+		}
+	}
+	return errors.New("提交冲突过多，请稍后重试")
+}
+
+// catchUp 从 Redis 补齐本地缺失的操作。
+func (r *room) catchUp() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.catchUpLocked()
+}
+
+func (r *room) catchUpLocked() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ops, err := r.hub.cache.CollabOps(ctx, r.docID, r.rev)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		// Redis 日志比本地短：会话 key 已过期被重建，本地状态作废
+		if n, err := r.hub.cache.CollabRev(ctx, r.docID); err == nil && n < r.rev {
+			return errResync
+		}
+	}
+	for _, payload := range ops {
+		if err := r.applyPayloadLocked(r.rev+1, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveLoop 处理 Redis 频道消息：操作按 rev 应用，其余为其他实例的在线状态。
+func (r *room) receiveLoop(ch <-chan string) {
+	for payload := range ch {
+		idx := strings.IndexByte(payload, ':')
+		rev, err := strconv.Atoi(payload[:max(idx, 0)])
+		if idx < 0 || err != nil {
+			r.relayPresence(payload)
+			continue
+		}
+
+		r.mu.Lock()
+		if r.closed || rev <= r.rev {
+			r.mu.Unlock()
+			continue
+		}
+		if rev > r.rev+1 {
+			if err := r.catchUpLocked(); err != nil {
+				r.resetLocked(err)
+				r.mu.Unlock()
+				continue
+			}
+		}
+		if rev == r.rev+1 {
+			if err := r.applyPayloadLocked(rev, payload[idx+1:]); err != nil {
+				r.resetLocked(err)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// applyPayloadLocked 解析并应用一条已定序的操作消息。
+func (r *room) applyPayloadLocked(rev int, payload string) error {
+	var msg message
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Op == nil {
+		return ErrBadOperation
+	}
+	return r.applyLocked(rev, msg.Op, msg.ClientID, msg.UserID)
+}
+
+// applyLocked 应用第 rev 号操作、平移在线成员光标，并通知本地客户端：
+// 操作发起者收到 ack，其他人收到 op。
+func (r *room) applyLocked(rev int, op *Operation, origin string, userID int64) error {
+	content, err := op.Apply(r.content)
+	if err != nil {
+		return err
+	}
+	r.content = content
+	r.rev = rev
+	r.lastUser = userID
+	r.history = append(r.history, op)
+	if over := len(r.history) - maxHistory; over > 0 {
+		r.history = append([]*Operation(nil), r.history[over:]...)
+		r.baseRev += over
+	}
+
+	for id, cl := range r.clients {
+		if id != origin {
+			cl.Anchor = op.TransformIndex(cl.Anchor)
+			cl.Head = op.TransformIndex(cl.Head)
+		}
+	}
+
+	for id, cl := range r.clients {
+		if id == origin {
+			r.sendLocked(cl, message{Type: "ack", Rev: rev})
+		} else {
+			r.sendLocked(cl, message{Type: "op", Rev: rev, Op: op, ClientID: origin, UserID: userID})
+		}
+	}
+	return nil
+}
+
+// resetLocked 会话状态无法恢复时通知本地客户端重连，并让会话在客户端断开后重建；作废的会话不再写回。
+func (r *room) resetLocked(err error) {
+	log.Printf("协同会话状态失效 doc=%d: %v", r.docID, err)
+	r.stale = true
+	text := errResync.Error()
+	if errors.Is(err, ErrStale) {
+		text = ErrStale.Error()
+	}
+	for _, cl := range r.clients {
+		r.sendLocked(cl, message{Type: "error", Message: text})
+		_ = cl.conn.Close()
+	}
+}
+
+func (r *room) isStale() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stale
+}
+
+// discard 文档已在会话之外被修改：删除 Redis 中的会话并通知其他实例，本地客户端重新加入后从 MySQL 读取
+func (r *room) discard(err error) {
+	if c := r.hub.cache; c.Enabled() {
+		if b, mErr := json.Marshal(message{Type: "reset", Instance: r.hub.instance}); mErr == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			c.CollabReset(ctx, r.docID, b)
+			cancel()
+		}
+	}
+	r.mu.Lock()
+	r.resetLocked(err)
+	r.mu.Unlock()
+}
+
+// updateCursor 记录光标并广播给其他成员。
+func (r *room) updateCursor(cl *client, anchor, head int) {
+	r.mu.Lock()
+	cl.Anchor, cl.Head = anchor, head
+	r.mu.Unlock()
+	r.broadcastPresence(message{
+		Type: "cursor", ClientID: cl.ClientID, UserID: cl.UserID, Username: cl.Username,
+		Anchor: anchor, Head: head,
+	}, cl)
+}
+
+// broadcastPresence 把在线状态发给本地其他客户端，Redis 模式下同时发布给其他实例。
+func (r *room) broadcastPresence(msg message, from *client) {
+	r.mu.Lock()
+	for id, cl := range r.clients {
+		if id != from.ClientID {
+			r.sendLocked(cl, msg)
+		}
+	}
+	r.mu.Unlock()
+
+	c := r.hub.cache
+	if !c.Enabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	switch msg.Type {
+	case "leave":
+		c.CollabDelPresence(ctx, r.docID, from.ClientID)
+	default:
+		if b, err := json.Marshal(from.Member); err == nil {
+			c.CollabSetPresence(ctx, r.docID, from.ClientID, b)
+		}
+	}
+	msg.Instance = r.hub.instance
+	if b, err := json.Marshal(msg); err == nil {
+		c.Publish(ctx, cache.CollabChannel(r.docID), b)
+	}
+}
+
+// relayPresence 转发其他实例发布的在线状态。
+func (r *room) relayPresence(payload string) {
+	var msg message
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.Instance == r.hub.instance {
+		return
+	}
+	msg.Instance = ""
+	r.mu.Lock()
+	if msg.Type == "reset" {
+		r.resetLocked(ErrStale)
+	} else {
+		for _, cl := range r.clients {
+			r.sendLocked(cl, msg)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// remotePresence 读取 Redis 中全部实例的在线成员，单实例模式返回 nil；调用时不持有任何锁。
+func (r *room) remotePresence() []string {
+	if !r.hub.cache.Enabled() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return r.hub.cache.CollabPresence(ctx, r.docID)
+}
+
+// membersLocked 返回在线成员：remote（见 remotePresence）加上其中没有的本地成员。
+func (r *room) membersLocked(remote []string) []Member {
+	members := []Member{}
+	seen := make(map[string]bool)
+	for _, raw := range remote {
+		var m Member
+		if json.Unmarshal([]byte(raw), &m) == nil && !seen[m.ClientID] {
+			seen[m.ClientID] = true
+			members = append(members, m)
+		}
+	}
+	for id, cl := range r.clients {
+		if !seen[id] {
+			members = append(members, cl.Member)
+		}
+	}
+	return members
+}
+
+func (r *room) sendTo(cl *client, msg message) {
+	r.mu.Lock()
+	r.sendLocked(cl, msg)
+	r.mu.Unlock()
+}
+
+// sendLocked 非阻塞发送；缓冲已满说明客户端过慢，关闭其连接。
+func (r *room) sendLocked(cl *client, msg message) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case cl.send <- b:
+	default:
+		log.Printf("协同客户端发送缓冲已满，断开 doc=%d client=%s", r.docID, cl.ClientID)
+		_ = cl.conn.Close()
+	}
+}
+
+// persistLoop 定期把合并结果写回 MySQL。
+func (r *room) persistLoop() {
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+// flush 内容有新版本时写回；多实例下只有抢到该 rev 的实例执行写入。
+// 文档已在会话之外被修改时作废会话，不覆盖他人的保存。
+func (r *room) flush() error {
+	r.mu.Lock()
+	rev, content, version, userID := r.rev, r.content, r.version, r.lastUser
+	dirty := rev > r.savedRev && !r.stale
+	r.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	c := r.hub.cache
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	claimed := c.CollabClaimSave(ctx, r.docID, rev)
+	// 其他实例可能已写回过更新的版本
+	version = max(version, c.CollabVersion(ctx, r.docID))
+	cancel()
+	if claimed {
+		saved, err := r.hub.persist(r.docID, version, userID, content)
+		if errors.Is(err, ErrStale) {
+			r.discard(err)
+			return err
+		}
+		if err != nil {
+			log.Printf("协同内容保存失败 doc=%d rev=%d: %v", r.docID, rev, err)
+			return err
+		}
+		version = saved
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		c.CollabSetVersion(ctx, r.docID, version)
+		cancel()
+	}
+
+	r.mu.Lock()
+	if rev > r.savedRev {
+		r.savedRev = rev
+	}
+	r.version = max(r.version, version)
+	r.mu.Unlock()
+	return nil
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
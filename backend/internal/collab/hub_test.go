@@ -0,0 +1,84 @@
+package collab
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func testClient(id string) *client {
+	return &client{Member: Member{ClientID: id, UserID: 1, Username: "u"}, send: make(chan []byte, 1024)}
+}
+
+// 最后一个成员离开时写回并关闭会话，之后加入的客户端建立新会话
+func TestHubJoinLeave(t *testing.T) {
+	var persisted []string
+	h := NewHub(nil, func(docID int64, version int, userID int64, content string) (int, error) {
+		persisted = append(persisted, content)
+		return version + 1, nil
+	})
+
+	a, b := testClient("a"), testClient("b")
+	r, err := h.join(1, "xy", 1, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2, _ := h.join(1, "ignored", 1, b); r2 != r {
+		t.Fatal("同一文档应加入同一会话")
+	}
+	if err := r.submit(a, 0, (&Operation{}).Retain(2).Insert("😀")); err != nil {
+		t.Fatal(err)
+	}
+	h.leave(r, a)
+	if len(persisted) != 0 {
+		t.Fatal("还有成员在线时不应关闭会话")
+	}
+	h.leave(r, b)
+	if len(persisted) != 1 || persisted[0] != "xy😀" {
+		t.Fatalf("写回 %q", persisted)
+	}
+	if len(h.rooms) != 0 || len(h.locks) != 0 {
+		t.Fatalf("会话或会话锁未清理：rooms=%d locks=%d", len(h.rooms), len(h.locks))
+	}
+
+	c := testClient("c")
+	r3, err := h.join(1, "new", 2, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3 == r || r3.content != "new" {
+		t.Fatalf("应建立新会话，内容 %q", r3.content)
+	}
+	h.leave(r3, c)
+}
+
+// 同一文档并发加入与离开：不会加入已关闭的会话，结束后不留下会话与锁
+func TestHubConcurrentJoinLeave(t *testing.T) {
+	h := NewHub(nil, func(docID int64, version int, userID int64, content string) (int, error) {
+		return version, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cl := testClient(fmt.Sprint(i))
+			r, err := h.join(int64(i%3), "doc", 1, cl)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				t.Error("加入了已关闭的会话")
+			}
+			h.leave(r, cl)
+		}(i)
+	}
+	wg.Wait()
+	if len(h.rooms) != 0 || len(h.locks) != 0 {
+		t.Fatalf("会话或会话锁未清理：rooms=%d locks=%d", len(h.rooms), len(h.locks))
+	}
+}
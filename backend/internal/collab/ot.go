@@ -0,0 +1,271 @@
+// Package collab 实现文档实时协同编辑：基于 OT（操作变换）合并并发修改，
+// 通过 WebSocket 与客户端通信，多实例部署时经 Redis 定序与广播（见 cache 包）。
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ErrBadOperation 表示操作与文档长度不匹配或格式非法。
+var ErrBadOperation = errors.New("invalid operation")
+
+// component 是操作的一个分量：retain>0 保留、del>0 删除、insert 非空为插入，三者互斥。
+type component struct {
+	retain int
+	del    int
+	insert string
+}
+
+// Operation 是对整篇文档的一次顺序遍历。
+// 线上格式与 ot.js 一致：正整数 = retain，负整数 = delete，字符串 = insert；
+// 长度单位与 ot.js、浏览器相同，为 UTF-16 码元（即 JavaScript 字符串下标，emoji 等字符占 2）。
+type Operation struct {
+	ops       []component
+	baseLen   int
+	targetLen int
+}
+
+// BaseLen 返回操作要求的原文长度。
+func (o *Operation) BaseLen() int { return o.baseLen }
+
+// TargetLen 返回操作应用后的文本长度。
+func (o *Operation) TargetLen() int { return o.targetLen }
+
+// Retain 追加保留 n 个字符。
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].retain > 0 {
+		o.ops[last].retain += n
+	} else {
+		o.ops = append(o.ops, component{retain: n})
+	}
+	return o
+}
+
+// Insert 追加插入文本；紧邻删除时插入排在删除之前，保证同一编辑的表示唯一。
+func (o *Operation) Insert(s string) *Operation {
+	if s == "" {
+		return o
+	}
+	o.targetLen += utf16Len(s)
+	last := len(o.ops) - 1
+	switch {
+	case last >= 0 && o.ops[last].insert != "":
+		o.ops[last].insert += s
+	case last >= 0 && o.ops[last].del > 0:
+		if last > 0 && o.ops[last-1].insert != "" {
+			o.ops[last-1].insert += s
+		} else {
+			o.ops = append(o.ops, o.ops[last])
+			o.ops[last] = component{insert: s}
+		}
+	default:
+		o.ops = append(o.ops, component{insert: s})
+	}
+	return o
+}
+
+// Delete 追加删除 n 个字符。
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].del > 0 {
+		o.ops[last].del += n
+	} else {
+		o.ops = append(o.ops, component{del: n})
+	}
+	return o
+}
+
+// IsNoop 返回操作是否不改变文档。
+func (o *Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+// Apply 将操作应用到文本；retain / delete 的边界落在代理对中间时返回 ErrBadOperation。
+func (o *Operation) Apply(doc string) (string, error) {
+	units := utf16.Encode([]rune(doc))
+	if len(units) != o.baseLen {
+		return "", fmt.Errorf("%w: base length %d, document length %d", ErrBadOperation, o.baseLen, len(units))
+	}
+	out := make([]uint16, 0, o.targetLen)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out = append(out, units[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.del > 0:
+			pos += c.del
+		default:
+			out = append(out, utf16.Encode([]rune(c.insert))...)
+			continue
+		}
+		if splitsSurrogate(units, pos) {
+			return "", fmt.Errorf("%w: offset %d splits a surrogate pair", ErrBadOperation, pos)
+		}
+	}
+	return string(utf16.Decode(out)), nil
+}
+
+// utf16Len 返回 s 的 UTF-16 码元数。
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// splitsSurrogate 判断下标 i 是否落在 units 中一个代理对的两半之间。
+func splitsSurrogate(units []uint16, i int) bool {
+	return i > 0 && i < len(units) && units[i-1] >= 0xD800 && units[i-1] < 0xDC00 && units[i] >= 0xDC00 && units[i] < 0xE000
+}
+
+// TransformIndex 把光标位置按操作平移：位于插入点之后的光标后移，删除区间内的光标收缩到区间起点。
+func (o *Operation) TransformIndex(index int) int {
+	newIndex := index
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			index -= c.retain
+		case c.del > 0:
+			newIndex -= min(index, c.del)
+			index -= c.del
+		default:
+			newIndex += utf16Len(c.insert)
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// Transform 对基于同一文本的并发操作 a、b 做变换，返回 a'、b'，
+// 满足 apply(apply(s, a), b') == apply(apply(s, b), a')。同一位置的插入 a 在前。
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, fmt.Errorf("%w: concurrent operations have different base length", ErrBadOperation)
+	}
+	ap, bp := &Operation{}, &Operation{}
+	ops1, ops2 := append([]component(nil), a.ops...), append([]component(nil), b.ops...)
+	i, j := 0, 0
+	next := func(ops []component, k *int) *component {
+		if *k >= len(ops) {
+			return nil
+		}
+		c := &ops[*k]
+		*k++
+		return c
+	}
+	o1, o2 := next(ops1, &i), next(ops2, &j)
+	for o1 != nil || o2 != nil {
+		if o1 != nil && o1.insert != "" {
+			ap.Insert(o1.insert)
+			bp.Retain(utf16Len(o1.insert))
+			o1 = next(ops1, &i)
+			continue
+		}
+		if o2 != nil && o2.insert != "" {
+			ap.Retain(utf16Len(o2.insert))
+			bp.Insert(o2.insert)
+			o2 = next(ops2, &j)
+			continue
+		}
+		if o1 == nil || o2 == nil {
+			return nil, nil, fmt.Errorf("%w: operations are not compatible", ErrBadOperation)
+		}
+
+		n1, n2 := o1.retain+o1.del, o2.retain+o2.del
+		n := min(n1, n2)
+		switch {
+		case o1.retain > 0 && o2.retain > 0:
+			ap.Retain(n)
+			bp.Retain(n)
+		case o1.del > 0 && o2.del > 0:
+			// 双方删除同一段：都不再需要输出
+		case o1.del > 0 && o2.retain > 0:
+			ap.Delete(n)
+		default: // o1 retain, o2 delete
+			bp.Delete(n)
+		}
+
+		if n1 == n {
+			o1 = next(ops1, &i)
+		} else {
+			shrink(o1, n)
+		}
+		if n2 == n {
+			o2 = next(ops2, &j)
+		} else {
+			shrink(o2, n)
+		}
+	}
+	return ap, bp, nil
+}
+
+func shrink(c *component, n int) {
+	if c.retain > 0 {
+		c.retain -= n
+	} else {
+		c.del -= n
+	}
+}
+
+// MarshalJSON 输出 ot.js 兼容格式。
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, 0, len(o.ops))
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out = append(out, c.retain)
+		case c.del > 0:
+			out = append(out, -c.del)
+		default:
+			out = append(out, c.insert)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON 解析 ot.js 兼容格式。
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = Operation{}
+	for _, r := range raw {
+		var n int
+		if err := json.Unmarshal(r, &n); err == nil {
+			if n > 0 {
+				o.Retain(n)
+			} else if n < 0 {
+				o.Delete(-n)
+			} else {
+				return ErrBadOperation
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(r, &s); err != nil || s == "" {
+			return ErrBadOperation
+		}
+		o.Insert(s)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+)
+
+// randomOp 生成基于 doc 的随机操作，插入内容含多字节与 UTF-16 代理对字符；retain / delete 不拆开代理对
+func randomOp(rng *rand.Rand, doc string) *Operation {
+	alphabet := []rune("ab中文😀\n")
+	op := &Operation{}
+	units := utf16.Encode([]rune(doc))
+	left := len(units)
+	for left > 0 {
+		n := 1 + rng.Intn(min(left, 5))
+		if splitsSurrogate(units, len(units)-left+n) {
+			n++
+		}
+		switch rng.Intn(3) {
+		case 0:
+			op.Retain(n)
+			left -= n
+		case 1:
+			op.Delete(n)
+			left -= n
+		default:
+			s := make([]rune, 1+rng.Intn(3))
+			for i := range s {
+				s[i] = alphabet[rng.Intn(len(alphabet))]
+			}
+			op.Insert(string(s))
+		}
+	}
+	if rng.Intn(2) == 0 {
+		op.Insert("尾")
+	}
+	return op
+}
+
+func mustApply(t *testing.T, op *Operation, doc string) string {
+	t.Helper()
+	out, err := op.Apply(doc)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if n := len(utf16.Encode([]rune(out))); n != op.TargetLen() {
+		t.Fatalf("结果长度 %d，TargetLen %d", n, op.TargetLen())
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	// 😀 在 UTF-16 中占 2 个码元
+	op := (&Operation{}).Retain(2).Delete(2).Insert("中文").Retain(1)
+	got := mustApply(t, op, "ab😀c")
+	if got != "ab中文c" {
+		t.Fatalf("得到 %q", got)
+	}
+	if _, err := op.Apply("abc"); !errors.Is(err, ErrBadOperation) {
+		t.Fatalf("长度不符应返回 ErrBadOperation，得到 %v", err)
+	}
+	if got := mustApply(t, (&Operation{}).Retain(1).Insert("🎉").Retain(4), "a😀😀"); got != "a🎉😀😀" {
+		t.Fatalf("得到 %q", got)
+	}
+}
+
+// retain / delete 的边界不能落在代理对中间
+func TestApplySplitSurrogate(t *testing.T) {
+	for _, op := range []*Operation{
+		(&Operation{}).Retain(2).Delete(1).Retain(1),
+		(&Operation{}).Retain(1).Delete(1).Retain(2),
+		(&Operation{}).Retain(2).Insert("x").Retain(2),
+	} {
+		if _, err := op.Apply("a😀c"); !errors.Is(err, ErrBadOperation) {
+			t.Errorf("%v 应返回 ErrBadOperation，得到 %v", op, err)
+		}
+	}
+}
+
+// TP1：apply(apply(s, a), b') == apply(apply(s, b), a')
+func TestTransformConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	docs := []string{"", "hello", "中文😀混合 text\n第二行"}
+	for i := 0; i < 2000; i++ {
+		doc := docs[i%len(docs)]
+		a, b := randomOp(rng, doc), randomOp(rng, doc)
+		ap, bp, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Transform: %v", err)
+		}
+		left := mustApply(t, bp, mustApply(t, a, doc))
+		right := mustApply(t, ap, mustApply(t, b, doc))
+		if left != right {
+			t.Fatalf("不收敛：doc=%q a=%v b=%v\n%q\n%q", doc, a, b, left, right)
+		}
+	}
+}
+
+// 同一位置的并发插入，a 的内容排在前面
+func TestTransformInsertTie(t *testing.T) {
+	a := (&Operation{}).Retain(1).Insert("A").Retain(1)
+	b := (&Operation{}).Retain(1).Insert("B").Retain(1)
+	ap, bp, err := Transform(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustApply(t, bp, mustApply(t, a, "xy")); got != "xABy" {
+		t.Fatalf("得到 %q", got)
+	}
+	if got := mustApply(t, ap, mustApply(t, b, "xy")); got != "xABy" {
+		t.Fatalf("得到 %q", got)
+	}
+}
+
+func TestTransformBaseMismatch(t *testing.T) {
+	a := (&Operation{}).Retain(3)
+	b := (&Operation{}).Retain(4)
+	if _, _, err := Transform(a, b); !errors.Is(err, ErrBadOperation) {
+		t.Fatalf("应返回 ErrBadOperation，得到 %v", err)
+	}
+}
+
+// 与 ot.js 客户端一样按 UTF-16 码元计算光标位置
+func TestTransformIndexAstral(t *testing.T) {
+	// "😀ab" → 在开头插入 "🎉"
+	op := (&Operation{}).Insert("🎉").Retain(4)
+	cases := map[int]int{0: 2, 2: 4, 4: 6}
+	for in, want := range cases {
+		if got := op.TransformIndex(in); got != want {
+			t.Errorf("TransformIndex(%d) = %d，期望 %d", in, got, want)
+		}
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	// "hello world" → 删除 "hello "，在开头插入 "hi "
+	op := (&Operation{}).Insert("hi ").Delete(6).Retain(5)
+	cases := map[int]int{0: 3, 3: 3, 6: 3, 8: 5, 11: 8}
+	for in, want := range cases {
+		if got := op.TransformIndex(in); got != want {
+			t.Errorf("TransformIndex(%d) = %d，期望 %d", in, got, want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	var op Operation
+	if err := json.Unmarshal([]byte(`[3,"ab",-2,1]`), &op); err != nil {
+		t.Fatal(err)
+	}
+	if op.BaseLen() != 6 || op.TargetLen() != 6 {
+		t.Fatalf("base %d target %d", op.BaseLen(), op.TargetLen())
+	}
+	b, err := json.Marshal(&op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `[3,"ab",-2,1]` {
+		t.Fatalf("得到 %s", b)
+	}
+	// ot.js 客户端对 "a😀b" 删除 emoji 并插入 "🎉"：base 4、target 4
+	if err := json.Unmarshal([]byte(`[1,-2,"🎉",1]`), &op); err != nil {
+		t.Fatal(err)
+	}
+	if op.BaseLen() != 4 || op.TargetLen() != 4 {
+		t.Fatalf("base %d target %d", op.BaseLen(), op.TargetLen())
+	}
+	if got := mustApply(t, &op, "a😀b"); got != "a🎉b" {
+		t.Fatalf("得到 %q", got)
+	}
+	for _, bad := range []string{`[0]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(bad), &op); err == nil {
+			t.Errorf("%s 应解析失败", bad)
+		}
+	}
+}
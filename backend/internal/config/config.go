@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"strconv"
 )
@@ -9,8 +12,57 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Share    ShareConfig
 	CORS     CORSConfig
 	Redis    RedisConfig
+	Revision RevisionConfig
+	Trash    TrashConfig
+	Storage  StorageConfig
+	UploadGC UploadGCConfig
+	Admin    AdminConfig
+}
+
+// RevisionConfig 文档修订保留策略；两项为 0 表示不限制。
+// 每篇文档最新的一条修订永远保留（对应当前内容）。
+type RevisionConfig struct {
+	MaxPerDocument int // 每篇文档最多保留的修订条数
+	RetentionDays  int // 超过该天数的旧修订会被清理
+}
+
+// TrashConfig 回收站策略：删除的文档在回收站中保留 RetentionDays 天后被永久清除；0 表示不自动清除。
+type TrashConfig struct {
+	RetentionDays int
+}
+
+// StorageConfig 上传文件的存储后端：Driver 为 local（默认，存于本机 LocalDir）或 s3（S3 兼容的对象存储，如 AWS S3、MinIO）。
+// 多实例部署时须使用 s3，各实例共享同一份文件
+type StorageConfig struct {
+	Driver   string
+	LocalDir string
+	S3       S3Config
+}
+
+// S3Config S3 兼容对象存储的连接参数
+type S3Config struct {
+	Endpoint  string // 如 https://s3.us-east-1.amazonaws.com、http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // 对象键前缀，如 markdown-editor/，同一 bucket 存放多套数据时使用
+	PathStyle bool   // 路径风格寻址（endpoint/bucket/key），MinIO 等自建服务通常需要开启
+}
+
+// UploadGCConfig 孤儿上传文件清理：没有被任何文档、修订或附件引用的文件先移入隔离区，GraceDays 天后仍无引用才永久删除。
+// IntervalHours 为后台清理周期，0 表示只通过管理接口手动触发
+type UploadGCConfig struct {
+	IntervalHours int
+	GraceDays     int
+}
+
+// AdminConfig 管理员的用户 ID（users.id），逗号分隔多个；只有这些用户可以调用 /api/admin 下的接口
+type AdminConfig struct {
+	UserIDs string
 }
 
 type RedisConfig struct {
@@ -43,7 +95,22 @@ type JWTConfig struct {
 	RefreshExpiry int // refresh token 有效期（小时）
 }
 
+// ShareConfig 分享链接令牌的签名密钥，与 JWT 签名密钥分开：可单独更换，更换后已发出的分享链接全部失效
+type ShareConfig struct {
+	Secret string
+}
+
+// deriveKey 用 HKDF-SHA256 从 secret 派生标签为 label 的独立密钥（hex）
+func deriveKey(secret, label string) string {
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, label, 32)
+	if err != nil {
+		panic(err) // 只在请求长度超过 HKDF 上限时出错
+	}
+	return hex.EncodeToString(key)
+}
+
 func Load() *Config {
+	jwtSecret := getEnv("JWT_SECRET", "your-secret-key-change-in-production")
 	return &Config{
 		Server: ServerConfig{
 			Port: getEnvAsInt("SERVER_PORT", 8080),
@@ -57,10 +124,14 @@ func Load() *Config {
 			DBName:   getEnv("DB_NAME", "markdown_editor"),
 		},
 		JWT: JWTConfig{
-			Secret:        getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			Secret:        jwtSecret,
 			AccessExpiry:  getEnvAsInt("JWT_ACCESS_EXPIRY", 15),
 			RefreshExpiry: getEnvAsInt("JWT_REFRESH_EXPIRY", 168),
 		},
+		Share: ShareConfig{
+			// 未配置时从 JWT_SECRET 派生，两类令牌不共用同一把密钥
+			Secret: getEnv("SHARE_SECRET", deriveKey(jwtSecret, "share-link")),
+		},
 		CORS: CORSConfig{
 			AllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", ""),
 		},
@@ -69,6 +140,33 @@ func Load() *Config {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
 		},
+		Revision: RevisionConfig{
+			MaxPerDocument: getEnvAsInt("REVISION_MAX_PER_DOCUMENT", 50),
+			RetentionDays:  getEnvAsInt("REVISION_RETENTION_DAYS", 90),
+		},
+		Trash: TrashConfig{
+			RetentionDays: getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		},
+		Storage: StorageConfig{
+			Driver:   getEnv("STORAGE_DRIVER", "local"),
+			LocalDir: getEnv("STORAGE_LOCAL_DIR", "uploads"),
+			S3: S3Config{
+				Endpoint:  getEnv("S3_ENDPOINT", ""),
+				Region:    getEnv("S3_REGION", "us-east-1"),
+				Bucket:    getEnv("S3_BUCKET", ""),
+				AccessKey: getEnv("S3_ACCESS_KEY", ""),
+				SecretKey: getEnv("S3_SECRET_KEY", ""),
+				Prefix:    getEnv("S3_PREFIX", ""),
+				PathStyle: getEnvAsBool("S3_PATH_STYLE", false),
+			},
+		},
+		UploadGC: UploadGCConfig{
+			IntervalHours: getEnvAsInt("UPLOAD_GC_INTERVAL_HOURS", 24),
+			GraceDays:     getEnvAsInt("UPLOAD_GC_GRACE_DAYS", 7),
+		},
+		Admin: AdminConfig{
+			UserIDs: getEnv("ADMIN_USER_IDS", ""),
+		},
 	}
 }
 
@@ -86,3 +184,10 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(getEnv(key, "")); err == nil {
+		return value
+	}
+	return defaultValue
+}
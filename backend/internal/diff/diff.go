@@ -0,0 +1,247 @@
+// Package diff 提供基于 Myers 算法的按行文本差异比较，用于文档修订对比。
+package diff
+
+import "strings"
+
+// Op 差异块类型。
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Chunk 一段连续的相同/新增/删除行。
+// OldStart / NewStart 为该块在旧/新文本中的起始行号（从 1 开始）。
+type Chunk struct {
+	Op       string   `json:"op"`
+	OldStart int      `json:"old_start"`
+	NewStart int      `json:"new_start"`
+	Lines    []string `json:"lines"`
+}
+
+// Stats 差异统计。
+type Stats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// SplitLines 按 \n 切分文本（兼容 \r\n），末尾换行不产生空行。
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	return strings.Split(s, "\n")
+}
+
+// Lines 比较新旧两段文本，返回按顺序排列的差异块与统计。
+func Lines(oldText, newText string) ([]Chunk, Stats) {
+	a, b := SplitLines(oldText), SplitLines(newText)
+
+	// 先剥离公共前后缀，缩小 Myers 的搜索空间
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []byte // 每行一个操作：'=' '+' '-'
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, '=')
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, '=')
+	}
+
+	return buildChunks(a, b, ops)
+}
+
+// maxCost 是一次比较中 Myers 搜索的步数上限。两段内容差异过大时，剩余部分不再求最短编辑脚本，
+// 直接输出整段删除与新增，避免任何人请求对比时占用过多 CPU。
+const maxCost = 1 << 24
+
+// myers 返回把 a 变为 b 的编辑脚本。采用线性空间的 Myers 算法：从两端同时搜索找到中间蛇形，
+// 以其为界递归比较两侧，内存为 O(N+M)；搜索步数超过 maxCost 后退化为整段替换。
+func myers(a, b []string) []byte {
+	// 行映射为整数，比较更快
+	ids := make(map[string]int, len(a)+len(b))
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{ops: make([]byte, 0, len(a)+len(b)), budget: maxCost}
+	d.compare(intern(a), intern(b))
+	return d.ops
+}
+
+type differ struct {
+	ops    []byte
+	budget int
+}
+
+func (d *differ) emit(op byte, n int) {
+	for i := 0; i < n; i++ {
+		d.ops = append(d.ops, op)
+	}
+}
+
+// compare 比较 a 与 b，把编辑操作追加到 d.ops。
+func (d *differ) compare(a, b []int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	d.emit('=', prefix)
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		d.emit('+', len(b))
+	case len(b) == 0:
+		d.emit('-', len(a))
+	default:
+		if x, y, ok := d.bisect(a, b); ok {
+			d.compare(a[:x], b[:y])
+			d.compare(a[x:], b[y:])
+		} else {
+			d.emit('-', len(a))
+			d.emit('+', len(b))
+		}
+	}
+	d.emit('=', suffix)
+}
+
+// bisect 从两端同时做 Myers 搜索，返回正反两条路径相遇处 (x, y)，以此把问题一分为二。
+// a、b 均非空且首尾行不同；两者没有公共行或步数耗尽时 ok 为 false。
+func (d *differ) bisect(a, b []int) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	vf := make([]int, size) // 正向：各对角线 k 上走到的最远 x
+	vb := make([]int, size) // 反向：从末尾算起走到的最远 x
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+	delta := n - m
+	// delta 为奇数时正向搜索先与反向路径重叠，否则反向先重叠
+	front := delta%2 != 0
+	// 越出网格的对角线不再扩展
+	kfStart, kfEnd, kbStart, kbEnd := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		if d.budget -= 2*step + 1; d.budget < 0 {
+			return 0, 0, false
+		}
+		for k := -step + kfStart; k <= step-kfEnd; k += 2 {
+			i := offset + k
+			var xf int
+			if k == -step || (k != step && vf[i-1] < vf[i+1]) {
+				xf = vf[i+1]
+			} else {
+				xf = vf[i-1] + 1
+			}
+			yf := xf - k
+			for xf < n && yf < m && a[xf] == b[yf] {
+				xf++
+				yf++
+			}
+			vf[i] = xf
+			switch {
+			case xf > n:
+				kfEnd += 2
+			case yf > m:
+				kfStart += 2
+			case front:
+				j := offset + delta - k
+				if j >= 0 && j < size && vb[j] != -1 && xf >= n-vb[j] {
+					return xf, yf, true
+				}
+			}
+		}
+		for k := -step + kbStart; k <= step-kbEnd; k += 2 {
+			i := offset + k
+			var xb int
+			if k == -step || (k != step && vb[i-1] < vb[i+1]) {
+				xb = vb[i+1]
+			} else {
+				xb = vb[i-1] + 1
+			}
+			yb := xb - k
+			for xb < n && yb < m && a[n-xb-1] == b[m-yb-1] {
+				xb++
+				yb++
+			}
+			vb[i] = xb
+			switch {
+			case xb > n:
+				kbEnd += 2
+			case yb > m:
+				kbStart += 2
+			case !front:
+				j := offset + delta - k
+				if j >= 0 && j < size && vf[j] != -1 {
+					xf := vf[j]
+					yf := offset + xf - j
+					if xf >= n-xb {
+						return xf, yf, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func buildChunks(a, b []string, ops []byte) ([]Chunk, Stats) {
+	var chunks []Chunk
+	var stats Stats
+	i, j := 0, 0
+	for _, op := range ops {
+		var kind, line string
+		switch op {
+		case '=':
+			kind, line = OpEqual, a[i]
+		case '-':
+			kind, line = OpDelete, a[i]
+			stats.Removed++
+		default:
+			kind, line = OpInsert, b[j]
+			stats.Added++
+		}
+		if n := len(chunks); n > 0 && chunks[n-1].Op == kind {
+			chunks[n-1].Lines = append(chunks[n-1].Lines, line)
+		} else {
+			chunks = append(chunks, Chunk{Op: kind, OldStart: i + 1, NewStart: j + 1, Lines: []string{line}})
+		}
+		switch op {
+		case '=':
+			i++
+			j++
+		case '-':
+			i++
+		default:
+			j++
+		}
+	}
+	return chunks, stats
+}
@@ -0,0 +1,142 @@
+package diff
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apply 按差异块从旧文本还原新文本，并校验 equal / delete 块与旧文本一致
+func apply(t *testing.T, a []string, chunks []Chunk) []string {
+	t.Helper()
+	var out []string
+	i := 0
+	for _, c := range chunks {
+		if c.Op != OpInsert && c.OldStart != i+1 {
+			t.Fatalf("块 %+v 的 old_start 应为 %d", c, i+1)
+		}
+		switch c.Op {
+		case OpEqual, OpDelete:
+			for _, l := range c.Lines {
+				if i >= len(a) || a[i] != l {
+					t.Fatalf("块 %+v 与旧文本第 %d 行不一致", c, i+1)
+				}
+				i++
+			}
+			if c.Op == OpEqual {
+				out = append(out, c.Lines...)
+			}
+		case OpInsert:
+			out = append(out, c.Lines...)
+		}
+	}
+	if i != len(a) {
+		t.Fatalf("只消耗了旧文本 %d/%d 行", i, len(a))
+	}
+	return out
+}
+
+// lcs 用动态规划求最长公共子序列长度，作为最短编辑距离的参照
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func check(t *testing.T, oldText, newText string) Stats {
+	t.Helper()
+	chunks, stats := Lines(oldText, newText)
+	a, b := SplitLines(oldText), SplitLines(newText)
+	if got := apply(t, a, chunks); strings.Join(got, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("还原结果不一致:\n%q\n%q", got, b)
+	}
+	return stats
+}
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		old, new       string
+		added, removed int
+	}{
+		{"", "", 0, 0},
+		{"", "a\nb\n", 2, 0},
+		{"a\nb\n", "", 0, 2},
+		{"a\nb\nc\n", "a\nb\nc\n", 0, 0},
+		{"a\nb\nc\n", "a\nx\nc\n", 1, 1},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 2, 3},
+		{"a\r\nb\r\n", "a\nb\n", 0, 0},
+	}
+	for _, c := range cases {
+		st := check(t, c.old, c.new)
+		if st.Added != c.added || st.Removed != c.removed {
+			t.Errorf("Lines(%q, %q) = +%d -%d, 期望 +%d -%d", c.old, c.new, st.Added, st.Removed, c.added, c.removed)
+		}
+	}
+}
+
+func TestLinesMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := gen(), gen()
+		st := check(t, strings.Join(a, "\n"), strings.Join(b, "\n"))
+		common := lcs(a, b)
+		if st.Removed != len(a)-common || st.Added != len(b)-common {
+			t.Fatalf("%q → %q: +%d -%d，最短应为 +%d -%d", a, b, st.Added, st.Removed, len(b)-common, len(a)-common)
+		}
+	}
+}
+
+// 两个毫不相关的大版本：线性空间下应很快完成
+func TestLinesUnrelatedLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 20000; i++ {
+		a.WriteString("old " + strconv.Itoa(i) + "\n")
+		b.WriteString("new " + strconv.Itoa(i) + "\n")
+	}
+	start := time.Now()
+	st := check(t, a.String(), b.String())
+	if st.Added != 20000 || st.Removed != 20000 {
+		t.Fatalf("+%d -%d", st.Added, st.Removed)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("耗时 %v", d)
+	}
+}
+
+// 大量分散的小改动超出搜索步数上限时仍返回正确（未必最短）的差异
+func TestLinesBudget(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	a := make([]string, 30000)
+	b := make([]string, 30000)
+	for i := range a {
+		a[i] = strconv.Itoa(rng.Intn(50))
+		b[i] = strconv.Itoa(rng.Intn(50))
+	}
+	start := time.Now()
+	check(t, strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("耗时 %v", d)
+	}
+}
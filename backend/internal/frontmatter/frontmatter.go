@@ -0,0 +1,215 @@
+// Package frontmatter 读写 Markdown 文件开头的 YAML front matter：
+//
+//	---
+//	title: 标题
+//	tags: [a, b]
+//	---
+//	正文……
+//
+// 读取时元数据以 yaml.MapSlice 表示，保留原有键的顺序；写回用 Patch 只替换指定键所在的行，
+// 不重新序列化整段 YAML，用户手写的注释、顺序与引号风格保持不变。
+package frontmatter
+
+import (
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const delimiter = "---"
+
+// Split 拆出 front matter 的 YAML 原文与正文；文档不以 front matter 开头时 ok 为 false，body 为原文。
+func Split(content string) (raw, body string, ok bool) {
+	start, end, bodyStart, ok := bounds(content)
+	if !ok {
+		return "", content, false
+	}
+	return content[start:end], content[bodyStart:], true
+}
+
+// bounds 返回 front matter 的 YAML 原文在 content 中的起止位置，以及正文的起始位置
+func bounds(content string) (start, end, bodyStart int, ok bool) {
+	s := strings.TrimPrefix(content, "\uFEFF")
+	offset := len(content) - len(s)
+	first, rest, found := strings.Cut(s, "\n")
+	if !found || strings.TrimRight(first, " \r") != delimiter {
+		return 0, 0, 0, false
+	}
+	start = offset + len(first) + 1
+	for pos := 0; pos <= len(rest); {
+		line, _, more := strings.Cut(rest[pos:], "\n")
+		if t := strings.TrimRight(line, " \r"); t == delimiter || t == "..." {
+			bodyStart = len(content)
+			if more {
+				bodyStart = start + pos + len(line) + 1
+			}
+			return start, start + pos, bodyStart, true
+		}
+		if !more {
+			break
+		}
+		pos += len(line) + 1
+	}
+	return 0, 0, 0, false
+}
+
+// Parse 解析 front matter；没有 front matter 时返回 nil 元数据与原文。
+func Parse(content string) (yaml.MapSlice, string, error) {
+	raw, body, ok := Split(content)
+	if !ok {
+		return nil, content, nil
+	}
+	var meta yaml.MapSlice
+	if strings.TrimSpace(raw) != "" {
+		if err := yaml.Unmarshal([]byte(raw), &meta); err != nil {
+			return nil, content, err
+		}
+	}
+	return meta, body, nil
+}
+
+// Field 是要写入 front matter 的一个顶层键
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Patch 把 fields 写入 content 的 front matter，只改动这些键所在的行：
+// 已有的顶层键原位替换其值（连同值的后续缩进行），没有的键追加在末尾；
+// 其余内容（注释、键顺序、引号与缩进风格）原样保留。content 没有 front matter 时新建一个。
+// 原有 front matter 不是合法 YAML 时返回错误，不做修改。
+func Patch(content string, fields ...Field) (string, error) {
+	start, end, _, ok := bounds(content)
+	if !ok {
+		return Prepend(content, fields...)
+	}
+	raw := content[start:end]
+	var probe yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(raw), &probe); err != nil {
+		return "", err
+	}
+
+	eol := "\n"
+	if strings.Contains(raw, "\r\n") {
+		eol = "\r\n"
+	}
+	lines := strings.SplitAfter(raw, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, f := range fields {
+		line, err := fieldLine(f)
+		if err != nil {
+			return "", err
+		}
+		line += eol
+		i := keyLine(lines, f.Key)
+		if i < 0 {
+			lines = append(lines, line)
+			continue
+		}
+		// 值占用的行：键所在行之后的缩进行、空行与顶格的序列项（"- a"）
+		j := i + 1
+		for j < len(lines) && isContinuation(lines[j]) {
+			j++
+		}
+		// 值之后的空行归属下一个键，保持原样
+		for j > i+1 && strings.TrimSpace(lines[j-1]) == "" {
+			j--
+		}
+		lines = append(lines[:i], append([]string{line}, lines[j:]...)...)
+	}
+	return content[:start] + strings.Join(lines, "") + content[end:], nil
+}
+
+// Prepend 用 fields 生成新的 front matter 放在 body 前
+func Prepend(body string, fields ...Field) (string, error) {
+	if len(fields) == 0 {
+		return body, nil
+	}
+	var b strings.Builder
+	b.WriteString(delimiter + "\n")
+	for _, f := range fields {
+		line, err := fieldLine(f)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString(delimiter + "\n")
+	return b.String() + body, nil
+}
+
+// fieldLine 把一个键值编码为单行 YAML（序列与映射用流式写法）
+func fieldLine(f Field) (string, error) {
+	key, err := yaml.Marshal(f.Key)
+	if err != nil {
+		return "", err
+	}
+	val, err := yaml.MarshalWithOptions(f.Value, yaml.Flow(true))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(key)) + ": " + strings.TrimSpace(string(val)), nil
+}
+
+// keyLine 返回顶层键 key 所在行的下标，没有时返回 -1；键可带单双引号
+func keyLine(lines []string, key string) int {
+	for i, line := range lines {
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		for _, k := range []string{key, `"` + key + `"`, "'" + key + "'"} {
+			rest, ok := strings.CutPrefix(line, k)
+			if !ok {
+				continue
+			}
+			rest = strings.TrimLeft(rest, " \t")
+			if strings.HasPrefix(rest, ":") && (len(rest) == 1 || strings.ContainsRune(" \t\r\n", rune(rest[1]))) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isContinuation 判断某行是否属于上一个键的值
+func isContinuation(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	return line[0] == ' ' || line[0] == '\t' || line == "-" || strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "-\r")
+}
+
+// Get 按键名取值
+func Get(meta yaml.MapSlice, key string) (any, bool) {
+	for _, item := range meta {
+		if k, ok := item.Key.(string); ok && k == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Strings 把 YAML 值转为字符串列表：支持序列与逗号分隔的单个字符串（tags: a, b）
+func Strings(v any) []string {
+	var out []string
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	switch val := v.(type) {
+	case []any:
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				add(s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(val, ",") {
+			add(s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package frontmatter
+
+import "testing"
+
+func TestPatch(t *testing.T) {
+	cases := []struct {
+		name, src string
+		fields    []Field
+		want      string
+	}{
+		{
+			"保留注释顺序与引号",
+			"---\n# 说明\nauthor: 'me'\ntags:\n  - a\n  - b\n\n\"title\": Old # 旧\nextra: 1\n---\n正文\n",
+			[]Field{{"tags", []string{"x", "y"}}, {"title", "新 标题"}},
+			"---\n# 说明\nauthor: 'me'\ntags: [x, \"y\"]\n\ntitle: 新 标题\nextra: 1\n---\n正文\n",
+		},
+		{
+			"顶格序列与追加新键",
+			"---\r\ntags:\r\n- a\r\n# 尾注\r\n---\r\nbody",
+			[]Field{{"tags", []string{}}, {"updated_at", "2024-01-01T00:00:00Z"}},
+			"---\r\ntags: []\r\n# 尾注\r\nupdated_at: \"2024-01-01T00:00:00Z\"\r\n---\r\nbody",
+		},
+		{
+			"没有 front matter",
+			"# 标题\n",
+			[]Field{{"title", "a: b"}},
+			"---\ntitle: \"a: b\"\n---\n# 标题\n",
+		},
+	}
+	for _, c := range cases {
+		got, err := Patch(c.src, c.fields...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: 得到\n%q\n期望\n%q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := Patch("---\na: [\n---\n", Field{"title", "x"}); err == nil {
+		t.Error("非法 YAML 应返回错误")
+	}
+}
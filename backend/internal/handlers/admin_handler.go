@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/config"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// AdminHandler 管理接口，路由须挂在 middleware.RequireAdmin 之后
+type AdminHandler struct {
+	db       *sql.DB
+	store    storage.Storage
+	uploadGC config.UploadGCConfig
+}
+
+func NewAdminHandler(db *sql.DB, store storage.Storage, uploadGC config.UploadGCConfig) *AdminHandler {
+	return &AdminHandler{db: db, store: store, uploadGC: uploadGC}
+}
+
+// CollectUploads 立即清理孤儿上传文件：POST /api/admin/uploads/gc?dry_run=true
+// dry_run 时只返回将要隔离、恢复与删除的文件，不做修改；另一次清理正在进行时返回 409
+func (h *AdminHandler) CollectUploads(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	report, err := collectUploads(c.Request.Context(), h.db, h.store, uploadGCGrace(h.uploadGC), dryRun)
+	if errors.Is(err, errUploadGCRunning) {
+		api.Error(c, http.StatusConflict, "清理正在进行中，请稍后再试")
+		return
+	}
+	if err != nil {
+		log.Printf("清理孤儿上传文件失败: %v", err)
+		api.Error(c, http.StatusInternalServerError, "清理孤儿上传文件失败")
+		return
+	}
+	api.Success(c, report)
+}
@@ -0,0 +1,732 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/imaging"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// 附件类型
+const (
+	attachmentImage    = "image"
+	attachmentPDF      = "pdf"
+	attachmentDocument = "document"
+	attachmentArchive  = "archive"
+	attachmentAudio    = "audio"
+	attachmentVideo    = "video"
+)
+
+// attachmentPolicy 是一类附件的上传策略
+type attachmentPolicy struct {
+	Kind    string
+	Exts    map[string]bool
+	MaxSize int64
+	Sniff   []string // http.DetectContentType 的结果须以其一开头；为空时不校验文件内容
+	Subdir  string   // 存储中的存放目录（对象键前缀）
+}
+
+// attachmentPolicies 按类型列出允许上传的扩展名与大小上限。
+// 不接受 html、svg 等浏览器会当作页面执行的类型：/uploads 以静态文件直接提供
+var attachmentPolicies = []attachmentPolicy{
+	{Kind: attachmentImage, Exts: imageExts, MaxSize: 10 << 20, Sniff: []string{"image/"}, Subdir: imagesSubdir},
+	{Kind: attachmentPDF, Exts: map[string]bool{".pdf": true}, MaxSize: 50 << 20, Sniff: []string{"application/pdf"}, Subdir: filesSubdir},
+	{Kind: attachmentDocument, Exts: map[string]bool{
+		".txt": true, ".md": true, ".csv": true, ".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".odp": true,
+	}, MaxSize: 20 << 20, Subdir: filesSubdir},
+	{Kind: attachmentArchive, Exts: map[string]bool{
+		".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".7z": true, ".rar": true,
+	}, MaxSize: 100 << 20, Subdir: filesSubdir},
+	{Kind: attachmentAudio, Exts: map[string]bool{
+		".mp3": true, ".wav": true, ".ogg": true, ".m4a": true, ".flac": true, ".aac": true,
+	}, MaxSize: 50 << 20, Subdir: filesSubdir},
+	{Kind: attachmentVideo, Exts: map[string]bool{".mp4": true, ".webm": true, ".mov": true}, MaxSize: 200 << 20, Subdir: filesSubdir},
+}
+
+// attachmentPolicyFor 按扩展名查找上传策略
+func attachmentPolicyFor(ext string) (attachmentPolicy, bool) {
+	for _, p := range attachmentPolicies {
+		if p.Exts[ext] {
+			return p, true
+		}
+	}
+	return attachmentPolicy{}, false
+}
+
+// attachmentLinkRe 匹配文档中指向本站上传文件的链接，捕获相对 uploads 的路径
+var attachmentLinkRe = regexp.MustCompile(`/uploads/((?:` + imagesSubdir + `|` + filesSubdir + `)/[A-Za-z0-9._-]+)`)
+
+// attachmentColumns 是 scanAttachment 读取的列（表别名 a）
+const attachmentColumns = "a.id, a.user_id, a.filename, a.storage_path, a.kind, a.mime_type, a.size, a.created_at"
+
+// attachmentSortFields 是附件列表可用的排序字段
+var attachmentSortFields = map[string]sortField{
+	"created_at": {Column: "a.created_at", Kind: sortTime},
+	"filename":   {Column: "a.filename", Kind: sortString},
+	"size":       {Column: "a.size", Kind: sortInt},
+}
+
+// scanAttachment 读取 attachmentColumns 一行并填充 URL 与 Markdown
+func scanAttachment(row interface{ Scan(...interface{}) error }) (models.Attachment, error) {
+	var a models.Attachment
+	err := row.Scan(&a.ID, &a.UserID, &a.Filename, &a.StoragePath, &a.Kind, &a.MimeType, &a.Size, &a.CreatedAt)
+	if err == nil {
+		fillAttachment(&a)
+	}
+	return a, err
+}
+
+// fillAttachment 由存放路径生成访问 URL 与可插入文档的 Markdown
+func fillAttachment(a *models.Attachment) {
+	a.URL = "/uploads/" + a.StoragePath
+	if a.Kind == attachmentImage {
+		a.Markdown = "![](" + a.URL + ")"
+		return
+	}
+	label := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(a.Filename)
+	a.Markdown = "[" + label + "](" + a.URL + ")"
+}
+
+// mimeByExt 按扩展名推断 MIME 类型，未知时用 fallback
+func mimeByExt(ext, fallback string) string {
+	if t := mime.TypeByExtension(ext); t != "" {
+		if mt, _, err := mime.ParseMediaType(t); err == nil {
+			return mt
+		}
+	}
+	if fallback == "" {
+		return "application/octet-stream"
+	}
+	return fallback
+}
+
+// attachmentFilename 清理上传时的原始文件名：去掉目录部分并截断到 255 个字符
+func attachmentFilename(name, kind, ext string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		name = kind + ext
+	}
+	return truncateTitle(name)
+}
+
+// execer 是 *sql.DB 与 *sql.Tx 共有的写入方法
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAttachment 写入附件记录并回填 ID、URL 与 Markdown；a.StoragePath 为对象键
+func insertAttachment(db execer, a *models.Attachment) error {
+	result, err := db.Exec(
+		"INSERT INTO attachments (user_id, filename, storage_path, kind, mime_type, size) VALUES (?, ?, ?, ?, ?, ?)",
+		a.UserID, a.Filename, a.StoragePath, a.Kind, a.MimeType, a.Size,
+	)
+	if err != nil {
+		return err
+	}
+	a.ID, _ = result.LastInsertId()
+	fillAttachment(a)
+	return nil
+}
+
+// acquireBlob 在 tx 中为对象 key 增加一次引用，created 为 true 表示新建了引用计数行（此前没有任何引用）。
+// 该行的锁持续到事务结束，同一对象的写入与删除因此串行执行
+func acquireBlob(tx *sql.Tx, key string, size int64) (created bool, err error) {
+	result, err := tx.Exec(
+		"INSERT INTO upload_blobs (storage_path, size, ref_count) VALUES (?, ?, 1) ON DUPLICATE KEY UPDATE ref_count = ref_count + 1",
+		key, size,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil // ON DUPLICATE KEY 更新已有行时为 2
+}
+
+// storeAttachment 按内容寻址保存 r 并写入附件记录 a（回填 StoragePath、Size 与 ID）：对象键为 <subdir>/<SHA-256><ext>，
+// 相同内容只存一份，upload_blobs.ref_count 记录引用它的附件数。stored 为 true 表示本次写入了新对象，调用方据此生成缩小尺寸
+func storeAttachment(ctx context.Context, db *sql.DB, store storage.Storage, a *models.Attachment, r io.ReadSeeker, subdir, ext string) (stored bool, err error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return false, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	a.StoragePath = storage.HashKey(subdir, hash.Sum(nil), ext)
+	a.Size = size
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	created, err := acquireBlob(tx, a.StoragePath, size)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	// 失败时只删除本次新建、别无引用的对象；已有引用的对象即使刚被本次重写也保留
+	fail := func(err error) (bool, error) {
+		if stored && created {
+			_ = store.Delete(ctx, a.StoragePath)
+		}
+		tx.Rollback()
+		return false, err
+	}
+	info, err := store.Stat(ctx, a.StoragePath)
+	if errors.Is(err, storage.ErrNotExist) || (err == nil && info.Size != size) { // 大小不符：上次写入不完整
+		if err := store.Put(ctx, a.StoragePath, r, size); err != nil {
+			return fail(err)
+		}
+		stored = true
+	} else if err != nil {
+		return fail(err)
+	}
+	if err := insertAttachment(tx, a); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err // 提交结果不确定，保留对象；确实没有引用时由孤儿文件清理回收
+	}
+	return stored, nil
+}
+
+// referenceAttachment 为已存在的对象 a.StoragePath 新建一条附件记录并增加引用数，不复制文件；对象不存在时返回 storage.ErrNotExist
+func referenceAttachment(ctx context.Context, db *sql.DB, store storage.Storage, a *models.Attachment) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := acquireBlob(tx, a.StoragePath, a.Size); err != nil {
+		tx.Rollback()
+		return err
+	}
+	info, err := store.Stat(ctx, a.StoragePath)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	a.Size = info.Size
+	if err := insertAttachment(tx, a); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteAttachments 删除附件记录与关联，并减少所引用对象的引用数；降为 0 的对象在事务提交后由 removeBlob 删除，
+// 事务失败时不会留下指向已删除文件的附件记录
+func deleteAttachments(ctx context.Context, db *sql.DB, store storage.Storage, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders, args := idPlaceholders(ids)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// 本次删除的附件对每个对象的引用数，按键排序后逐个加锁，并发删除不会死锁
+	released := make(map[string]int)
+	var keys []string
+	rows, err := tx.Query("SELECT storage_path, COUNT(*) FROM attachments WHERE id IN ("+placeholders+") GROUP BY storage_path ORDER BY storage_path", args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		released[key] = n
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var orphaned []string
+	for _, key := range keys {
+		var refs int
+		err := tx.QueryRow("SELECT ref_count FROM upload_blobs WHERE storage_path = ? FOR UPDATE", key).Scan(&refs)
+		if err == sql.ErrNoRows {
+			continue // 没有引用计数的对象不删除，交给孤儿文件清理
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if refs > released[key] {
+			_, err = tx.Exec("UPDATE upload_blobs SET ref_count = ref_count - ? WHERE storage_path = ?", released[key], key)
+		} else {
+			// 保留引用数为 0 的行，提交后 removeBlob 锁住它再删除对象
+			_, err = tx.Exec("UPDATE upload_blobs SET ref_count = 0 WHERE storage_path = ?", key)
+			orphaned = append(orphaned, key)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		"DELETE FROM document_attachments WHERE attachment_id IN (" + placeholders + ")",
+		"DELETE FROM attachments WHERE id IN (" + placeholders + ")",
+	} {
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, key := range orphaned {
+		if err := removeBlob(ctx, db, store, key); err != nil {
+			log.Printf("删除附件文件失败 %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// removeBlob 删除引用数已降为 0 的对象及其引用计数行（图片连同缩小尺寸）。先锁住引用计数行：
+// 期间有相同内容的上传增加了引用时保留对象；失败时留下的行与文件由孤儿文件清理回收
+func removeBlob(ctx context.Context, db *sql.DB, store storage.Storage, key string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var refs int
+	err = tx.QueryRow("SELECT ref_count FROM upload_blobs WHERE storage_path = ? FOR UPDATE", key).Scan(&refs)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil || refs > 0 {
+		return err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if path.Dir(key) == imagesSubdir {
+		removeImageVariants(ctx, store, path.Base(key))
+	}
+	if _, err := tx.Exec("DELETE FROM upload_blobs WHERE storage_path = ?", key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// linkContentAttachments 把文档内容中引用的附件关联到文档；只增加关联，不因内容删掉链接而解除。
+// 相同内容的文件只存一份，同一路径可能对应多人的附件，只关联文档作者与被共享用户的附件。
+// 失败只记日志，不影响保存结果
+func (h *DocumentHandler) linkContentAttachments(docID int64, content string) {
+	seen := make(map[string]bool)
+	var paths []interface{}
+	for _, m := range attachmentLinkRe.FindAllStringSubmatch(content, maxLinksPerDocument) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			paths = append(paths, m[1])
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(paths)), ",")
+	if _, err := h.db.Exec(`
+		INSERT IGNORE INTO document_attachments (document_id, attachment_id)
+		SELECT d.id, a.id FROM documents d
+		JOIN attachments a ON a.user_id = d.user_id OR a.user_id IN (SELECT user_id FROM document_shares WHERE document_id = d.id)
+		WHERE d.id = ? AND a.storage_path IN (`+placeholders+")",
+		append([]interface{}{docID}, paths...)...,
+	); err != nil {
+		log.Printf("关联文档附件失败 doc=%d: %v", docID, err)
+	}
+}
+
+// receiveAttachment 校验并保存表单 file 字段上传的文件，创建附件记录；onlyKind 非空时只接受该类型。
+// 表单可选 document_id：当前用户须为文档作者或 editor，保存后关联到该文档。出错时已写入错误响应
+func (h *DocumentHandler) receiveAttachment(c *gin.Context, userID int64, onlyKind string) (*models.Attachment, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "请选择要上传的文件")
+		return nil, false
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext == "" && onlyKind == attachmentImage {
+		ext = ".png" // 粘贴的截图通常没有扩展名
+	}
+	policy, ok := attachmentPolicyFor(ext)
+	if !ok || (onlyKind != "" && policy.Kind != onlyKind) {
+		if onlyKind == attachmentImage {
+			api.Error(c, http.StatusBadRequest, "不支持的图片格式")
+		} else {
+			api.Error(c, http.StatusBadRequest, "不支持的文件类型")
+		}
+		return nil, false
+	}
+	if file.Size > policy.MaxSize {
+		api.Error(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s 文件不能超过 %d MB", ext, policy.MaxSize>>20))
+		return nil, false
+	}
+
+	var docID int64
+	if raw := c.PostForm("document_id"); raw != "" {
+		docID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || docID <= 0 {
+			api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+			return nil, false
+		}
+		if _, ok := h.requireRole(c, docID, userID, roleEditor); !ok {
+			return nil, false
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "保存文件失败")
+		return nil, false
+	}
+	defer src.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		api.Error(c, http.StatusInternalServerError, "保存文件失败")
+		return nil, false
+	}
+	head = head[:n]
+	sniffed := http.DetectContentType(head)
+	if len(policy.Sniff) > 0 {
+		matched := false
+		for _, prefix := range policy.Sniff {
+			matched = matched || strings.HasPrefix(sniffed, prefix)
+		}
+		if !matched {
+			api.Error(c, http.StatusBadRequest, "文件内容与扩展名 "+ext+" 不符")
+			return nil, false
+		}
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		api.Error(c, http.StatusInternalServerError, "保存文件失败")
+		return nil, false
+	}
+	var body io.ReadSeeker = src
+	var img image.Image
+	if policy.Kind == attachmentImage {
+		// 图片解码后重新编码，去掉 EXIF 等元数据；扩展名以实际格式为准
+		data, err := io.ReadAll(io.LimitReader(src, policy.MaxSize))
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "保存文件失败")
+			return nil, false
+		}
+		res, err := imaging.Process(data)
+		if err == imaging.ErrTooLarge {
+			api.Error(c, http.StatusBadRequest, fmt.Sprintf("图片不能超过 %d 万像素", imaging.MaxPixels/10000))
+			return nil, false
+		}
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "无法解析图片")
+			return nil, false
+		}
+		body, ext, img = bytes.NewReader(res.Data), res.Ext, res.Img
+	}
+
+	if mt, _, err := mime.ParseMediaType(sniffed); err == nil {
+		sniffed = mt
+	}
+	a := &models.Attachment{
+		UserID:   userID,
+		Filename: attachmentFilename(file.Filename, policy.Kind, ext),
+		Kind:     policy.Kind,
+		MimeType: mimeByExt(ext, sniffed),
+	}
+	ctx := c.Request.Context()
+	stored, err := storeAttachment(ctx, h.db, h.store, a, body, policy.Subdir, ext)
+	if err != nil {
+		log.Printf("保存上传文件失败: %v", err)
+		api.Error(c, http.StatusInternalServerError, "保存文件失败")
+		return nil, false
+	}
+	if stored && img != nil {
+		writeImageVariants(ctx, h.store, path.Base(a.StoragePath), img)
+	}
+	a.CreatedAt = time.Now().UTC()
+	if docID != 0 {
+		if _, err := h.db.Exec("INSERT IGNORE INTO document_attachments (document_id, attachment_id) VALUES (?, ?)", docID, a.ID); err != nil {
+			log.Printf("关联附件失败 doc=%d attachment=%d: %v", docID, a.ID, err)
+		} else {
+			a.DocumentIDs = []int64{docID}
+		}
+	}
+	return a, true
+}
+
+// loadAttachment 读取当前用户的附件；不存在或不属于该用户时已写入 404
+func (h *DocumentHandler) loadAttachment(c *gin.Context, userID int64) (models.Attachment, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的附件 ID")
+		return models.Attachment{}, false
+	}
+	a, err := scanAttachment(h.db.QueryRow("SELECT "+attachmentColumns+" FROM attachments a WHERE a.id = ? AND a.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "附件不存在")
+		return a, false
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取附件失败")
+		return a, false
+	}
+	return a, true
+}
+
+// UploadAttachment 上传附件：POST /api/attachments，multipart 表单 file 为文件，可选 document_id 关联到文档。
+// 按扩展名匹配 attachmentPolicies 的类型与大小上限，图片与 PDF 还会校验文件内容；
+// 图片经 imaging.Process 去掉元数据并生成缩小尺寸。返回附件及可插入文档的 markdown
+func (h *DocumentHandler) UploadAttachment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	a, ok := h.receiveAttachment(c, userID, "")
+	if !ok {
+		return
+	}
+	api.Success(c, a)
+}
+
+// ListAttachments 当前用户的附件列表：GET /api/attachments，按列表约定分页排序（见 parseListQuery），默认按上传时间倒序。
+// 筛选：kind 类型；document_id 只列关联到该文档的附件；created_after / created_before 上传时间范围
+func (h *DocumentHandler) ListAttachments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	lq, ok := parseListQuery(c, attachmentSortFields, "created_at", "a.id")
+	if !ok {
+		return
+	}
+	createdWhere, createdArgs, ok := timeRangeFilter(c, "created", "a.created_at")
+	if !ok {
+		return
+	}
+	where := "a.user_id = ?" + createdWhere
+	args := append([]interface{}{userID}, createdArgs...)
+	if kind := c.Query("kind"); kind != "" {
+		where += " AND a.kind = ?"
+		args = append(args, kind)
+	}
+	if raw := c.Query("document_id"); raw != "" {
+		docID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+			return
+		}
+		where += " AND a.id IN (SELECT attachment_id FROM document_attachments WHERE document_id = ?)"
+		args = append(args, docID)
+	}
+	cursorWhere, cursorArgs := lq.where()
+	tail, tailArgs := lq.orderLimit()
+
+	rows, err := h.db.Query(
+		"SELECT "+attachmentColumns+" FROM attachments a WHERE "+where+cursorWhere+tail,
+		append(append(args, cursorArgs...), tailArgs...)...,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取附件列表失败")
+		return
+	}
+	defer rows.Close()
+
+	var list []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, a)
+	}
+
+	api.Success(c, pageOf(lq, list, func(a models.Attachment) (interface{}, int64) {
+		switch lq.Sort {
+		case "filename":
+			return a.Filename, a.ID
+		case "size":
+			return a.Size, a.ID
+		}
+		return a.CreatedAt, a.ID
+	}))
+}
+
+// GetAttachment 附件详情：GET /api/attachments/:id，document_ids 为关联的文档（不含回收站中的）
+func (h *DocumentHandler) GetAttachment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	a, ok := h.loadAttachment(c, userID)
+	if !ok {
+		return
+	}
+	ids, err := queryIDs(h.db, `
+		SELECT da.document_id FROM document_attachments da
+		INNER JOIN documents d ON d.id = da.document_id AND d.deleted_at IS NULL
+		WHERE da.attachment_id = ? ORDER BY da.document_id`, a.ID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取附件失败")
+		return
+	}
+	a.DocumentIDs = ids
+	if a.DocumentIDs == nil {
+		a.DocumentIDs = []int64{}
+	}
+	api.Success(c, a)
+}
+
+// DeleteAttachment 删除附件：DELETE /api/attachments/:id，连同所有文档关联；没有其他附件引用同一内容时一并删除文件。
+// 文档内容中的链接不会改写，文件删除后将无法访问；unlinked 为解除关联的文档数
+func (h *DocumentHandler) DeleteAttachment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	a, ok := h.loadAttachment(c, userID)
+	if !ok {
+		return
+	}
+	var unlinked int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM document_attachments WHERE attachment_id = ?", a.ID).Scan(&unlinked); err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除附件失败")
+		return
+	}
+	if err := deleteAttachments(c.Request.Context(), h.db, h.store, []int64{a.ID}); err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除附件失败")
+		return
+	}
+	api.Success(c, gin.H{"message": "已删除", "unlinked": unlinked})
+}
+
+// LinkAttachment 关联附件与文档：POST /api/attachments/:id/documents，body 为 document_id；
+// 附件须属于当前用户，且当前用户为文档作者或 editor。已关联时直接返回成功
+func (h *DocumentHandler) LinkAttachment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	a, ok := h.loadAttachment(c, userID)
+	if !ok {
+		return
+	}
+	var req models.AttachmentLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	if _, ok := h.requireRole(c, req.DocumentID, userID, roleEditor); !ok {
+		return
+	}
+	if _, err := h.db.Exec("INSERT IGNORE INTO document_attachments (document_id, attachment_id) VALUES (?, ?)", req.DocumentID, a.ID); err != nil {
+		api.Error(c, http.StatusInternalServerError, "关联附件失败")
+		return
+	}
+	api.Success(c, gin.H{"attachment_id": a.ID, "document_id": req.DocumentID})
+}
+
+// UnlinkAttachment 解除附件与文档的关联：DELETE /api/attachments/:id/documents/:docId，
+// 附件上传者或文档作者、editor 均可操作；不删除附件本身
+func (h *DocumentHandler) UnlinkAttachment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的附件 ID")
+		return
+	}
+	docID, err := strconv.ParseInt(c.Param("docId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	var owner int64
+	err = h.db.QueryRow("SELECT user_id FROM attachments WHERE id = ?", id).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		api.Error(c, http.StatusInternalServerError, "解除关联失败")
+		return
+	}
+	if err == sql.ErrNoRows || owner != userID {
+		if _, ok := h.requireRole(c, docID, userID, roleEditor); !ok {
+			return
+		}
+	}
+	result, err := h.db.Exec("DELETE FROM document_attachments WHERE document_id = ? AND attachment_id = ?", docID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "解除关联失败")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		api.Error(c, http.StatusNotFound, "附件未关联到该文档")
+		return
+	}
+	api.Success(c, gin.H{"message": "已解除关联"})
+}
+
+// ListDocumentAttachments 文档关联的附件：GET /api/documents/:id/attachments，有查看权限即可，按上传时间正序
+func (h *DocumentHandler) ListDocumentAttachments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if _, ok := h.requireRole(c, docID, userID, roleViewer); !ok {
+		return
+	}
+	rows, err := h.db.Query(`
+		SELECT `+attachmentColumns+` FROM attachments a
+		INNER JOIN document_attachments da ON da.attachment_id = a.id
+		WHERE da.document_id = ? ORDER BY a.created_at, a.id`, docID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取附件列表失败")
+		return
+	}
+	defer rows.Close()
+	list := []models.Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, a)
+	}
+	api.Success(c, gin.H{"list": list})
+}
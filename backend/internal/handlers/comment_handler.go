@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// commentMaxLen 是评论内容的最大长度（字符）
+const commentMaxLen = 2000
+
+// ListComments 文档评论，按发表先后排列：GET /api/documents/:id/comments，作者与被授权用户可用
+func (h *DocumentHandler) ListComments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if _, ok := h.requireRole(c, id, userID, roleViewer); !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT c.id, c.document_id, c.user_id, COALESCE(u.username, ''), c.content, c.created_at
+		FROM document_comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE c.document_id = ?
+		ORDER BY c.id
+	`, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取评论失败")
+		return
+	}
+	defer rows.Close()
+	comments := []models.DocumentComment{}
+	for rows.Next() {
+		var cm models.DocumentComment
+		if err := rows.Scan(&cm.ID, &cm.DocumentID, &cm.UserID, &cm.Username, &cm.Content, &cm.CreatedAt); err != nil {
+			continue
+		}
+		comments = append(comments, cm)
+	}
+
+	api.Success(c, gin.H{"comments": comments})
+}
+
+// CreateComment 发表评论：POST /api/documents/:id/comments，作者与 commenter、editor 可用，viewer 返回 403。
+// 评论不改动文档内容，不受编辑锁限制
+func (h *DocumentHandler) CreateComment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" || utf8.RuneCountInString(content) > commentMaxLen {
+		api.Error(c, http.StatusBadRequest, "评论内容不能为空，且不超过 "+strconv.Itoa(commentMaxLen)+" 个字符")
+		return
+	}
+	if _, ok := h.requireRole(c, id, userID, roleCommenter); !ok {
+		return
+	}
+
+	result, err := h.db.Exec("INSERT INTO document_comments (document_id, user_id, content) VALUES (?, ?, ?)", id, userID, content)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "发表评论失败")
+		return
+	}
+	cm := models.DocumentComment{DocumentID: id, UserID: userID, Username: c.GetString("username"), Content: content, CreatedAt: time.Now()}
+	cm.ID, _ = result.LastInsertId()
+
+	api.Success(c, cm)
+}
+
+// DeleteComment 删除评论：DELETE /api/documents/:id/comments/:commentId，评论者本人（仍有访问权限时）与文档作者可用
+func (h *DocumentHandler) DeleteComment(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	commentID, err := strconv.ParseInt(c.Param("commentId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的评论 ID")
+		return
+	}
+	role, ok := h.requireRole(c, id, userID, roleViewer)
+	if !ok {
+		return
+	}
+
+	var authorID int64
+	err = h.db.QueryRow("SELECT user_id FROM document_comments WHERE id = ? AND document_id = ?", commentID, id).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "评论不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除评论失败")
+		return
+	}
+	if authorID != userID && role != roleOwner {
+		api.Error(c, http.StatusForbidden, "只能删除自己的评论")
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM document_comments WHERE id = ?", commentID); err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除评论失败")
+		return
+	}
+
+	api.Success(c, gin.H{"message": "评论已删除"})
+}
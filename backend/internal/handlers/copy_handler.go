@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// titleMaxLen 是 documents.title 的最大字符数
+const titleMaxLen = 255
+
+// copySource 是被复制的文档
+type copySource struct {
+	ID       int64
+	UserID   int64
+	FolderID *int64
+	Title    string
+	Content  string
+	Author   string
+}
+
+// adoptDocumentImages 把文档内容引用的上传图片登记为 userID 的附件，文件名与 MIME 沿用原附件（原图没有附件记录时按文件推断）。
+// 相同内容只存一份，不复制文件，只增加引用数：删除任一方的附件都不影响另一方。图片文件已不存在时跳过。
+// 返回新附件 ID；失败时已删除本次写入的记录
+func (h *DocumentHandler) adoptDocumentImages(ctx context.Context, userID int64, content string) ([]int64, error) {
+	var ids []int64
+	seen := make(map[string]bool)
+	for _, m := range uploadImageRe.FindAllStringSubmatch(content, -1) {
+		name := m[1]
+		if seen[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		seen[name] = true
+		a := models.Attachment{
+			UserID:      userID,
+			Filename:    name,
+			Kind:        attachmentImage,
+			MimeType:    mimeByExt(strings.ToLower(path.Ext(name)), ""),
+			StoragePath: imagesSubdir + "/" + name,
+		}
+		err := h.db.QueryRow(
+			"SELECT filename, mime_type FROM attachments WHERE storage_path = ? LIMIT 1", a.StoragePath,
+		).Scan(&a.Filename, &a.MimeType)
+		if err == nil || err == sql.ErrNoRows {
+			err = referenceAttachment(ctx, h.db, h.store, &a)
+		}
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			deleteAttachments(ctx, h.db, h.store, ids)
+			return nil, err
+		}
+		ids = append(ids, a.ID)
+	}
+	return ids, nil
+}
+
+// truncateTitle 把标题截断到 titleMaxLen 个字符
+func truncateTitle(title string) string {
+	if utf8.RuneCountInString(title) <= titleMaxLen {
+		return title
+	}
+	return string([]rune(title)[:titleMaxLen])
+}
+
+// loadCopySource 读取未删除的文档；where 为附加条件
+func (h *DocumentHandler) loadCopySource(id int64, where string) (copySource, error) {
+	var src copySource
+	err := h.db.QueryRow(`
+		SELECT d.id, d.user_id, d.folder_id, d.title, d.content, COALESCE(u.username, '')
+		FROM documents d
+		LEFT JOIN users u ON u.id = d.user_id
+		WHERE d.id = ? AND d.deleted_at IS NULL`+where, id,
+	).Scan(&src.ID, &src.UserID, &src.FolderID, &src.Title, &src.Content, &src.Author)
+	return src, err
+}
+
+// copyDocument 为 userID 新建 src 的副本：引用的图片登记为 userID 的附件后经 createDocument 保存（记录首条修订，
+// 并由 afterSave 关联附件）；fork 为 true 时记录来源与原作者
+func (h *DocumentHandler) copyDocument(ctx context.Context, userID int64, folderID *int64, title string, src copySource, fork bool) (savedDocument, error) {
+	attachmentIDs, err := h.adoptDocumentImages(ctx, userID, src.Content)
+	if err != nil {
+		return savedDocument{}, err
+	}
+	saved, err := h.createDocument(userID, folderID, truncateTitle(title), src.Content)
+	if err != nil {
+		deleteAttachments(ctx, h.db, h.store, attachmentIDs)
+		return saved, err
+	}
+
+	if fork {
+		if _, err := h.db.Exec(
+			"UPDATE documents SET forked_from_id = ?, forked_from_user_id = ?, forked_from_title = ? WHERE id = ?",
+			src.ID, src.UserID, src.Title, saved.ID,
+		); err != nil {
+			log.Printf("记录复刻来源失败 doc=%d: %v", saved.ID, err)
+		}
+	}
+	return saved, nil
+}
+
+// copyTarget 解析复制请求；folder_id 为 0 表示根目录，省略时取 defaultFolder。参数无效时已写入错误响应
+func (h *DocumentHandler) copyTarget(c *gin.Context, userID int64, defaultFolder *int64) (models.CopyDocumentRequest, *int64, bool) {
+	var req models.CopyDocumentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+			return req, nil, false
+		}
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	folderID := defaultFolder
+	if req.FolderID != nil {
+		folderID = nil
+		if *req.FolderID != 0 {
+			folderID = req.FolderID
+		}
+	}
+	if !checkTargetFolder(c, h.db, userID, folderID) {
+		return req, nil, false
+	}
+	return req, folderID, true
+}
+
+// DuplicateDocument 复制文档：POST /api/documents/:id/duplicate，作者与被授权用户均可用，副本属于当前用户。
+// body 可选 title（默认「原标题 副本」）与 folder_id。作者复制时副本默认放在原文件夹并带上原文档的标签。
+// 引用的上传图片登记为当前用户的附件（相同内容只存一份），删除任一份都不影响另一份
+func (h *DocumentHandler) DuplicateDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	role, ok := h.requireRole(c, id, userID, roleViewer)
+	if !ok {
+		return
+	}
+
+	src, err := h.loadCopySource(id, "")
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "文档不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+	var defaultFolder *int64
+	if role == roleOwner {
+		defaultFolder = src.FolderID
+	}
+	req, folderID, ok := h.copyTarget(c, userID, defaultFolder)
+	if !ok {
+		return
+	}
+	title := req.Title
+	if title == "" {
+		title = src.Title + " 副本"
+	}
+
+	saved, err := h.copyDocument(c.Request.Context(), userID, folderID, title, src, false)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "复制文档失败")
+		return
+	}
+	if role == roleOwner {
+		tagIDs, err := queryIDs(h.db, "SELECT tag_id FROM document_tags WHERE document_id = ?", id)
+		if err == nil {
+			err = h.tagDocument(userID, saved.ID, tagIDs)
+		}
+		if err != nil {
+			log.Printf("复制文档标签失败 doc=%d: %v", saved.ID, err)
+		}
+	}
+
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, gin.H{
+		"id":        saved.ID,
+		"title":     saved.Title,
+		"filename":  saved.Filename,
+		"file_size": saved.FileSize,
+		"folder_id": folderID,
+		"version":   saved.Version,
+	})
+}
+
+// ForkPost 复刻社区贴文：POST /api/posts/:id/fork，把 public 文档（按数字 id）或 unlisted 文档（按链接令牌）
+// 复制为当前用户的私有文档。
+// body 同 DuplicateDocument（title 默认沿用原标题，folder_id 默认根目录）；图片同样登记为自己的附件，标签不复制。
+// 副本记录来源文档与原作者，GetDocument 以 forked_from 返回署名
+func (h *DocumentHandler) ForkPost(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	ref, ok := parsePostRef(c)
+	if !ok {
+		return
+	}
+
+	var src copySource
+	id, err := resolvePost(h.db, ref)
+	if err == nil {
+		src, err = h.loadCopySource(id, " AND d.visibility IN ('public', 'unlisted')")
+	}
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "贴文不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取贴文失败")
+		return
+	}
+	req, folderID, ok := h.copyTarget(c, userID, nil)
+	if !ok {
+		return
+	}
+	title := req.Title
+	if title == "" {
+		title = src.Title
+	}
+
+	saved, err := h.copyDocument(c.Request.Context(), userID, folderID, title, src, true)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "复刻贴文失败")
+		return
+	}
+
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, gin.H{
+		"id":        saved.ID,
+		"title":     saved.Title,
+		"filename":  saved.Filename,
+		"file_size": saved.FileSize,
+		"folder_id": folderID,
+		"version":   saved.Version,
+		"forked_from": models.DocumentOrigin{
+			DocumentID: src.ID,
+			Title:      src.Title,
+			AuthorID:   src.UserID,
+			AuthorName: src.Author,
+		},
+	})
+}
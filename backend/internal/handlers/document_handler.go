@@ -1,31 +1,92 @@
 package handlers
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
+	"errors"
+	"log"
 	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/collab"
+	"markdown-editor-backend/internal/config"
 	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/storage"
 	"markdown-editor-backend/pkg/api"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"os"
 )
 
-const uploadDir = "uploads"
 const imagesSubdir = "images"
+const filesSubdir = "files" // 非图片附件
 
 type DocumentHandler struct {
-	db    *sql.DB
-	cache *cache.Cache
+	db          *sql.DB
+	cache       *cache.Cache
+	revision    config.RevisionConfig
+	trash       config.TrashConfig
+	collab      *collab.Hub
+	shareSecret []byte          // 分享链接令牌的签名密钥
+	store       storage.Storage // 上传文件的存储后端
+	sharePwd    *attemptLimiter // 分享链接访问密码的失败次数限制
 }
 
-func NewDocumentHandler(db *sql.DB, c *cache.Cache) *DocumentHandler {
-	return &DocumentHandler{db: db, cache: c}
+// NewDocumentHandler 创建文档处理器；shareSecret 用于签名分享链接，更换后已发出的链接全部失效
+func NewDocumentHandler(db *sql.DB, c *cache.Cache, revision config.RevisionConfig, trash config.TrashConfig, shareSecret string, store storage.Storage) *DocumentHandler {
+	h := &DocumentHandler{db: db, cache: c, revision: revision, trash: trash, shareSecret: []byte(shareSecret), store: store,
+		sharePwd: newAttemptLimiter(c, sharePasswordMaxFailures, sharePasswordWindow)}
+	h.collab = collab.NewHub(c, h.persistCollab)
+	return h
+}
+
+// mdFilename 由标题生成文件名：未以 .md 结尾时补上扩展名
+func mdFilename(title string) string {
+	if strings.HasSuffix(strings.ToLower(title), ".md") {
+		return title
+	}
+	return title + ".md"
+}
+
+// errVersionConflict 表示保存时文档版本已被他人更新（If-Match 不匹配）
+var errVersionConflict = errors.New("document version conflict")
+
+// versionETag 由文档版本号生成强 ETag，如 "3"
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch 解析 If-Match 请求头，返回期望的版本号；为空或 * 时返回 0（不校验）
+func parseIfMatch(header string) (int, error) {
+	v := strings.TrimSpace(header)
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	v = strings.Trim(v, `"`)
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid If-Match")
+	}
+	return version, nil
+}
+
+// respondConflict 返回 409，附带服务器当前标题、内容与版本
+func (h *DocumentHandler) respondConflict(c *gin.Context, docID int64) {
+	var d models.Document
+	err := h.db.QueryRow("SELECT id, title, content, version, updated_at FROM documents WHERE id = ?", docID).
+		Scan(&d.ID, &d.Title, &d.Content, &d.Version, &d.UpdatedAt)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+	c.Header("ETag", versionETag(d.Version))
+	api.ErrorWithData(c, http.StatusConflict, "文档已被其他会话修改，请合并后重试", gin.H{
+		"id":         d.ID,
+		"title":      d.Title,
+		"content":    d.Content,
+		"version":    d.Version,
+		"updated_at": d.UpdatedAt,
+	})
 }
 
 func (h *DocumentHandler) getUserID(c *gin.Context) (int64, bool) {
@@ -42,6 +103,50 @@ func (h *DocumentHandler) getUserID(c *gin.Context) (int64, bool) {
 	return userID, true
 }
 
+// createDocument 新建文档（版本 1）、记录首条修订、同步 front matter 并写入变更日志，均在同一事务内；
+// folderID 为 nil 时放在根目录。内容带 front matter title 时以其为标题，提交后执行 afterSave。
+func (h *DocumentHandler) createDocument(userID int64, folderID *int64, title, content string) (savedDocument, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return savedDocument{}, err
+	}
+	saved, err := createDocumentTx(tx, userID, folderID, title, content)
+	if err != nil {
+		tx.Rollback()
+		return saved, err
+	}
+	if err := tx.Commit(); err != nil {
+		return saved, err
+	}
+
+	h.afterSave(saved, content)
+	return saved, nil
+}
+
+// createDocumentTx 在调用方的事务内完成 createDocument 的写入；提交后由调用方执行 afterSave
+func createDocumentTx(tx *sql.Tx, userID int64, folderID *int64, title, content string) (savedDocument, error) {
+	title = frontMatterTitle(content, title)
+	saved := savedDocument{
+		OwnerID:  userID,
+		Title:    title,
+		Filename: mdFilename(title),
+		FileSize: int64(len([]byte(content))),
+		Version:  1,
+	}
+	result, err := tx.Exec(
+		"INSERT INTO documents (user_id, folder_id, title, filename, content, file_size) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, folderID, title, saved.Filename, content, saved.FileSize,
+	)
+	if err != nil {
+		return saved, err
+	}
+	saved.ID, _ = result.LastInsertId()
+	if err := insertRevision(tx, saved.ID, userID, title, content, revisionSourceCreate, saved.Version); err != nil {
+		return saved, err
+	}
+	return saved, recordSave(tx, saved, content)
+}
+
 // UploadDocument 上传/创建文档
 func (h *DocumentHandler) UploadDocument(c *gin.Context) {
 	userID, ok := h.getUserID(c)
@@ -61,126 +166,115 @@ func (h *DocumentHandler) UploadDocument(c *gin.Context) {
 		return
 	}
 
-	filename := title
-	if !strings.HasSuffix(strings.ToLower(filename), ".md") {
-		filename += ".md"
-	}
-	content := req.Content
-	if content == "" {
-		content = ""
+	if !checkTargetFolder(c, h.db, userID, req.FolderID) {
+		return
 	}
-	fileSize := int64(len([]byte(content)))
 
-	result, err := h.db.Exec(
-		"INSERT INTO documents (user_id, title, filename, content, file_size, image_path) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, title, filename, content, fileSize, nil,
-	)
+	saved, err := h.createDocument(userID, req.FolderID, title, req.Content)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "上传文档失败")
 		return
 	}
 
-	id, _ := result.LastInsertId()
-	h.cache.InvalidatePosts(c.Request.Context(), id)
+	h.cache.InvalidatePosts(c.Request.Context(), saved.ID)
+	c.Header("ETag", versionETag(saved.Version))
 	api.Success(c, gin.H{
-		"id":         id,
-		"title":      title,
-		"filename":   filename,
-		"file_size":  fileSize,
+		"id":        saved.ID,
+		"title":     saved.Title,
+		"filename":  saved.Filename,
+		"file_size": saved.FileSize,
+		"folder_id": req.FolderID,
+		"version":   saved.Version,
 	})
 }
 
-// UploadImage 拖拽上传图片：保存到 uploads/images/，并在数据库创建一条文档，content 为 Markdown 图片链接；删除该文档时会同步删除图片文件
+// UploadImage 拖拽上传图片：POST /api/documents/upload-image，保存为图片附件（见 UploadAttachment），不再创建文档。
+// 表单可选 document_id 关联到文档；content 为可直接插入的 Markdown，id 为附件 ID
 func (h *DocumentHandler) UploadImage(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
 		return
 	}
-
-	file, err := c.FormFile("file")
-	if err != nil {
-		api.Error(c, http.StatusBadRequest, "请选择要上传的图片文件")
+	a, ok := h.receiveAttachment(c, userID, attachmentImage)
+	if !ok {
 		return
 	}
+	api.Success(c, gin.H{
+		"id":         a.ID,
+		"url":        a.URL,
+		"content":    a.Markdown,
+		"attachment": a,
+	})
+}
 
-	// 只允许图片类型
-	ct := file.Header.Get("Content-Type")
-	if !strings.HasPrefix(ct, "image/") {
-		api.Error(c, http.StatusBadRequest, "仅支持上传图片文件")
-		return
-	}
+// imageExts 是允许上传的图片扩展名
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext == "" {
-		ext = ".png"
-	}
-	allowedExt := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
-	if !allowedExt[ext] {
-		api.Error(c, http.StatusBadRequest, "不支持的图片格式")
+// documentSortFields 是文档列表可用的排序字段
+var documentSortFields = map[string]sortField{
+	"title":      {Column: "title", Kind: sortString},
+	"created_at": {Column: "created_at", Kind: sortTime},
+	"updated_at": {Column: "updated_at", Kind: sortTime},
+	"file_size":  {Column: "file_size", Kind: sortInt},
+}
+
+// hasImageCondition 匹配内容中含 Markdown 图片的文档
+const hasImageCondition = "(content LIKE '%![%](%')"
+
+// GetDocuments 获取当前用户的文档列表，按列表约定分页排序（见 parseListQuery），默认按创建时间倒序。
+// 筛选：folder_id 限定文件夹（0 为根目录），recursive=1 时包含子文件夹；tag_ids 逗号分隔的标签 ID，须全部带有；
+// created_after / created_before / updated_after / updated_before 时间范围；has_image=1 / 0 是否带图片；
+// meta=key 或 meta=key:value（可重复）按 front matter 元数据筛选
+func (h *DocumentHandler) GetDocuments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
 		return
 	}
 
-	// 生成唯一文件名
-	b := make([]byte, 8)
-	if _, err := rand.Read(b); err != nil {
-		api.Error(c, http.StatusInternalServerError, "生成文件名失败")
+	lq, ok := parseListQuery(c, documentSortFields, "created_at", "id")
+	if !ok {
 		return
 	}
-	saveName := hex.EncodeToString(b) + ext
-	relPath := imagesSubdir + string(filepath.Separator) + saveName
-	dir := filepath.Join(uploadDir, imagesSubdir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		api.Error(c, http.StatusInternalServerError, "创建上传目录失败")
+	folderWhere, folderArgs, ok := folderFilter(c, h.db, userID, "folder_id")
+	if !ok {
 		return
 	}
-	fullPath := filepath.Join(dir, saveName)
-	if err := c.SaveUploadedFile(file, fullPath); err != nil {
-		api.Error(c, http.StatusInternalServerError, "保存图片失败")
+	metaWhere, metaArgs, ok := metaFilter(c, "documents.id")
+	if !ok {
 		return
 	}
-
-	// 图片访问 URL（相对路径，前端可拼接 baseURL）
-	urlPath := "/uploads/" + imagesSubdir + "/" + saveName
-	content := "![](" + urlPath + ")"
-	title := file.Filename
-	if title == "" {
-		title = "image" + ext
-	}
-	filename := title
-	if !strings.HasSuffix(strings.ToLower(filename), ".md") {
-		filename += ".md"
-	}
-	fileSize := file.Size
-
-	result, err := h.db.Exec(
-		"INSERT INTO documents (user_id, title, filename, content, file_size, image_path) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, title, filename, content, fileSize, relPath,
-	)
-	if err != nil {
-		os.Remove(fullPath)
-		api.Error(c, http.StatusInternalServerError, "创建文档记录失败")
+	createdWhere, createdArgs, ok := timeRangeFilter(c, "created", "created_at")
+	if !ok {
 		return
 	}
-
-	id, _ := result.LastInsertId()
-	h.cache.InvalidatePosts(c.Request.Context(), id)
-	api.Success(c, gin.H{
-		"id":      id,
-		"url":     urlPath,
-		"content": content,
-	})
-}
-
-// GetDocuments 获取当前用户的文档列表
-func (h *DocumentHandler) GetDocuments(c *gin.Context) {
-	userID, ok := h.getUserID(c)
+	updatedWhere, updatedArgs, ok := timeRangeFilter(c, "updated", "updated_at")
 	if !ok {
 		return
 	}
+	where := "user_id = ? AND deleted_at IS NULL" + folderWhere + metaWhere + createdWhere + updatedWhere
+	args := append([]interface{}{userID}, folderArgs...)
+	args = append(append(append(args, metaArgs...), createdArgs...), updatedArgs...)
+	tagWhere, tagArgs := tagFilter(parseIDList(c.Query("tag_ids")), "id", "document_tags", "document_id")
+	where += tagWhere
+	args = append(args, tagArgs...)
+	if raw := c.Query("has_image"); raw != "" {
+		hasImage, err := strconv.ParseBool(raw)
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "has_image 只能为 1 或 0")
+			return
+		}
+		if hasImage {
+			where += " AND " + hasImageCondition
+		} else {
+			where += " AND NOT " + hasImageCondition
+		}
+	}
+	cursorWhere, cursorArgs := lq.where()
+	tail, tailArgs := lq.orderLimit()
 
 	rows, err := h.db.Query(
-		"SELECT id, user_id, title, filename, file_size, created_at, updated_at FROM documents WHERE user_id = ? ORDER BY created_at DESC",
-		userID,
+		"SELECT id, user_id, folder_id, title, filename, file_size, visibility, is_template, created_at, updated_at FROM documents WHERE "+where+cursorWhere+tail,
+		append(append(args, cursorArgs...), tailArgs...)...,
 	)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "获取文档列表失败")
@@ -191,16 +285,26 @@ func (h *DocumentHandler) GetDocuments(c *gin.Context) {
 	var list []models.Document
 	for rows.Next() {
 		var d models.Document
-		if err := rows.Scan(&d.ID, &d.UserID, &d.Title, &d.Filename, &d.FileSize, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		if err := rows.Scan(&d.ID, &d.UserID, &d.FolderID, &d.Title, &d.Filename, &d.FileSize, &d.Visibility, &d.IsTemplate, &d.CreatedAt, &d.UpdatedAt); err != nil {
 			continue
 		}
 		list = append(list, d)
 	}
 
-	api.Success(c, list)
+	api.Success(c, pageOf(lq, list, func(d models.Document) (interface{}, int64) {
+		switch lq.Sort {
+		case "title":
+			return d.Title, d.ID
+		case "updated_at":
+			return d.UpdatedAt, d.ID
+		case "file_size":
+			return d.FileSize, d.ID
+		}
+		return d.CreatedAt, d.ID
+	}))
 }
 
-// GetDocument 获取单篇文档内容
+// GetDocument 获取单篇文档内容；作者与被授权用户均可访问，返回的 role 为当前用户的角色
 func (h *DocumentHandler) GetDocument(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
@@ -214,11 +318,22 @@ func (h *DocumentHandler) GetDocument(c *gin.Context) {
 		return
 	}
 
+	role, ok := h.requireRole(c, id, userID, roleViewer)
+	if !ok {
+		return
+	}
+
 	var d models.Document
-	err = h.db.QueryRow(
-		"SELECT id, user_id, title, filename, content, file_size, created_at, updated_at FROM documents WHERE id = ? AND user_id = ?",
-		id, userID,
-	).Scan(&d.ID, &d.UserID, &d.Title, &d.Filename, &d.Content, &d.FileSize, &d.CreatedAt, &d.UpdatedAt)
+	var forkedFrom, forkedAuthor sql.NullInt64
+	var forkedTitle, forkedAuthorName, linkToken sql.NullString
+	err = h.db.QueryRow(`
+		SELECT d.id, d.user_id, d.folder_id, d.title, d.filename, d.content, d.file_size, d.version, d.visibility, d.link_token, d.is_template, d.created_at, d.updated_at,
+		       d.forked_from_id, d.forked_from_user_id, d.forked_from_title, u.username
+		FROM documents d
+		LEFT JOIN users u ON u.id = d.forked_from_user_id
+		WHERE d.id = ? AND d.deleted_at IS NULL
+	`, id).Scan(&d.ID, &d.UserID, &d.FolderID, &d.Title, &d.Filename, &d.Content, &d.FileSize, &d.Version, &d.Visibility, &linkToken, &d.IsTemplate, &d.CreatedAt, &d.UpdatedAt,
+		&forkedFrom, &forkedAuthor, &forkedTitle, &forkedAuthorName)
 
 	if err == sql.ErrNoRows {
 		api.Error(c, http.StatusNotFound, "文档不存在")
@@ -228,11 +343,30 @@ func (h *DocumentHandler) GetDocument(c *gin.Context) {
 		api.Error(c, http.StatusInternalServerError, "获取文档失败")
 		return
 	}
+	if role != roleOwner {
+		d.FolderID = nil // 文件夹属于作者的目录结构，对协作者无意义
+	} else if d.Visibility == visibilityUnlisted {
+		d.LinkToken = linkToken.String
+	}
+	d.Role = role
+	if forkedFrom.Valid {
+		d.ForkedFrom = &models.DocumentOrigin{
+			DocumentID: forkedFrom.Int64,
+			Title:      forkedTitle.String,
+			AuthorID:   forkedAuthor.Int64,
+			AuthorName: forkedAuthorName.String,
+		}
+	}
 
+	c.Header("ETag", versionETag(d.Version))
 	api.Success(c, d)
 }
 
-// UpdateDocument 更新文档
+// UpdateDocument 更新文档，作者与 editor 角色可用。
+// 作者改名时可带 rewrite_links=true，同时改写其他文档中指向旧标题的链接（响应中 links_rewritten 为改写的文档数，
+// links_skipped 为因他人持有编辑锁或版本冲突而未改写的文档 ID）。
+// 请求头带 If-Match（取自 GetDocument 返回的 ETag）时做乐观并发校验：
+// 版本已变化则返回 409，并附带服务器当前内容与版本，供客户端合并后重试
 func (h *DocumentHandler) UpdateDocument(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
@@ -252,9 +386,14 @@ func (h *DocumentHandler) UpdateDocument(c *gin.Context) {
 		return
 	}
 
+	role, ok := h.requireRole(c, id, userID, roleEditor)
+	if !ok || !h.checkLock(c, id, userID) {
+		return
+	}
+
 	// 先查出现有文档
 	var currentTitle, currentContent string
-	err = h.db.QueryRow("SELECT title, content FROM documents WHERE id = ? AND user_id = ?", id, userID).
+	err = h.db.QueryRow("SELECT title, content FROM documents WHERE id = ? AND deleted_at IS NULL", id).
 		Scan(&currentTitle, &currentContent)
 	if err == sql.ErrNoRows {
 		api.Error(c, http.StatusNotFound, "文档不存在")
@@ -273,31 +412,44 @@ func (h *DocumentHandler) UpdateDocument(c *gin.Context) {
 	if content == "" {
 		content = currentContent
 	}
-	filename := title
-	if !strings.HasSuffix(strings.ToLower(filename), ".md") {
-		filename += ".md"
+
+	ifVersion, err := parseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的 If-Match 请求头")
+		return
 	}
-	fileSize := int64(len([]byte(content)))
 
-	_, err = h.db.Exec(
-		"UPDATE documents SET title = ?, filename = ?, content = ?, file_size = ?, updated_at = NOW() WHERE id = ? AND user_id = ?",
-		title, filename, content, fileSize, id, userID,
-	)
+	saved, err := h.saveContent(id, userID, title, content, revisionSourceUpdate, ifVersion)
+	if err == errVersionConflict {
+		h.respondConflict(c, id)
+		return
+	}
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "更新文档失败")
 		return
 	}
 
 	h.cache.InvalidatePosts(c.Request.Context(), id)
-	api.Success(c, gin.H{
+	data := gin.H{
 		"id":        id,
-		"title":     title,
-		"filename":  filename,
-		"file_size": fileSize,
-	})
+		"title":     saved.Title,
+		"filename":  saved.Filename,
+		"file_size": saved.FileSize,
+		"version":   saved.Version,
+	}
+	if req.RewriteLinks && role == roleOwner {
+		n, skipped, err := h.rewriteBacklinks(c.Request.Context(), id, userID, saved.PrevTitle, saved.Title)
+		if err != nil {
+			log.Printf("改写链接失败 doc=%d: %v", id, err)
+		}
+		data["links_rewritten"] = n
+		data["links_skipped"] = skipped
+	}
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, data)
 }
 
-// DeleteDocument 删除文档；若该文档为图片文档（含 image_path），会先删除服务器上的图片文件再删记录
+// DeleteDocument 删除文档：移入回收站（软删除），可在回收站中还原；图片文件在永久清除时删除
 func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
@@ -311,14 +463,15 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
-	var imagePath sql.NullString
-	err = h.db.QueryRow("SELECT image_path FROM documents WHERE id = ? AND user_id = ?", id, userID).Scan(&imagePath)
-	if err == nil && imagePath.Valid && imagePath.String != "" {
-		fullPath := filepath.Join(uploadDir, imagePath.String)
-		_ = os.Remove(fullPath)
+	if !h.checkLock(c, id, userID) {
+		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM documents WHERE id = ? AND user_id = ?", id, userID)
+	// 软删除：移入回收站，图片文件等到永久清除时再删
+	result, err := h.db.Exec(
+		"UPDATE documents SET deleted_at = NOW(), updated_at = updated_at WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+		id, userID,
+	)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "删除文档失败")
 		return
@@ -330,46 +483,101 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
+	recordDocumentsTrashed(h.db, userID, []int64{id})
 	h.cache.InvalidatePosts(c.Request.Context(), id)
-	api.Success(c, gin.H{"message": "删除成功"})
+	api.Success(c, gin.H{"message": "已移入回收站"})
 }
 
-// SearchDocuments 搜索文档（按标题）
+// SearchDocuments 全文搜索文档（标题 + 内容）
+// 参数：q 搜索词，支持 "双引号短语"，多个词须同时命中；tag_ids 逗号分隔的标签 ID，须全部带有；
+// folder_id / recursive 限定文件夹、meta 按 front matter 元数据筛选（同 GetDocuments）；limit 默认 50。
+// 结果按相关度排序，snippet / title_highlight 为带 <mark> 的高亮片段（已做 HTML 转义）。
 func (h *DocumentHandler) SearchDocuments(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
 		return
 	}
 
-	keyword := strings.TrimSpace(c.Query("q"))
-	if keyword == "" {
-		api.Success(c, []models.Document{})
+	q := parseSearchQuery(c.Query("q"))
+	tagIDs := parseIDList(c.Query("tag_ids"))
+	folderWhere, folderArgs, ok := folderFilter(c, h.db, userID, "d.folder_id")
+	if !ok {
 		return
 	}
+	metaWhere, metaArgs, ok := metaFilter(c, "d.id")
+	if !ok {
+		return
+	}
+	folderWhere += metaWhere
+	folderArgs = append(folderArgs, metaArgs...)
+	if len(q.Terms) == 0 && len(q.Phrases) == 0 && len(tagIDs) == 0 && folderWhere == "" {
+		api.Success(c, []models.SearchResult{})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
 
-	pattern := "%" + keyword + "%"
-	rows, err := h.db.Query(
-		"SELECT id, user_id, title, filename, file_size, created_at, updated_at FROM documents WHERE user_id = ? AND (title LIKE ? OR filename LIKE ?) ORDER BY created_at DESC",
-		userID, pattern, pattern,
-	)
+	against, short := q.booleanQuery()
+	scoreExpr := "0"
+	var scoreArgs []interface{}
+	where := "d.user_id = ? AND d.deleted_at IS NULL" + folderWhere
+	args := append([]interface{}{userID}, folderArgs...)
+	if against != "" {
+		scoreExpr = "MATCH(d.title, d.content) AGAINST (? IN BOOLEAN MODE)"
+		scoreArgs = append(scoreArgs, against)
+		where += " AND MATCH(d.title, d.content) AGAINST (? IN BOOLEAN MODE)"
+		args = append(args, against)
+	}
+	for _, s := range short {
+		pattern := "%" + escapeLike(s) + "%"
+		where += " AND (d.title LIKE ? OR d.content LIKE ?)"
+		args = append(args, pattern, pattern)
+	}
+	tagWhere, tagArgs := tagFilter(tagIDs, "d.id", "document_tags", "document_id")
+	where += tagWhere
+	args = append(args, tagArgs...)
+
+	query := "SELECT d.id, d.user_id, d.folder_id, d.title, d.filename, d.content, d.file_size, d.version, d.created_at, d.updated_at, " +
+		scoreExpr + " AS score FROM documents d WHERE " + where +
+		" ORDER BY score DESC, d.updated_at DESC LIMIT ?"
+	args = append(append(scoreArgs, args...), limit)
+
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "搜索失败")
 		return
 	}
 	defer rows.Close()
 
-	var list []models.Document
+	words := q.all()
+	list := []models.SearchResult{}
 	for rows.Next() {
-		var d models.Document
-		if err := rows.Scan(&d.ID, &d.UserID, &d.Title, &d.Filename, &d.FileSize, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		var r models.SearchResult
+		var content string
+		if err := rows.Scan(&r.ID, &r.UserID, &r.FolderID, &r.Title, &r.Filename, &content, &r.FileSize, &r.Version, &r.CreatedAt, &r.UpdatedAt, &r.Score); err != nil {
 			continue
 		}
-		list = append(list, d)
+		r.Snippet = buildSnippet(content, words)
+		r.TitleHighlight = highlight(r.Title, words)
+		list = append(list, r)
 	}
 
 	api.Success(c, list)
 }
 
+// parseIDList 解析逗号分隔的正整数 ID 列表，忽略非法项
+func parseIDList(s string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // GetDocumentStats 数据库上传记录统计（今日次数、总文档数、总大小、近7天数据）
 func (h *DocumentHandler) GetDocumentStats(c *gin.Context) {
 	userID, ok := h.getUserID(c)
@@ -380,7 +588,7 @@ func (h *DocumentHandler) GetDocumentStats(c *gin.Context) {
 	var totalCount int
 	var totalSize int64
 	err := h.db.QueryRow(
-		"SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM documents WHERE user_id = ?",
+		"SELECT COUNT(*), COALESCE(SUM(file_size), 0) FROM documents WHERE user_id = ? AND deleted_at IS NULL",
 		userID,
 	).Scan(&totalCount, &totalSize)
 	if err != nil {
@@ -390,7 +598,7 @@ func (h *DocumentHandler) GetDocumentStats(c *gin.Context) {
 
 	var todayCount int
 	_ = h.db.QueryRow(
-		"SELECT COUNT(*) FROM documents WHERE user_id = ? AND DATE(updated_at) = CURDATE()",
+		"SELECT COUNT(*) FROM documents WHERE user_id = ? AND deleted_at IS NULL AND DATE(updated_at) = CURDATE()",
 		userID,
 	).Scan(&todayCount)
 
@@ -402,7 +610,7 @@ func (h *DocumentHandler) GetDocumentStats(c *gin.Context) {
 	rows, err := h.db.Query(`
 		SELECT DATE(updated_at) as d, COUNT(*) as c
 		FROM documents
-		WHERE user_id = ? AND updated_at >= DATE_SUB(CURDATE(), INTERVAL 6 DAY)
+		WHERE user_id = ? AND deleted_at IS NULL AND updated_at >= DATE_SUB(CURDATE(), INTERVAL 6 DAY)
 		GROUP BY DATE(updated_at)
 		ORDER BY d
 	`, userID)
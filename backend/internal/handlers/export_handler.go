@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/frontmatter"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// exportImagesDir 是 ZIP 内存放图片的目录，文档中的图片链接改写为相对此目录的路径
+const exportImagesDir = "images"
+
+// uploadImageRe 匹配文档中指向本站上传图片的链接（可带协议与域名前缀），捕获图片文件名
+var uploadImageRe = regexp.MustCompile(`(?:https?://[^\s()<>"']+)?/uploads/` + imagesSubdir + `/([A-Za-z0-9._-]+)`)
+
+// zipEntryName 把文件名清理为 ZIP 内安全的单层名称（去掉路径分隔符与控制字符）
+func zipEntryName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.TrimLeft(name, ".")
+	if name == "" || strings.EqualFold(name, "md") {
+		name = "untitled.md"
+	}
+	return name
+}
+
+// uniqueName 在已用名称中为 name 去重：a.md、a (2).md、a (3).md……
+func uniqueName(used map[string]bool, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// withExportFrontMatter 把标题、标签与时间写入 front matter；文档已有 front matter 时只改写这几个键，其余内容原样保留
+func withExportFrontMatter(title, content string, tags []string, createdAt, updatedAt time.Time) string {
+	fields := []frontmatter.Field{{Key: "title", Value: title}}
+	if len(tags) > 0 {
+		fields = append(fields, frontmatter.Field{Key: "tags", Value: tags})
+	}
+	fields = append(fields,
+		frontmatter.Field{Key: "created_at", Value: createdAt.Format(time.RFC3339)},
+		frontmatter.Field{Key: "updated_at", Value: updatedAt.Format(time.RFC3339)},
+	)
+	out, err := frontmatter.Patch(content, fields...)
+	if err != nil {
+		// 原有 front matter 不是合法 YAML：整体视为正文，避免丢失内容
+		out, err = frontmatter.Prepend(content, fields...)
+	}
+	if err != nil {
+		return content
+	}
+	return out
+}
+
+// documentTagNames 读取用户所有文档的标签名：document_id → 标签名列表
+func (h *DocumentHandler) documentTagNames(userID int64) (map[int64][]string, error) {
+	rows, err := h.db.Query(`
+		SELECT dt.document_id, t.name
+		FROM document_tags dt
+		INNER JOIN tags t ON t.id = dt.tag_id
+		INNER JOIN documents d ON d.id = dt.document_id
+		WHERE d.user_id = ? AND d.deleted_at IS NULL
+		ORDER BY dt.document_id, t.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var docID int64
+		var name string
+		if err := rows.Scan(&docID, &name); err != nil {
+			continue
+		}
+		tags[docID] = append(tags[docID], name)
+	}
+	return tags, rows.Err()
+}
+
+// ExportDocuments 以 ZIP 流式导出当前用户的全部文档及其引用的图片。
+// 每篇文档写为 <filename>（与上传时相同的 .md 命名，重名追加序号），标签等元数据写入 YAML front matter；
+// 被引用的 uploads/images 图片放入 images/ 目录，文档中的链接改写为 images/<文件名>。
+func (h *DocumentHandler) ExportDocuments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.documentTagNames(userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取标签失败")
+		return
+	}
+	rows, err := h.db.Query(
+		"SELECT id, title, filename, content, created_at, updated_at FROM documents WHERE user_id = ? AND deleted_at IS NULL ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档列表失败")
+		return
+	}
+	defer rows.Close()
+
+	// 开始写 ZIP 后响应头已发出，之后的错误只能记录日志并中断连接
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="documents-%s.zip"`, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+	zw := zip.NewWriter(c.Writer)
+
+	ctx := c.Request.Context()
+	used := make(map[string]bool)
+	images := make(map[string]bool) // 被引用的图片文件名 → 是否存在
+	for rows.Next() {
+		var (
+			id                   int64
+			title, filename      string
+			content              string
+			createdAt, updatedAt time.Time
+		)
+		if err := rows.Scan(&id, &title, &filename, &content, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+
+		content = uploadImageRe.ReplaceAllStringFunc(content, func(link string) string {
+			name := uploadImageRe.FindStringSubmatch(link)[1]
+			exists, checked := images[name]
+			if !checked {
+				_, err := h.store.Stat(ctx, imagesSubdir+"/"+name)
+				exists = err == nil
+				images[name] = exists
+			}
+			if !exists {
+				return link // 图片已不存在：保留原链接
+			}
+			return exportImagesDir + "/" + name
+		})
+		content = withExportFrontMatter(title, content, tags[id], createdAt, updatedAt)
+
+		name := uniqueName(used, zipEntryName(mdFilename(filename)))
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: updatedAt})
+		if err == nil {
+			_, err = io.WriteString(w, content)
+		}
+		if err != nil {
+			log.Printf("导出文档失败 user=%d doc=%d: %v", userID, id, err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("导出文档失败 user=%d: %v", userID, err)
+		return
+	}
+
+	for name, exists := range images {
+		if !exists {
+			continue
+		}
+		if err := addObjectToZip(ctx, zw, h.store, imagesSubdir+"/"+name, exportImagesDir+"/"+name); err != nil {
+			log.Printf("导出图片失败 user=%d image=%s: %v", userID, name, err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("导出 ZIP 失败 user=%d: %v", userID, err)
+	}
+}
+
+// addObjectToZip 把存储中的对象 key 写入 ZIP；图片本身已压缩，使用 Store 避免白费 CPU
+func addObjectToZip(ctx context.Context, zw *zip.Writer, store storage.Storage, key, name string) error {
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: obj.ModTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, obj)
+	return err
+}
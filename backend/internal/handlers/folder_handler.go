@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+const folderNameMaxLen = 100
+
+// 删除文件夹时对其内容的处理方式
+const (
+	folderDeleteMove   = "move"   // 默认：子文件夹与文档移到被删文件夹的上级
+	folderDeleteDelete = "delete" // 连同全部子文件夹一起删除，文档移入回收站
+)
+
+type FolderHandler struct {
+	db    *sql.DB
+	cache *cache.Cache
+	docs  *DocumentHandler // 删除文件夹时检查其中文档的编辑锁
+}
+
+func NewFolderHandler(db *sql.DB, c *cache.Cache, docs *DocumentHandler) *FolderHandler {
+	return &FolderHandler{db: db, cache: c, docs: docs}
+}
+
+func (h *FolderHandler) getUserID(c *gin.Context) (int64, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		api.Error(c, http.StatusUnauthorized, "未登录或 token 无效")
+		return 0, false
+	}
+	userID, ok := userIDVal.(int64)
+	if !ok {
+		api.Error(c, http.StatusInternalServerError, "无效的用户 ID 类型")
+		return 0, false
+	}
+	return userID, true
+}
+
+// loadFolderParents 读取用户全部文件夹的 id → parent_id（0 表示根目录）
+func loadFolderParents(db *sql.DB, userID int64) (map[int64]int64, error) {
+	rows, err := db.Query("SELECT id, COALESCE(parent_id, 0) FROM folders WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[int64]int64)
+	for rows.Next() {
+		var id, parent int64
+		if err := rows.Scan(&id, &parent); err != nil {
+			return nil, err
+		}
+		parents[id] = parent
+	}
+	return parents, rows.Err()
+}
+
+// folderSubtree 返回 rootID 及其全部子孙文件夹 ID（层级在 Go 中展开，避免依赖递归 CTE）
+func folderSubtree(parents map[int64]int64, rootID int64) []int64 {
+	children := make(map[int64][]int64)
+	for id, parent := range parents {
+		children[parent] = append(children[parent], id)
+	}
+	ids := []int64{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// idPlaceholders 生成 IN 子句的占位符与参数
+func idPlaceholders(ids []int64) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","), args
+}
+
+// folderExists 校验文件夹属于该用户
+func folderExists(db *sql.DB, userID, folderID int64) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM folders WHERE id = ? AND user_id = ?", folderID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// checkTargetFolder 校验请求中的目标文件夹（nil 表示根目录）；不存在时已写入错误响应
+func checkTargetFolder(c *gin.Context, db *sql.DB, userID int64, folderID *int64) bool {
+	if folderID == nil {
+		return true
+	}
+	ok, err := folderExists(db, userID, *folderID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文件夹失败")
+		return false
+	}
+	if !ok {
+		api.Error(c, http.StatusNotFound, "文件夹不存在")
+		return false
+	}
+	return true
+}
+
+// folderFilter 解析文档列表 / 搜索的 folder_id 与 recursive 参数，返回附加的 WHERE 条件（列名 col）。
+// folder_id 省略时不过滤；为 0 表示根目录；recursive=1 时包含全部子孙文件夹中的文档。
+// 参数无效或文件夹不存在时已写入错误响应，ok 为 false。
+func folderFilter(c *gin.Context, db *sql.DB, userID int64, col string) (where string, args []interface{}, ok bool) {
+	raw := c.Query("folder_id")
+	if raw == "" {
+		return "", nil, true
+	}
+	folderID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || folderID < 0 {
+		api.Error(c, http.StatusBadRequest, "无效的文件夹 ID")
+		return "", nil, false
+	}
+	recursive, _ := strconv.ParseBool(c.Query("recursive"))
+
+	if folderID == 0 {
+		if recursive {
+			return "", nil, true // 根目录递归即全部文档
+		}
+		return " AND " + col + " IS NULL", nil, true
+	}
+	if !recursive {
+		if !checkTargetFolder(c, db, userID, &folderID) {
+			return "", nil, false
+		}
+		return " AND " + col + " = ?", []interface{}{folderID}, true
+	}
+
+	parents, err := loadFolderParents(db, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文件夹失败")
+		return "", nil, false
+	}
+	if _, exists := parents[folderID]; !exists {
+		api.Error(c, http.StatusNotFound, "文件夹不存在")
+		return "", nil, false
+	}
+	placeholders, args := idPlaceholders(folderSubtree(parents, folderID))
+	return " AND " + col + " IN (" + placeholders + ")", args, true
+}
+
+// validFolderName 校验并规范化文件夹名；无效时已写入错误响应
+func validFolderName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		api.Error(c, http.StatusBadRequest, "文件夹名称不能为空")
+		return "", false
+	}
+	if utf8.RuneCountInString(name) > folderNameMaxLen || strings.ContainsAny(name, "/\\") {
+		api.Error(c, http.StatusBadRequest, "文件夹名称无效")
+		return "", false
+	}
+	return name, true
+}
+
+// getFolder 读取用户的一个文件夹
+func (h *FolderHandler) getFolder(userID, id int64) (models.Folder, error) {
+	var f models.Folder
+	err := h.db.QueryRow(
+		"SELECT id, user_id, parent_id, name, created_at, updated_at FROM folders WHERE id = ? AND user_id = ?",
+		id, userID,
+	).Scan(&f.ID, &f.UserID, &f.ParentID, &f.Name, &f.CreatedAt, &f.UpdatedAt)
+	return f, err
+}
+
+// GetFolders 当前用户的全部文件夹（平铺，前端按 parent_id 组装成树），附带各文件夹直接包含的文档数
+func (h *FolderHandler) GetFolders(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, f.updated_at,
+		       (SELECT COUNT(*) FROM documents d WHERE d.folder_id = f.id AND d.deleted_at IS NULL) AS document_count
+		FROM folders f
+		WHERE f.user_id = ?
+		ORDER BY f.name
+	`, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文件夹失败")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Folder{}
+	for rows.Next() {
+		var f models.Folder
+		if err := rows.Scan(&f.ID, &f.UserID, &f.ParentID, &f.Name, &f.CreatedAt, &f.UpdatedAt, &f.DocumentCount); err != nil {
+			continue
+		}
+		list = append(list, f)
+	}
+
+	api.Success(c, gin.H{"list": list})
+}
+
+// CreateFolder 新建文件夹；parent_id 省略时建在根目录
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	name, ok := validFolderName(c, req.Name)
+	if !ok || !checkTargetFolder(c, h.db, userID, req.ParentID) {
+		return
+	}
+
+	result, err := h.db.Exec("INSERT INTO folders (user_id, parent_id, name) VALUES (?, ?, ?)", userID, req.ParentID, name)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "创建文件夹失败")
+		return
+	}
+	id, _ := result.LastInsertId()
+	f, err := h.getFolder(userID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "创建文件夹失败")
+		return
+	}
+
+	api.Success(c, f)
+}
+
+// RenameFolder 重命名文件夹
+func (h *FolderHandler) RenameFolder(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文件夹 ID")
+		return
+	}
+
+	var req models.RenameFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	name, ok := validFolderName(c, req.Name)
+	if !ok || !checkTargetFolder(c, h.db, userID, &id) {
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE folders SET name = ? WHERE id = ? AND user_id = ?", name, id, userID); err != nil {
+		api.Error(c, http.StatusInternalServerError, "重命名文件夹失败")
+		return
+	}
+	f, err := h.getFolder(userID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "重命名文件夹失败")
+		return
+	}
+
+	api.Success(c, f)
+}
+
+// MoveFolder 把文件夹移到另一个文件夹下（folder_id 为 null 时移到根目录）；不能移到自身或其子孙文件夹中
+func (h *FolderHandler) MoveFolder(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文件夹 ID")
+		return
+	}
+
+	var req models.MoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+
+	parents, err := loadFolderParents(h.db, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文件夹失败")
+		return
+	}
+	if _, exists := parents[id]; !exists {
+		api.Error(c, http.StatusNotFound, "文件夹不存在")
+		return
+	}
+	if req.FolderID != nil {
+		if _, exists := parents[*req.FolderID]; !exists {
+			api.Error(c, http.StatusNotFound, "目标文件夹不存在")
+			return
+		}
+		for _, sub := range folderSubtree(parents, id) {
+			if sub == *req.FolderID {
+				api.Error(c, http.StatusBadRequest, "不能移动到自身或其子文件夹中")
+				return
+			}
+		}
+	}
+
+	if _, err := h.db.Exec("UPDATE folders SET parent_id = ? WHERE id = ? AND user_id = ?", req.FolderID, id, userID); err != nil {
+		api.Error(c, http.StatusInternalServerError, "移动文件夹失败")
+		return
+	}
+	f, err := h.getFolder(userID, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "移动文件夹失败")
+		return
+	}
+
+	api.Success(c, f)
+}
+
+// DeleteFolder 删除文件夹。默认 mode=move：直接子文件夹与文档移到上级文件夹，不丢失任何内容；
+// mode=delete：连同全部子孙文件夹一起删除，其中的文档移入回收站。
+// 受影响的文档有他人持有编辑锁时整体不删除，返回 423 与持有者。
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文件夹 ID")
+		return
+	}
+	mode := c.DefaultQuery("mode", folderDeleteMove)
+	if mode != folderDeleteMove && mode != folderDeleteDelete {
+		api.Error(c, http.StatusBadRequest, "无效的删除方式")
+		return
+	}
+
+	f, err := h.getFolder(userID, id)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "文件夹不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文件夹失败")
+		return
+	}
+
+	ctx := c.Request.Context()
+	var lease *models.DocumentLock
+	if mode == folderDeleteMove {
+		lease, err = h.deleteMovingContents(ctx, userID, f)
+	} else {
+		lease, err = h.deleteWithContents(ctx, userID, id)
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除文件夹失败")
+		return
+	}
+	if lease != nil {
+		respondLocked(c, lease)
+		return
+	}
+
+	h.cache.InvalidatePosts(c.Request.Context(), 0)
+	api.Success(c, gin.H{"message": "删除成功"})
+}
+
+// lockedDocument 返回 docIDs 中第一篇由他人持有编辑锁的文档的锁，都未被锁时返回 nil
+func (h *FolderHandler) lockedDocument(ctx context.Context, userID int64, docIDs []int64) *models.DocumentLock {
+	for _, id := range docIDs {
+		if lease := h.docs.lockedByOther(ctx, id, userID); lease != nil {
+			return lease
+		}
+	}
+	return nil
+}
+
+// deleteMovingContents 在同一事务内把子文件夹与文档上移一级，再删除文件夹；
+// 其中有文档被他人锁定时回滚并返回该锁
+func (h *FolderHandler) deleteMovingContents(ctx context.Context, userID int64, f models.Folder) (*models.DocumentLock, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	docIDs, err := queryIDs(tx, "SELECT id FROM documents WHERE folder_id = ? AND user_id = ? AND deleted_at IS NULL FOR UPDATE", f.ID, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if lease := h.lockedDocument(ctx, userID, docIDs); lease != nil {
+		tx.Rollback()
+		return lease, nil
+	}
+	if _, err := tx.Exec("UPDATE folders SET parent_id = ? WHERE parent_id = ? AND user_id = ?", f.ParentID, f.ID, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE documents SET folder_id = ? WHERE folder_id = ? AND user_id = ?", f.ParentID, f.ID, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM folders WHERE id = ? AND user_id = ?", f.ID, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	changes := make([]changelog.Change, 0, len(docIDs))
+	for _, id := range docIDs {
+		changes = append(changes, changelog.Upsert(changelog.EntityDocument, id))
+	}
+	recordChanges(h.db, userID, changes...)
+	return nil, nil
+}
+
+// deleteWithContents 删除文件夹子树，其中的文档移入回收站（还原时所在文件夹已不存在则回到根目录）；
+// 其中有文档被他人锁定时回滚并返回该锁
+func (h *FolderHandler) deleteWithContents(ctx context.Context, userID, id int64) (*models.DocumentLock, error) {
+	parents, err := loadFolderParents(h.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	placeholders, ids := idPlaceholders(folderSubtree(parents, id))
+	args := append([]interface{}{userID}, ids...)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	docIDs, err := queryIDs(tx, "SELECT id FROM documents WHERE user_id = ? AND deleted_at IS NULL AND folder_id IN ("+placeholders+") FOR UPDATE", args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if lease := h.lockedDocument(ctx, userID, docIDs); lease != nil {
+		tx.Rollback()
+		return lease, nil
+	}
+	if _, err := tx.Exec(
+		"UPDATE documents SET deleted_at = NOW(), updated_at = updated_at WHERE user_id = ? AND deleted_at IS NULL AND folder_id IN ("+placeholders+")",
+		args...,
+	); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM folders WHERE user_id = ? AND id IN ("+placeholders+")", args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	recordDocumentsTrashed(h.db, userID, docIDs)
+	return nil, nil
+}
+
+// MoveDocument 把文档移到某个文件夹（folder_id 为 null 时移到根目录）
+func (h *DocumentHandler) MoveDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.MoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	if !h.ownsDocument(c, id, userID) || !h.checkLock(c, id, userID) || !checkTargetFolder(c, h.db, userID, req.FolderID) {
+		return
+	}
+
+	// 只改归属，不算内容修改：不递增版本、不记修订，也不刷新 updated_at
+	if _, err := h.db.Exec("UPDATE documents SET folder_id = ?, updated_at = updated_at WHERE id = ? AND user_id = ?", req.FolderID, id, userID); err != nil {
+		api.Error(c, http.StatusInternalServerError, "移动文档失败")
+		return
+	}
+	recordChanges(h.db, userID, changelog.Upsert(changelog.EntityDocument, id))
+
+	api.Success(c, gin.H{"id": id, "folder_id": req.FolderID})
+}
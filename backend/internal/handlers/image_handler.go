@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/imaging"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// imageVariantsDir 是缩小尺寸的存放位置（images/variants/），文件名为 <原文件名去扩展名>_w<宽度><扩展名>
+const imageVariantsDir = "variants"
+
+// imageOriginalMarkerExt 是“原图不比该宽度宽，直接用原图”的空标记文件的扩展名，
+// 与缩小尺寸同名同目录（<原文件名去扩展名>_w<宽度>.orig），免得每次请求都读出原图解码后才发现不用缩小
+const imageOriginalMarkerExt = ".orig"
+
+// uploadNameRe 匹配 uploads 下的单层文件名
+var uploadNameRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// imageVariantSem 限制同时按需生成缩小尺寸的数量，大图解码耗内存
+var imageVariantSem = make(chan struct{}, 4)
+
+// variantWidth 把请求的宽度取整到 imaging.VariantWidths 中不小于它的最小值；比所有尺寸都宽时 ok 为 false（用原图）
+func variantWidth(w int) (int, bool) {
+	for _, vw := range imaging.VariantWidths {
+		if w <= vw {
+			return vw, true
+		}
+	}
+	return 0, false
+}
+
+// imageVariantKey 返回图片 name 宽 w 的缩小尺寸的对象键；该格式不生成缩小尺寸时 ok 为 false
+func imageVariantKey(name string, w int) (string, string, bool) {
+	ext := strings.ToLower(path.Ext(name))
+	format, variantExt, ok := imaging.VariantFormat(ext)
+	if !ok {
+		return "", "", false
+	}
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	return imagesSubdir + "/" + imageVariantsDir + "/" + stem + "_w" + strconv.Itoa(w) + variantExt, format, true
+}
+
+// writeImageVariant 把 img 缩到 w 宽写入 key（存储的写入是原子的，并发生成同一尺寸时不会读到半个文件）
+func writeImageVariant(ctx context.Context, store storage.Storage, key, format string, img image.Image, w int) error {
+	data, _, err := imaging.Encode(imaging.Resize(img, w), format)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(data), int64(len(data)))
+}
+
+// writeImageVariants 上传时为图片生成比原图窄的各个缩小尺寸；失败只记日志，访问时会再按需生成
+func writeImageVariants(ctx context.Context, store storage.Storage, name string, img image.Image) {
+	if img == nil {
+		return
+	}
+	for _, w := range imaging.VariantWidths {
+		if w >= img.Bounds().Dx() {
+			break
+		}
+		key, format, ok := imageVariantKey(name, w)
+		if !ok {
+			return
+		}
+		if err := writeImageVariant(ctx, store, key, format, img, w); err != nil {
+			log.Printf("生成图片缩略图失败 %s w=%d: %v", name, w, err)
+		}
+	}
+}
+
+// imageOriginalMarker 返回缩小尺寸 key 对应的“使用原图”标记的对象键
+func imageOriginalMarker(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + imageOriginalMarkerExt
+}
+
+// removeImageVariants 删除图片的全部缩小尺寸及“使用原图”标记
+func removeImageVariants(ctx context.Context, store storage.Storage, name string) {
+	for _, w := range imaging.VariantWidths {
+		if key, _, ok := imageVariantKey(name, w); ok {
+			_ = store.Delete(ctx, key)
+			_ = store.Delete(ctx, imageOriginalMarker(key))
+		}
+	}
+}
+
+// imageVariant 返回图片 name 不小于 w 宽的缩小尺寸的对象键，不存在时由原图生成。
+// 原图本身不比该尺寸宽、格式不支持或生成失败时 ok 为 false，调用方改用原图；
+// 原图不够宽时写入标记，之后的请求不再读取和解码原图
+func imageVariant(ctx context.Context, store storage.Storage, name string, w int) (string, bool) {
+	width, ok := variantWidth(w)
+	if !ok {
+		return "", false
+	}
+	key, format, ok := imageVariantKey(name, width)
+	if !ok {
+		return "", false
+	}
+	if _, err := store.Stat(ctx, key); err == nil {
+		return key, true
+	}
+	marker := imageOriginalMarker(key)
+	if _, err := store.Stat(ctx, marker); err == nil {
+		return "", false
+	}
+
+	imageVariantSem <- struct{}{}
+	defer func() { <-imageVariantSem }()
+	obj, err := store.Get(ctx, imagesSubdir+"/"+name)
+	if err != nil {
+		return "", false
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return "", false
+	}
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return "", false
+	}
+	if img.Bounds().Dx() <= width {
+		if err := store.Put(ctx, marker, bytes.NewReader(nil), 0); err != nil {
+			log.Printf("记录图片使用原图失败 %s w=%d: %v", name, width, err)
+		}
+		return "", false
+	}
+	if err := writeImageVariant(ctx, store, key, format, img, width); err != nil {
+		log.Printf("生成图片缩略图失败 %s w=%d: %v", name, width, err)
+		return "", false
+	}
+	return key, true
+}
+
+// imageVariantURL 把指向本站上传图片的 URL 改为宽 w 的缩小尺寸；其他 URL 原样返回
+func imageVariantURL(u string, w int) string {
+	if !uploadImageRe.MatchString(u) || strings.ContainsAny(u, "?#") {
+		return u
+	}
+	return u + "?w=" + strconv.Itoa(w)
+}
+
+// serveUpload 从存储读取 key 并返回给客户端。文件名随机且内容不变，允许长期缓存；
+// 存储返回的内容可定位时（本机存储与 S3 都是）支持 Range 与条件请求，否则按整个文件返回。
+// Content-Type 按上传策略确定（见 uploadContentType），并禁止浏览器嗅探；图片以外的文件一律作为下载返回
+func (h *DocumentHandler) serveUpload(c *gin.Context, key, notFound string) {
+	obj, err := h.store.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotExist) {
+		api.Error(c, http.StatusNotFound, notFound)
+		return
+	}
+	if err != nil {
+		log.Printf("读取上传文件失败 %s: %v", key, err)
+		api.Error(c, http.StatusInternalServerError, "读取文件失败")
+		return
+	}
+	defer obj.Close()
+	ct, inline := uploadContentType(key)
+	c.Header("Content-Type", ct)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if !inline {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	if rs, ok := obj.ReadCloser.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, path.Base(key), obj.ModTime, rs)
+		return
+	}
+	c.Header("Content-Length", strconv.FormatInt(obj.Size, 10))
+	if !obj.ModTime.IsZero() {
+		c.Header("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		_, _ = io.Copy(c.Writer, obj)
+	}
+}
+
+// uploadContentType 按扩展名所属的上传策略返回 Content-Type 与是否可在页面内显示（仅图片）。
+// 不属于任何策略的扩展名返回 application/octet-stream，不按文件内容猜测
+func uploadContentType(key string) (string, bool) {
+	ext := strings.ToLower(path.Ext(key))
+	policy, ok := attachmentPolicyFor(ext)
+	if !ok {
+		return "application/octet-stream", false
+	}
+	return mimeByExt(ext, ""), policy.Kind == attachmentImage
+}
+
+// ServeImage 提供上传的图片：GET /uploads/images/:name，无需认证。
+// 带 w 时返回不小于该宽度的缩小尺寸（320 缩略图、640 信息流卡片、1280），首次访问时生成并保存；
+// 更宽、原图不够宽或 WebP 时返回原图（不提供 WebP 格式的缩小尺寸）。
+// 带 w 的响应用 X-Image-Variant 说明实际返回的是哪个宽度（如 w320）还是原图（original）
+func (h *DocumentHandler) ServeImage(c *gin.Context) {
+	name := c.Param("name")
+	if !uploadNameRe.MatchString(name) {
+		api.Error(c, http.StatusNotFound, "图片不存在")
+		return
+	}
+	key := imagesSubdir + "/" + name
+	if raw := c.Query("w"); raw != "" {
+		w, err := strconv.Atoi(raw)
+		if err != nil || w <= 0 {
+			api.Error(c, http.StatusBadRequest, "无效的宽度")
+			return
+		}
+		if variant, ok := imageVariant(c.Request.Context(), h.store, name, w); ok {
+			key = variant
+			width, _ := variantWidth(w)
+			c.Header("X-Image-Variant", "w"+strconv.Itoa(width))
+		} else {
+			c.Header("X-Image-Variant", "original")
+		}
+	}
+	h.serveUpload(c, key, "图片不存在")
+}
+
+// ServeFile 提供上传的非图片附件：GET /uploads/files/:name，无需认证
+func (h *DocumentHandler) ServeFile(c *gin.Context) {
+	name := c.Param("name")
+	if !uploadNameRe.MatchString(name) {
+		api.Error(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+	h.serveUpload(c, filesSubdir+"/"+name, "文件不存在")
+}
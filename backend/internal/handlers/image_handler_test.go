@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/storage"
+)
+
+func TestServeUploadHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewLocal(t.TempDir())
+	h := &DocumentHandler{store: store}
+	files := map[string]string{
+		"images/a.png": "\x89PNG\r\n\x1a\n",
+		"files/b.pdf":  "%PDF-1.4",
+		"files/c.txt":  "<html><script>alert(1)</script>",
+		"files/d.html": "<html></html>",
+	}
+	for key, body := range files {
+		if err := store.Put(context.Background(), key, strings.NewReader(body), int64(len(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		key, ct, disposition string
+	}{
+		{"images/a.png", "image/png", ""},
+		{"files/b.pdf", "application/pdf", `attachment; filename=b.pdf`},
+		{"files/c.txt", "text/plain", `attachment; filename=c.txt`},
+		{"files/d.html", "application/octet-stream", `attachment; filename=d.html`},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/uploads/"+tc.key, nil)
+		h.serveUpload(c, tc.key, "不存在")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: 状态码 %d", tc.key, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.ct) {
+			t.Errorf("%s: Content-Type = %q，期望 %q", tc.key, ct, tc.ct)
+		}
+		if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q", tc.key, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tc.disposition {
+			t.Errorf("%s: Content-Disposition = %q，期望 %q", tc.key, got, tc.disposition)
+		}
+	}
+}
+
+func TestImageVariantOriginalMarker(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocal(t.TempDir())
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 100))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "images/a.png", bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := imageVariant(ctx, store, "a.png", 320); ok {
+		t.Fatal("原图比 320 窄，应返回原图")
+	}
+	if _, err := store.Stat(ctx, "images/variants/a_w320.orig"); err != nil {
+		t.Fatalf("没有写入使用原图的标记: %v", err)
+	}
+	// 原图换成更宽的图片：有标记时不再读取解码，仍返回原图
+	buf.Reset()
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1000, 100))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "images/a.png", bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := imageVariant(ctx, store, "a.png", 320); ok {
+		t.Fatal("有标记时应返回原图")
+	}
+	removeImageVariants(ctx, store, "a.png")
+	if _, err := store.Stat(ctx, "images/variants/a_w320.orig"); err == nil {
+		t.Fatal("删除缩小尺寸时没有删除标记")
+	}
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/imaging"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/storage"
+	"markdown-editor-backend/pkg/api"
+)
+
+// 导入限制：压缩包大小、条目数与单个文件解压后的大小（防 ZIP 炸弹）
+const (
+	importMaxArchiveSize = 100 << 20
+	importMaxEntries     = 5000
+	importMaxFileSize    = 10 << 20
+	tagNameMaxLen        = 50
+	defaultTagColor      = "#3b82f6"
+)
+
+// 导入报告中每个文件的处理结果
+const (
+	importCreated = "created"
+	importSkipped = "skipped"
+	importFailed  = "failed"
+)
+
+var (
+	// mdImageRe 匹配 Markdown 图片 ![alt](dest "title")，dest 可用 <> 包裹
+	mdImageRe = regexp.MustCompile(`!\[([^\]]*)\]\(\s*(<[^>]*>|[^)\s]+)((?:\s+"[^"]*")?)\s*\)`)
+	// wikiEmbedRe 匹配 Obsidian 嵌入 ![[target#anchor|alias]]
+	wikiEmbedRe = regexp.MustCompile(`!\[\[([^\]|#]+)(?:#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+	// obsidianSizeRe 匹配 Obsidian 图片尺寸别名，如 300 或 300x200
+	obsidianSizeRe = regexp.MustCompile(`^\d+(?:x\d+)?$`)
+)
+
+// importResult 是导入报告中的一行
+type importResult struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	DocumentID int64  `json:"document_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// importPath 把 zip 条目名规范化为不带前导 "/" 与 "./" 的相对路径
+func importPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// importIgnored 判断是否为应忽略的条目：目录、macOS 元数据以及 .obsidian 等隐藏文件/目录。
+// 按规范化后的路径判断，"./notes/a.md" 这类带 "./" 前缀的条目不会被误判为隐藏文件
+func importIgnored(name string) bool {
+	if strings.HasSuffix(name, "/") {
+		return true
+	}
+	name = importPath(name)
+	if strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// readZipFile 读取条目内容，超过 importMaxFileSize 时报错
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, importMaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > importMaxFileSize {
+		return nil, fmt.Errorf("文件超过 %d MB", importMaxFileSize>>20)
+	}
+	return data, nil
+}
+
+// vaultImporter 保存一次导入过程中的图片索引与已上传结果
+type vaultImporter struct {
+	ctx      context.Context
+	db       *sql.DB
+	store    storage.Storage
+	userID   int64                // 上传的图片登记为该用户的附件
+	images   map[string]*zip.File // 规范化的 zip 路径 → 图片条目
+	uploaded map[string]string    // zip 路径 → /uploads/... URL
+	failed   map[string]string    // zip 路径 → 失败原因
+	folders  map[string]int64     // zip 目录路径 → 文件夹 ID
+	created  int                  // 新建的文件夹数
+}
+
+// folder 返回 zip 目录 dir 对应的文件夹 ID（"." 为根目录，返回 nil），逐级查找同名文件夹，不存在时新建。
+// 名称不合法（过长）的目录不建文件夹，其中的文档放在上一级
+func (v *vaultImporter) folder(dir string) (*int64, error) {
+	if dir == "." || dir == "" {
+		return nil, nil
+	}
+	if id, ok := v.folders[dir]; ok {
+		return &id, nil
+	}
+	parent, err := v.folder(path.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(path.Base(dir))
+	if name == "" || utf8.RuneCountInString(name) > folderNameMaxLen || strings.Contains(name, "\\") {
+		if parent != nil {
+			v.folders[dir] = *parent
+		}
+		return parent, nil
+	}
+
+	var id int64
+	err = v.db.QueryRow(
+		"SELECT id FROM folders WHERE user_id = ? AND parent_id <=> ? AND name = ? ORDER BY id LIMIT 1",
+		v.userID, parent, name,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		result, err := v.db.Exec("INSERT INTO folders (user_id, parent_id, name) VALUES (?, ?, ?)", v.userID, parent, name)
+		if err != nil {
+			return nil, err
+		}
+		id, _ = result.LastInsertId()
+		v.created++
+	} else if err != nil {
+		return nil, err
+	}
+	v.folders[dir] = id
+	return &id, nil
+}
+
+// findImage 按 Obsidian 的规则查找嵌入目标：先按完整路径，再按路径后缀（仅文件名时即按文件名），多个匹配取路径最短者
+func (v *vaultImporter) findImage(target string) (string, bool) {
+	target = strings.TrimPrefix(path.Clean("/"+target), "/")
+	if _, ok := v.images[target]; ok {
+		return target, true
+	}
+	best := ""
+	for p := range v.images {
+		if strings.HasSuffix(strings.ToLower(p), "/"+strings.ToLower(target)) || strings.EqualFold(p, target) {
+			if best == "" || len(p) < len(best) || (len(p) == len(best) && p < best) {
+				best = p
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// upload 把图片条目按 UploadImage 的方式处理（去掉元数据、生成缩小尺寸）后写入存储的 images/ 并登记为附件，同一图片只上传一次；
+// 引用它的文档保存后由 afterSave 关联
+func (v *vaultImporter) upload(p string) (string, bool) {
+	if u, ok := v.uploaded[p]; ok {
+		return u, true
+	}
+	if _, ok := v.failed[p]; ok {
+		return "", false
+	}
+	f := v.images[p]
+	rc, err := f.Open()
+	if err != nil {
+		v.failed[p] = "读取图片失败"
+		return "", false
+	}
+	defer rc.Close()
+	if f.UncompressedSize64 > importMaxFileSize {
+		v.failed[p] = fmt.Sprintf("图片超过 %d MB", importMaxFileSize>>20)
+		return "", false
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, importMaxFileSize))
+	if err != nil {
+		v.failed[p] = "读取图片失败"
+		return "", false
+	}
+	res, err := imaging.Process(data)
+	if err != nil {
+		v.failed[p] = "无法解析图片: " + err.Error()
+		return "", false
+	}
+	a := models.Attachment{
+		UserID:   v.userID,
+		Filename: truncateTitle(path.Base(p)),
+		Kind:     attachmentImage,
+		MimeType: mimeByExt(res.Ext, ""),
+	}
+	stored, err := storeAttachment(v.ctx, v.db, v.store, &a, bytes.NewReader(res.Data), imagesSubdir, res.Ext)
+	if err != nil {
+		v.failed[p] = "保存图片失败"
+		return "", false
+	}
+	if stored {
+		writeImageVariants(v.ctx, v.store, path.Base(a.StoragePath), res.Img)
+	}
+	v.uploaded[p] = a.URL
+	return a.URL, true
+}
+
+// rewriteLinks 把 md 文件中引用压缩包内图片的相对链接与 ![[嵌入]] 改写为上传后的 URL
+func (v *vaultImporter) rewriteLinks(mdPath, content string) string {
+	dir := path.Dir(mdPath)
+	content = mdImageRe.ReplaceAllStringFunc(content, func(m string) string {
+		sub := mdImageRe.FindStringSubmatch(m)
+		dest := strings.TrimSuffix(strings.TrimPrefix(sub[2], "<"), ">")
+		if u, err := url.Parse(dest); err != nil || u.Scheme != "" || strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "#") {
+			return m
+		}
+		if unescaped, err := url.PathUnescape(dest); err == nil {
+			dest = unescaped
+		}
+		p, ok := v.findImage(path.Join(dir, dest))
+		if !ok {
+			if p, ok = v.findImage(dest); !ok { // 部分工具写的是相对仓库根目录的路径
+				return m
+			}
+		}
+		u, ok := v.upload(p)
+		if !ok {
+			return m
+		}
+		return "![" + sub[1] + "](" + u + sub[3] + ")"
+	})
+	return wikiEmbedRe.ReplaceAllStringFunc(content, func(m string) string {
+		sub := wikiEmbedRe.FindStringSubmatch(m)
+		target := strings.TrimSpace(sub[1])
+		if !imageExts[strings.ToLower(path.Ext(target))] {
+			return m // 嵌入的是笔记而非图片，保持原样
+		}
+		p, ok := v.findImage(target)
+		if !ok {
+			return m
+		}
+		u, ok := v.upload(p)
+		if !ok {
+			return m
+		}
+		alt := strings.TrimSpace(sub[2])
+		if alt == "" || obsidianSizeRe.MatchString(alt) {
+			alt = strings.TrimSuffix(path.Base(target), path.Ext(target))
+		}
+		return "![" + alt + "](" + u + ")"
+	})
+}
+
+// ensureTags 按名称查找或创建当前用户的标签，返回标签 ID（忽略空名与超长名）
+func (h *DocumentHandler) ensureTags(userID int64, names []string) ([]int64, error) {
+	ids, changes, err := upsertTags(h.db, userID, names)
+	recordChanges(h.db, userID, changes...)
+	return ids, err
+}
+
+// upsertTags 同 ensureTags，可在事务内执行；新建标签的变更由调用方记录
+func upsertTags(db execer, userID int64, names []string) ([]int64, []changelog.Change, error) {
+	var ids []int64
+	var changes []changelog.Change
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name, ok := validTagName(name)
+		if !ok || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		// uniq_user_tag 冲突时 LAST_INSERT_ID(id) 返回已有标签的 ID
+		result, err := db.Exec(
+			"INSERT INTO tags (user_id, name, color) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)",
+			userID, name, defaultTagColor,
+		)
+		if err != nil {
+			return ids, changes, err
+		}
+		id, _ := result.LastInsertId()
+		if n, _ := result.RowsAffected(); n == 1 {
+			changes = append(changes, changelog.Upsert(changelog.EntityTag, id))
+		}
+		ids = append(ids, id)
+	}
+	return ids, changes, nil
+}
+
+// tagDocument 给 userID 的文档打上一组标签（已存在的关联忽略）
+func (h *DocumentHandler) tagDocument(userID, docID int64, tagIDs []int64) error {
+	changes, err := addDocumentTags(h.db, docID, tagIDs)
+	recordChanges(h.db, userID, changes...)
+	return err
+}
+
+// addDocumentTags 同 tagDocument，可在事务内执行；新增关联的变更由调用方记录
+func addDocumentTags(db execer, docID int64, tagIDs []int64) ([]changelog.Change, error) {
+	var changes []changelog.Change
+	for _, tagID := range tagIDs {
+		result, err := db.Exec("INSERT IGNORE INTO document_tags (document_id, tag_id) VALUES (?, ?)", docID, tagID)
+		if err != nil {
+			return changes, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			changes = append(changes, changelog.DocumentTag(changelog.OpUpsert, docID, tagID))
+		}
+	}
+	return changes, nil
+}
+
+// ImportDocuments 从 ZIP（Markdown 文件夹或 Obsidian 仓库）批量导入文档。
+// .md 文件各建一篇文档（标题取 front matter 的 title，否则取文件名）；被引用的图片按 UploadImage 的方式保存，
+// 相对路径图片链接与 ![[图片]] 嵌入改写为 /uploads/... 地址；front matter 中的 tags 写入 tags / document_tags。
+// 返回逐个文件的处理报告。
+func (h *DocumentHandler) ImportDocuments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "请选择要导入的 ZIP 文件")
+		return
+	}
+	if file.Size > importMaxArchiveSize {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("压缩包不能超过 %d MB", importMaxArchiveSize>>20))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "读取上传文件失败")
+		return
+	}
+	defer src.Close()
+	zr, err := zip.NewReader(src, file.Size)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的 ZIP 文件")
+		return
+	}
+	if len(zr.File) > importMaxEntries {
+		api.Error(c, http.StatusBadRequest, fmt.Sprintf("压缩包内文件不能超过 %d 个", importMaxEntries))
+		return
+	}
+
+	v := &vaultImporter{
+		ctx:      c.Request.Context(),
+		db:       h.db,
+		store:    h.store,
+		userID:   userID,
+		images:   make(map[string]*zip.File),
+		uploaded: make(map[string]string),
+		failed:   make(map[string]string),
+		folders:  make(map[string]int64),
+	}
+	var docs []*zip.File
+	report := []importResult{}
+	for _, f := range zr.File {
+		name := importPath(f.Name)
+		switch {
+		case importIgnored(f.Name):
+		case isMarkdownFile(name):
+			docs = append(docs, f)
+		case imageExts[strings.ToLower(path.Ext(name))]:
+			v.images[name] = f
+		default:
+			report = append(report, importResult{Path: f.Name, Status: importSkipped, Message: "不支持的文件类型"})
+		}
+	}
+
+	for _, f := range docs {
+		res := importResult{Path: f.Name}
+		data, err := readZipFile(f)
+		switch {
+		case err != nil:
+			res.Status, res.Message = importFailed, err.Error()
+		case !utf8.Valid(data):
+			res.Status, res.Message = importFailed, "文件不是 UTF-8 编码"
+		default:
+			res.DocumentID, err = h.importMarkdown(userID, v, f.Name, string(data))
+			if err != nil {
+				res.Status, res.Message = importFailed, err.Error()
+			} else {
+				res.Status = importCreated
+			}
+		}
+		report = append(report, res)
+	}
+
+	var imagePaths []string
+	for p := range v.images {
+		imagePaths = append(imagePaths, p)
+	}
+	sort.Strings(imagePaths)
+	for _, p := range imagePaths {
+		res := importResult{Path: v.images[p].Name}
+		if u, ok := v.uploaded[p]; ok {
+			res.Status, res.URL = importCreated, u
+		} else if msg, ok := v.failed[p]; ok {
+			res.Status, res.Message = importFailed, msg
+		} else {
+			res.Status, res.Message = importSkipped, "未被任何文档引用"
+		}
+		report = append(report, res)
+	}
+
+	counts := map[string]int{}
+	for _, r := range report {
+		counts[r.Status]++
+	}
+	if counts[importCreated] > 0 {
+		h.cache.InvalidatePosts(c.Request.Context(), 0)
+	}
+	api.Success(c, gin.H{
+		"list":            report,
+		"created":         counts[importCreated],
+		"skipped":         counts[importSkipped],
+		"failed":          counts[importFailed],
+		"folders_created": v.created,
+	})
+}
+
+// importMarkdown 导入单个 Markdown 文件，返回新文档 ID；文档放入与其所在目录对应的文件夹，
+// 标题默认取文件名，front matter 中的 title、tags 与其余键由 createDocument 同步
+func (h *DocumentHandler) importMarkdown(userID int64, v *vaultImporter, name, content string) (int64, error) {
+	p := importPath(name)
+	title := strings.TrimSuffix(path.Base(p), path.Ext(p))
+	folderID, err := v.folder(path.Dir(p))
+	if err != nil {
+		return 0, errors.New("创建文件夹失败")
+	}
+	content = v.rewriteLinks(p, content)
+	saved, err := h.createDocument(userID, folderID, title, content)
+	if err != nil {
+		return 0, errors.New("创建文档失败")
+	}
+	return saved.ID, nil
+}
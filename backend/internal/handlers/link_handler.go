@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/links"
+	"markdown-editor-backend/pkg/api"
+)
+
+// revisionSourceLinks 目标文档改名后改写链接产生的修订
+const revisionSourceLinks = "links"
+
+// maxLinksPerDocument 是单篇文档最多记录的链接数，超出部分忽略
+const maxLinksPerDocument = 1000
+
+// linkTargetMaxLen 是 document_links.target 的最大字符数
+const linkTargetMaxLen = 255
+
+// documentOwner 返回文档作者 ID
+func (h *DocumentHandler) documentOwner(docID int64) (int64, error) {
+	var ownerID int64
+	err := h.db.QueryRow("SELECT user_id FROM documents WHERE id = ?", docID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// resolveLinkKeys 在作者的文档中按标题解析链接目标，返回 规范化名称 → 文档 ID；
+// 同名文档有多篇时取 ID 最小的一篇
+func (h *DocumentHandler) resolveLinkKeys(ownerID int64, keys []string) (map[string]int64, error) {
+	resolved := make(map[string]int64)
+	if len(keys) == 0 {
+		return resolved, nil
+	}
+	args := []interface{}{ownerID}
+	for _, k := range keys {
+		args = append(args, k+".md")
+	}
+	rows, err := h.db.Query(
+		"SELECT id, title FROM documents WHERE user_id = ? AND deleted_at IS NULL AND filename IN ("+
+			strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")+") ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			continue
+		}
+		if k := links.Key(title); resolved[k] == 0 {
+			resolved[k] = id
+		}
+	}
+	return resolved, rows.Err()
+}
+
+// syncLinks 重新解析文档中的链接并替换 document_links；失败只记日志，不影响保存结果
+func (h *DocumentHandler) syncLinks(docID int64, content string) {
+	if err := h.replaceLinks(docID, content); err != nil {
+		log.Printf("同步文档链接失败 doc=%d: %v", docID, err)
+	}
+}
+
+func (h *DocumentHandler) replaceLinks(docID int64, content string) error {
+	found := links.Extract(content)
+	if len(found) > maxLinksPerDocument {
+		found = found[:maxLinksPerDocument]
+	}
+	ownerID, err := h.documentOwner(docID)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, l := range found {
+		if !seen[l.Key] {
+			seen[l.Key] = true
+			keys = append(keys, l.Key)
+		}
+	}
+	resolved, err := h.resolveLinkKeys(ownerID, keys)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM document_links WHERE source_id = ?", docID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(found) > 0 {
+		args := make([]interface{}, 0, len(found)*6)
+		for _, l := range found {
+			var targetID interface{}
+			if id, ok := resolved[l.Key]; ok {
+				targetID = id
+			}
+			target := l.Target
+			if utf8.RuneCountInString(target) > linkTargetMaxLen {
+				target = string([]rune(target)[:linkTargetMaxLen])
+			}
+			key := l.Key
+			if utf8.RuneCountInString(key) > linkTargetMaxLen {
+				key = string([]rune(key)[:linkTargetMaxLen])
+			}
+			args = append(args, docID, targetID, target, key, l.Kind, l.Context)
+		}
+		values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?),", len(found)), ",")
+		if _, err := tx.Exec(
+			"INSERT INTO document_links (source_id, target_id, target, target_key, kind, context) VALUES "+values,
+			args...,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// retargetLinks 文档新建或改名后重新解析指向它的链接：
+// 原先指向它、但与新标题不再匹配的链接变为未解析；同一作者文档中与新标题匹配的未解析链接指向它
+func (h *DocumentHandler) retargetLinks(docID int64, title string) {
+	key := links.Key(title)
+	ownerID, err := h.documentOwner(docID)
+	if err == nil {
+		_, err = h.db.Exec("UPDATE document_links SET target_id = NULL WHERE target_id = ? AND target_key <> ?", docID, key)
+	}
+	if err == nil {
+		_, err = h.db.Exec(`
+			UPDATE document_links l
+			INNER JOIN documents s ON s.id = l.source_id
+			SET l.target_id = ?
+			WHERE l.target_id IS NULL AND l.target_key = ? AND s.user_id = ?
+		`, docID, key, ownerID)
+	}
+	if err != nil {
+		log.Printf("重新解析文档链接失败 doc=%d: %v", docID, err)
+	}
+}
+
+// rewriteBacklinks 文档从 oldTitle 改名后，改写作者其他文档中仍指向旧标题的链接，
+// 每篇被改写的文档记录一次修订。旧标题仍属于另一篇文档时不改写。
+// 他人持有编辑锁、或读取后又被保存过（版本冲突）的文档不改写，其 ID 列入 skipped。
+// 返回被改写的文档数与跳过的文档
+func (h *DocumentHandler) rewriteBacklinks(ctx context.Context, docID, ownerID int64, oldTitle, newTitle string) (int, []int64, error) {
+	oldKey := links.Key(oldTitle)
+	if oldKey == "" || oldKey == links.Key(newTitle) {
+		return 0, nil, nil
+	}
+	if resolved, err := h.resolveLinkKeys(ownerID, []string{oldKey}); err != nil || resolved[oldKey] != 0 {
+		return 0, nil, err
+	}
+
+	rows, err := h.db.Query(`
+		SELECT DISTINCT s.id
+		FROM document_links l
+		INNER JOIN documents s ON s.id = l.source_id AND s.deleted_at IS NULL
+		WHERE s.user_id = ? AND l.target_id IS NULL AND l.target_key = ?
+	`, ownerID, oldKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	var sources []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			sources = append(sources, id)
+		}
+	}
+	rows.Close()
+
+	rewritten := 0
+	skipped := []int64{}
+	for _, srcID := range sources {
+		var title, content string
+		var version int
+		if err := h.db.QueryRow("SELECT title, content, version FROM documents WHERE id = ? AND deleted_at IS NULL", srcID).Scan(&title, &content, &version); err != nil {
+			continue
+		}
+		updated, n := links.Rewrite(content, oldKey, newTitle)
+		if n == 0 {
+			continue
+		}
+		if h.lockedByOther(ctx, srcID, ownerID) != nil {
+			skipped = append(skipped, srcID)
+			continue
+		}
+		if _, err := h.saveContent(srcID, ownerID, title, updated, revisionSourceLinks, version); err != nil {
+			if errors.Is(err, errVersionConflict) {
+				skipped = append(skipped, srcID)
+				continue
+			}
+			return rewritten, skipped, err
+		}
+		h.cache.InvalidatePosts(ctx, srcID)
+		rewritten++
+	}
+	return rewritten, skipped, nil
+}
+
+// linkRef 是反向链接 / 未解析链接报告中的来源文档
+type linkRef struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Count     int       `json:"count"`              // 该文档中的链接数
+	Contexts  []string  `json:"contexts,omitempty"` // 链接所在行摘录
+}
+
+// GetBacklinks 链接到该文档的其他文档（仅作者），每篇附链接所在行摘录
+func (h *DocumentHandler) GetBacklinks(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT s.id, s.title, s.updated_at, l.context
+		FROM document_links l
+		INNER JOIN documents s ON s.id = l.source_id AND s.deleted_at IS NULL
+		WHERE l.target_id = ? AND s.user_id = ? AND s.id <> l.target_id
+		ORDER BY s.updated_at DESC, l.id
+	`, id, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取反向链接失败")
+		return
+	}
+	defer rows.Close()
+
+	list := []*linkRef{}
+	bySource := make(map[int64]*linkRef)
+	for rows.Next() {
+		var ref linkRef
+		var context string
+		if err := rows.Scan(&ref.ID, &ref.Title, &ref.UpdatedAt, &context); err != nil {
+			continue
+		}
+		r, exists := bySource[ref.ID]
+		if !exists {
+			r = &ref
+			bySource[ref.ID] = r
+			list = append(list, r)
+		}
+		r.Count++
+		if context != "" {
+			r.Contexts = append(r.Contexts, context)
+		}
+	}
+
+	api.Success(c, list)
+}
+
+// GetUnresolvedLinks 未解析链接报告：当前用户文档中指向不存在（或已删除）文档的链接，按目标分组，引用多的在前
+func (h *DocumentHandler) GetUnresolvedLinks(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT l.target_key, l.target, s.id, s.title, s.updated_at
+		FROM document_links l
+		INNER JOIN documents s ON s.id = l.source_id AND s.deleted_at IS NULL
+		LEFT JOIN documents t ON t.id = l.target_id AND t.deleted_at IS NULL
+		WHERE s.user_id = ? AND t.id IS NULL
+		ORDER BY l.target_key, s.id
+	`, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取未解析链接失败")
+		return
+	}
+	defer rows.Close()
+
+	type unresolved struct {
+		Target  string     `json:"target"`
+		Count   int        `json:"count"`
+		Sources []*linkRef `json:"sources"`
+	}
+	var list []*unresolved
+	byKey := make(map[string]*unresolved)
+	for rows.Next() {
+		var key, target string
+		var ref linkRef
+		if err := rows.Scan(&key, &target, &ref.ID, &ref.Title, &ref.UpdatedAt); err != nil {
+			continue
+		}
+		u, exists := byKey[key]
+		if !exists {
+			u = &unresolved{Target: target}
+			byKey[key] = u
+			list = append(list, u)
+		}
+		u.Count++
+		if n := len(u.Sources); n > 0 && u.Sources[n-1].ID == ref.ID {
+			u.Sources[n-1].Count++
+			continue
+		}
+		ref.Count = 1
+		u.Sources = append(u.Sources, &ref)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	if list == nil {
+		list = []*unresolved{}
+	}
+
+	api.Success(c, list)
+}
+
+// GetLinkGraph 当前用户的文档网络：nodes 为全部文档（含入链 / 出链数），edges 为已解析的文档间链接（同向合并计数，不含自链接）
+func (h *DocumentHandler) GetLinkGraph(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	type node struct {
+		ID       int64  `json:"id"`
+		Title    string `json:"title"`
+		FolderID *int64 `json:"folder_id"`
+		InLinks  int    `json:"in_links"`
+		OutLinks int    `json:"out_links"`
+	}
+	type edge struct {
+		Source int64 `json:"source"`
+		Target int64 `json:"target"`
+		Count  int   `json:"count"`
+	}
+
+	rows, err := h.db.Query("SELECT id, title, folder_id FROM documents WHERE user_id = ? AND deleted_at IS NULL ORDER BY id", userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+	nodes := []*node{}
+	byID := make(map[int64]*node)
+	for rows.Next() {
+		var n node
+		if err := rows.Scan(&n.ID, &n.Title, &n.FolderID); err != nil {
+			continue
+		}
+		nodes = append(nodes, &n)
+		byID[n.ID] = &n
+	}
+	rows.Close()
+
+	rows, err = h.db.Query(`
+		SELECT l.source_id, l.target_id, COUNT(*)
+		FROM document_links l
+		INNER JOIN documents s ON s.id = l.source_id AND s.deleted_at IS NULL
+		INNER JOIN documents t ON t.id = l.target_id AND t.deleted_at IS NULL
+		WHERE s.user_id = ? AND l.source_id <> l.target_id
+		GROUP BY l.source_id, l.target_id
+	`, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取链接失败")
+		return
+	}
+	defer rows.Close()
+	edges := []edge{}
+	for rows.Next() {
+		var e edge
+		if err := rows.Scan(&e.Source, &e.Target, &e.Count); err != nil {
+			continue
+		}
+		src, tgt := byID[e.Source], byID[e.Target]
+		if src == nil || tgt == nil {
+			continue
+		}
+		src.OutLinks++
+		tgt.InLinks++
+		edges = append(edges, e)
+	}
+
+	api.Success(c, gin.H{"nodes": nodes, "edges": edges})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/pkg/api"
+)
+
+// 列表接口的统一约定：
+//
+//	limit   每页条数，默认 defaultListLimit，上限 maxListLimit
+//	sort    排序字段（各接口可用字段不同），可写作 -field 表示倒序
+//	order   asc / desc；省略时文本字段正序、时间与数值字段倒序
+//	cursor  上一页响应中的 next_cursor
+//
+// 分页采用 keyset：按 (排序列, id) 比较定位，不使用 OFFSET，翻到多深都走索引。
+// 响应统一为 listPage：{list, next_cursor, has_more, limit}。
+const (
+	defaultListLimit = 20
+	maxListLimit     = 200
+)
+
+// 排序列的取值类型，决定游标中的值如何编码
+const (
+	sortString = iota
+	sortTime
+	sortInt
+)
+
+// sortField 是列表可用的排序字段
+type sortField struct {
+	Column string // SQL 列，可带表别名
+	Kind   int    // sortString / sortTime / sortInt
+}
+
+// listCursor 是编码在 next_cursor 中的翻页位置：上一页最后一条的排序值与 ID
+type listCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// listQuery 是解析后的分页与排序参数
+type listQuery struct {
+	Limit int
+	Sort  string
+	Desc  bool
+	field sortField
+	idCol string
+	after *listCursor
+	value interface{} // after.Value 按字段类型解析后的值
+}
+
+// listPage 是列表接口的统一响应；next_cursor 为 null 表示没有下一页
+type listPage struct {
+	List       interface{} `json:"list"`
+	NextCursor *string     `json:"next_cursor"`
+	HasMore    bool        `json:"has_more"`
+	Limit      int         `json:"limit"`
+}
+
+// parseListQuery 解析 limit / sort / order / cursor；fields 为该接口允许的排序字段，idCol 为 ID 列（排序的第二键）。
+// 参数无效时已写入错误响应，ok 为 false
+func parseListQuery(c *gin.Context, fields map[string]sortField, defaultSort, idCol string) (*listQuery, bool) {
+	q := &listQuery{Limit: defaultListLimit, idCol: idCol}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			api.Error(c, http.StatusBadRequest, "无效的 limit")
+			return nil, false
+		}
+		q.Limit = min(n, maxListLimit)
+	}
+
+	name := strings.TrimSpace(c.DefaultQuery("sort", defaultSort))
+	desc, explicit := false, false
+	if strings.HasPrefix(name, "-") {
+		name, desc, explicit = name[1:], true, true
+	}
+	field, found := fields[name]
+	if !found {
+		names := make([]string, 0, len(fields))
+		for n := range fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		api.Error(c, http.StatusBadRequest, "不支持的排序字段，可选: "+strings.Join(names, ", "))
+		return nil, false
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+		if !explicit {
+			desc = field.Kind != sortString
+		}
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		api.Error(c, http.StatusBadRequest, "order 只能为 asc 或 desc")
+		return nil, false
+	}
+	q.Sort, q.Desc, q.field = name, desc, field
+
+	if raw := c.Query("cursor"); raw != "" {
+		cur, value, err := q.decodeCursor(raw)
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "无效的游标")
+			return nil, false
+		}
+		if cur.Sort != q.Sort || cur.Desc != q.Desc {
+			api.Error(c, http.StatusBadRequest, "游标与当前排序参数不一致，请从第一页重新获取")
+			return nil, false
+		}
+		q.after, q.value = cur, value
+	}
+	return q, true
+}
+
+// decodeCursor 解码游标并按排序字段类型解析其中的值
+func (q *listQuery) decodeCursor(raw string) (*listCursor, interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cur listCursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return nil, nil, err
+	}
+	switch q.field.Kind {
+	case sortTime:
+		t, err := time.Parse(time.RFC3339Nano, cur.Value)
+		return &cur, t, err
+	case sortInt:
+		n, err := strconv.ParseInt(cur.Value, 10, 64)
+		return &cur, n, err
+	}
+	return &cur, cur.Value, nil
+}
+
+// where 返回游标之后的 WHERE 条件（以 AND 开头）；第一页为空
+func (q *listQuery) where() (string, []interface{}) {
+	if q.after == nil {
+		return "", nil
+	}
+	op := ">"
+	if q.Desc {
+		op = "<"
+	}
+	col := q.field.Column
+	return " AND (" + col + " " + op + " ? OR (" + col + " = ? AND " + q.idCol + " " + op + " ?))",
+		[]interface{}{q.value, q.value, q.after.ID}
+}
+
+// orderLimit 返回 ORDER BY 与 LIMIT 子句；多取一条用于判断是否还有下一页
+func (q *listQuery) orderLimit() (string, []interface{}) {
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	return " ORDER BY " + q.field.Column + dir + ", " + q.idCol + dir + " LIMIT ?", []interface{}{q.Limit + 1}
+}
+
+// encodeCursor 由一条记录的排序值与 ID 生成下一页游标
+func (q *listQuery) encodeCursor(value interface{}, id int64) string {
+	cur := listCursor{Sort: q.Sort, Desc: q.Desc, ID: id}
+	switch v := value.(type) {
+	case time.Time:
+		cur.Value = v.UTC().Format(time.RFC3339Nano)
+	case int64:
+		cur.Value = strconv.FormatInt(v, 10)
+	case string:
+		cur.Value = v
+	}
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// pageOf 截取一页结果并生成 next_cursor；items 为按 orderLimit 查出的行（最多 Limit+1 条），
+// key 返回某条记录的排序值与 ID
+func pageOf[T any](q *listQuery, items []T, key func(T) (interface{}, int64)) listPage {
+	page := listPage{List: items, Limit: q.Limit}
+	if items == nil {
+		page.List = []T{}
+	}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		value, id := key(items[len(items)-1])
+		next := q.encodeCursor(value, id)
+		page.List, page.NextCursor, page.HasMore = items, &next, true
+	}
+	return page
+}
+
+// tagFilter 要求记录带有全部 tagIDs 标签；table / fk 为关联表及其指向记录的列，如 document_tags / document_id
+func tagFilter(tagIDs []int64, col, table, fk string) (string, []interface{}) {
+	if len(tagIDs) == 0 {
+		return "", nil
+	}
+	placeholders, args := idPlaceholders(tagIDs)
+	return " AND " + col + " IN (SELECT " + fk + " FROM " + table + " WHERE tag_id IN (" + placeholders +
+		") GROUP BY " + fk + " HAVING COUNT(DISTINCT tag_id) = ?)", append(args, len(tagIDs))
+}
+
+// parseDateParam 解析 RFC 3339 时间或 YYYY-MM-DD 日期（按 UTC 零点）
+func parseDateParam(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// timeRangeFilter 解析 <name>_after（含）与 <name>_before（不含）参数，返回列 col 的时间范围条件。
+// 参数无效时已写入错误响应，ok 为 false
+func timeRangeFilter(c *gin.Context, name, col string) (where string, args []interface{}, ok bool) {
+	for _, bound := range []struct{ suffix, op string }{{"_after", " >= ?"}, {"_before", " < ?"}} {
+		raw := c.Query(name + bound.suffix)
+		if raw == "" {
+			continue
+		}
+		t, err := parseDateParam(raw)
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "无效的 "+name+bound.suffix+"，应为 RFC 3339 时间或 YYYY-MM-DD")
+			return "", nil, false
+		}
+		where += " AND " + col + bound.op
+		args = append(args, t)
+	}
+	return where, args, true
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// lockDefaultTTL 是编辑锁未指定 ttl_seconds 时的有效期；客户端应在到期前续期
+const lockDefaultTTL = 5 * time.Minute
+
+// acquireLock 获取（已持有时续期）文档编辑锁；renew 为 true 时只续期，不新建。
+// 返回当前有效的租约及其是否属于 userID：被他人持有时返回他人的租约，只续期且锁已不存在时返回 nil。
+// 配置了 Redis 时租约存于 Redis，否则存于 document_locks 表；Redis 请求失败时记日志并改用 document_locks 表
+// （Redis 恢复后故障期间表中的租约不再生效，持有者续期失败后需重新获取）
+func (h *DocumentHandler) acquireLock(ctx context.Context, docID, userID int64, username string, ttl time.Duration, renew bool) (*models.DocumentLock, bool, error) {
+	lease := models.DocumentLock{
+		DocumentID: docID,
+		UserID:     userID,
+		Username:   username,
+		ExpiresAt:  time.Now().UTC().Add(ttl).Truncate(time.Millisecond),
+	}
+	if h.cache.Enabled() {
+		data, err := json.Marshal(lease)
+		if err != nil {
+			return nil, false, err
+		}
+		held, ok, err := h.cache.LockAcquire(ctx, docID, strconv.FormatInt(userID, 10), data, ttl, renew)
+		if err == nil {
+			if len(held) == 0 {
+				return nil, false, nil
+			}
+			var current models.DocumentLock
+			if err := json.Unmarshal(held, &current); err != nil {
+				return nil, false, err
+			}
+			return &current, ok, nil
+		}
+		log.Printf("Redis 编辑锁不可用，改用数据库 doc=%d: %v", docID, err)
+	}
+
+	now := time.Now().UTC()
+	if renew {
+		if _, err := h.db.Exec(
+			"UPDATE document_locks SET expires_at = ? WHERE document_id = ? AND user_id = ? AND expires_at > ?",
+			lease.ExpiresAt, docID, userID, now,
+		); err != nil {
+			return nil, false, err
+		}
+	} else {
+		// 先清掉过期的租约；已由他人持有时 ON DUPLICATE KEY 不改动该行
+		if _, err := h.db.Exec("DELETE FROM document_locks WHERE document_id = ? AND expires_at <= ?", docID, now); err != nil {
+			return nil, false, err
+		}
+		if _, err := h.db.Exec(
+			`INSERT INTO document_locks (document_id, user_id, expires_at) VALUES (?, ?, ?)
+			 ON DUPLICATE KEY UPDATE expires_at = IF(user_id = VALUES(user_id), VALUES(expires_at), expires_at)`,
+			docID, userID, lease.ExpiresAt,
+		); err != nil {
+			return nil, false, err
+		}
+	}
+	current, err := h.dbCurrentLock(ctx, docID)
+	if err != nil || current == nil {
+		return nil, false, err
+	}
+	return current, current.UserID == userID, nil
+}
+
+// releaseLock 释放编辑锁；force 为 true 时不论持有者。返回值同 cache.LockRelease：1 已释放，0 无锁，-1 由他人持有
+func (h *DocumentHandler) releaseLock(ctx context.Context, docID, userID int64, force bool) (int, error) {
+	if h.cache.Enabled() {
+		owner := strconv.FormatInt(userID, 10)
+		if force {
+			owner = ""
+		}
+		n, err := h.cache.LockRelease(ctx, docID, owner)
+		if err == nil {
+			return n, nil
+		}
+		log.Printf("Redis 编辑锁不可用，改用数据库 doc=%d: %v", docID, err)
+	}
+
+	current, err := h.dbCurrentLock(ctx, docID)
+	if err != nil || current == nil {
+		return 0, err
+	}
+	if !force && current.UserID != userID {
+		return -1, nil
+	}
+	query, args := "DELETE FROM document_locks WHERE document_id = ?", []interface{}{docID}
+	if !force {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	result, err := h.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// currentLock 返回文档当前有效的编辑锁，无锁时为 nil；Redis 请求失败时改查 document_locks 表
+func (h *DocumentHandler) currentLock(ctx context.Context, docID int64) (*models.DocumentLock, error) {
+	if h.cache.Enabled() {
+		data, ok, err := h.cache.LockGet(ctx, docID)
+		if err == nil {
+			if !ok {
+				return nil, nil
+			}
+			var lease models.DocumentLock
+			if err := json.Unmarshal(data, &lease); err != nil {
+				return nil, err
+			}
+			return &lease, nil
+		}
+		log.Printf("Redis 编辑锁不可用，改用数据库 doc=%d: %v", docID, err)
+	}
+	return h.dbCurrentLock(ctx, docID)
+}
+
+// dbCurrentLock 从 document_locks 表读取文档当前有效的编辑锁
+func (h *DocumentHandler) dbCurrentLock(ctx context.Context, docID int64) (*models.DocumentLock, error) {
+	var lease models.DocumentLock
+	err := h.db.QueryRowContext(ctx, `
+		SELECT l.document_id, l.user_id, COALESCE(u.username, ''), l.expires_at
+		FROM document_locks l
+		LEFT JOIN users u ON u.id = l.user_id
+		WHERE l.document_id = ? AND l.expires_at > ?
+	`, docID, time.Now().UTC()).Scan(&lease.DocumentID, &lease.UserID, &lease.Username, &lease.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// lockedByOther 返回他人持有的编辑锁；无锁或由 userID 自己持有时为 nil。
+// 锁状态无法读取（Redis 与 document_locks 表都不可用）时记日志并视为无锁：编辑锁只是协作提示，
+// 不应因锁存储故障而阻止保存
+func (h *DocumentHandler) lockedByOther(ctx context.Context, docID, userID int64) *models.DocumentLock {
+	lease, err := h.currentLock(ctx, docID)
+	if err != nil {
+		log.Printf("查询编辑锁失败，按无锁处理 doc=%d: %v", docID, err)
+		return nil
+	}
+	if lease == nil || lease.UserID == userID {
+		return nil
+	}
+	return lease
+}
+
+// respondLocked 返回 423 与持有者信息
+func respondLocked(c *gin.Context, lease *models.DocumentLock) {
+	api.ErrorWithData(c, http.StatusLocked, "文档正由 "+lease.Username+" 编辑，请稍后再试", gin.H{
+		"lock": lease,
+	})
+}
+
+// checkLock 保存、删除、移动等修改文档前校验编辑锁：他人持有时已写入 423 响应，返回 false
+func (h *DocumentHandler) checkLock(c *gin.Context, docID, userID int64) bool {
+	if lease := h.lockedByOther(c.Request.Context(), docID, userID); lease != nil {
+		respondLocked(c, lease)
+		return false
+	}
+	return true
+}
+
+// lockTTL 解析请求中的有效期
+func lockTTL(c *gin.Context) (time.Duration, bool) {
+	var req models.LockRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+			return 0, false
+		}
+	}
+	if req.TTLSeconds == 0 {
+		return lockDefaultTTL, true
+	}
+	return time.Duration(req.TTLSeconds) * time.Second, true
+}
+
+// lockTarget 解析文档 ID 并校验角色
+func (h *DocumentHandler) lockTarget(c *gin.Context, min string) (docID, userID int64, role string, ok bool) {
+	userID, ok = h.getUserID(c)
+	if !ok {
+		return 0, 0, "", false
+	}
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return 0, 0, "", false
+	}
+	role, ok = h.requireRole(c, docID, userID, min)
+	return docID, userID, role, ok
+}
+
+// GetLock 查询编辑锁：GET /api/documents/:id/lock，无锁时 lock 为 null
+func (h *DocumentHandler) GetLock(c *gin.Context) {
+	docID, userID, _, ok := h.lockTarget(c, roleViewer)
+	if !ok {
+		return
+	}
+	lease, err := h.currentLock(c.Request.Context(), docID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询编辑锁失败")
+		return
+	}
+	api.Success(c, gin.H{"lock": lease, "mine": lease != nil && lease.UserID == userID})
+}
+
+// AcquireLock 获取编辑锁：POST /api/documents/:id/lock，作者与 editor 可用，body 可选 ttl_seconds（15~3600，默认 300）。
+// 已由自己持有时等同续期；他人持有时返回 423 与持有者、到期时间
+func (h *DocumentHandler) AcquireLock(c *gin.Context) {
+	docID, userID, _, ok := h.lockTarget(c, roleEditor)
+	if !ok {
+		return
+	}
+	ttl, ok := lockTTL(c)
+	if !ok {
+		return
+	}
+	lease, mine, err := h.acquireLock(c.Request.Context(), docID, userID, c.GetString("username"), ttl, false)
+	if err != nil || lease == nil {
+		api.Error(c, http.StatusInternalServerError, "获取编辑锁失败")
+		return
+	}
+	if !mine {
+		respondLocked(c, lease)
+		return
+	}
+	api.Success(c, gin.H{"lock": lease})
+}
+
+// RenewLock 续期编辑锁：PUT /api/documents/:id/lock，body 同获取。
+// 锁已过期或被释放时返回 409，客户端需重新获取；已被他人持有时返回 423
+func (h *DocumentHandler) RenewLock(c *gin.Context) {
+	docID, userID, _, ok := h.lockTarget(c, roleEditor)
+	if !ok {
+		return
+	}
+	ttl, ok := lockTTL(c)
+	if !ok {
+		return
+	}
+	lease, mine, err := h.acquireLock(c.Request.Context(), docID, userID, c.GetString("username"), ttl, true)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "续期编辑锁失败")
+		return
+	}
+	if lease == nil {
+		api.Error(c, http.StatusConflict, "编辑锁已过期，请重新获取")
+		return
+	}
+	if !mine {
+		respondLocked(c, lease)
+		return
+	}
+	api.Success(c, gin.H{"lock": lease})
+}
+
+// ReleaseLock 释放编辑锁：DELETE /api/documents/:id/lock。
+// 只能释放自己持有的锁；文档作者带 force=1 可强制解除他人的锁
+func (h *DocumentHandler) ReleaseLock(c *gin.Context) {
+	docID, userID, role, ok := h.lockTarget(c, roleEditor)
+	if !ok {
+		return
+	}
+	force := c.Query("force") == "1" || c.Query("force") == "true"
+	if force && role != roleOwner {
+		api.Error(c, http.StatusForbidden, "只有文档作者可以强制解除编辑锁")
+		return
+	}
+	n, err := h.releaseLock(c.Request.Context(), docID, userID, force)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "释放编辑锁失败")
+		return
+	}
+	if n < 0 {
+		lease, err := h.currentLock(c.Request.Context(), docID)
+		if err == nil && lease != nil {
+			respondLocked(c, lease)
+			return
+		}
+	}
+	api.Success(c, gin.H{"released": n == 1})
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/frontmatter"
+	"markdown-editor-backend/pkg/api"
+)
+
+// revisionSourceTags 通过标签接口修改标签后回写 front matter 产生的修订
+const revisionSourceTags = "tags"
+
+// front matter 中同步到独立列 / 表的键，其余键写入 document_meta
+const (
+	metaKeyTitle = "title"
+	metaKeyTags  = "tags"
+)
+
+// document_meta 列长度限制；超长的键跳过，超长的值截断
+const (
+	metaKeyMaxLen   = 100
+	metaValueMaxLen = 500
+)
+
+// maxMetaFilters 是列表 / 搜索接口单次最多接受的 meta 筛选条件数
+const maxMetaFilters = 10
+
+// metaEntry 是 document_meta 的一行
+type metaEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// frontMatterTitle 返回 front matter 中非空的 title，没有时返回 fallback
+func frontMatterTitle(content, fallback string) string {
+	meta, _, err := frontmatter.Parse(content)
+	if err != nil {
+		return fallback
+	}
+	if v, ok := frontmatter.Get(meta, metaKeyTitle); ok {
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return fallback
+}
+
+// metaString 把 YAML 标量转为字符串，对象与嵌套列表编码为 JSON
+func metaString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(val)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// metaEntries 把 front matter 中 title / tags 以外的键展开为 document_meta 行：列表值每项一行
+func metaEntries(meta yaml.MapSlice) []metaEntry {
+	var entries []metaEntry
+	for _, item := range meta {
+		key, ok := item.Key.(string)
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || key == metaKeyTitle || key == metaKeyTags || utf8.RuneCountInString(key) > metaKeyMaxLen {
+			continue
+		}
+		values := []any{item.Value}
+		if list, ok := item.Value.([]any); ok {
+			values = list
+		}
+		for _, v := range values {
+			s := metaString(v)
+			if utf8.RuneCountInString(s) > metaValueMaxLen {
+				s = string([]rune(s)[:metaValueMaxLen])
+			}
+			entries = append(entries, metaEntry{Key: key, Value: s})
+		}
+	}
+	return entries
+}
+
+// dbtx 是 *sql.DB 与 *sql.Tx 的公共子集，供既可单独执行也可放进事务的写入使用
+type dbtx interface {
+	execer
+	queryer
+}
+
+// syncFrontMatter 在保存文档的事务内把 front matter 同步到数据库：
+// tags 键存在时（含空列表）用其替换文档标签（标签属于文档作者 ownerID，缺少的自动创建）；
+// 其余键整体替换 document_meta。没有或无法解析 front matter 时清空 document_meta、不动标签。
+// title 已由 saveContent / createDocument 在写入时处理。返回需记入变更日志的标签变更，
+// 出错时调用方回滚整个保存。
+func syncFrontMatter(tx dbtx, docID, ownerID int64, content string) ([]changelog.Change, error) {
+	meta, _, err := frontmatter.Parse(content)
+	if err != nil {
+		meta = nil
+	}
+
+	var changes []changelog.Change
+	if tags, ok := frontmatter.Get(meta, metaKeyTags); ok {
+		changes, err = replaceDocumentTags(tx, docID, ownerID, frontmatter.Strings(tags))
+		if err != nil {
+			return nil, fmt.Errorf("同步 front matter 标签: %w", err)
+		}
+	}
+	if err := replaceDocumentMeta(tx, docID, metaEntries(meta)); err != nil {
+		return nil, fmt.Errorf("同步 front matter 元数据: %w", err)
+	}
+	return changes, nil
+}
+
+// replaceDocumentTags 把文档标签替换为 names 对应的标签，返回标签与关联的变更
+func replaceDocumentTags(tx dbtx, docID, ownerID int64, names []string) ([]changelog.Change, error) {
+	tagIDs, changes, err := upsertTags(tx, ownerID, names)
+	if err != nil {
+		return nil, err
+	}
+	current, err := queryIDs(tx, "SELECT tag_id FROM document_tags WHERE document_id = ?", docID)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[int64]bool, len(tagIDs))
+	for _, id := range tagIDs {
+		keep[id] = true
+	}
+	for _, id := range current {
+		if !keep[id] {
+			changes = append(changes, changelog.DocumentTag(changelog.OpDelete, docID, id))
+		}
+	}
+
+	if len(tagIDs) == 0 {
+		_, err = tx.Exec("DELETE FROM document_tags WHERE document_id = ?", docID)
+	} else {
+		placeholders, args := idPlaceholders(tagIDs)
+		_, err = tx.Exec(
+			"DELETE FROM document_tags WHERE document_id = ? AND tag_id NOT IN ("+placeholders+")",
+			append([]interface{}{docID}, args...)...,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	added, err := addDocumentTags(tx, docID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, added...), nil
+}
+
+// replaceDocumentMeta 替换文档的全部 document_meta 行
+func replaceDocumentMeta(tx execer, docID int64, entries []metaEntry) error {
+	if _, err := tx.Exec("DELETE FROM document_meta WHERE document_id = ?", docID); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(entries)*3)
+	for _, e := range entries {
+		args = append(args, docID, e.Key, e.Value)
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?),", len(entries)), ",")
+	_, err := tx.Exec("INSERT INTO document_meta (document_id, meta_key, meta_value) VALUES "+values, args...)
+	return err
+}
+
+// syncFrontMatterTags 通过标签接口修改标签后，把文档当前标签写回 front matter 的 tags。
+// 仅处理作者本人、且已有 front matter 的文档；标签集合未变化时不写入。
+// 写回作为一次保存记录修订，返回是否改写了内容及新版本号。
+func (h *DocumentHandler) syncFrontMatterTags(ctx context.Context, docID, userID int64) (bool, int, error) {
+	var title, content string
+	err := h.db.QueryRow("SELECT title, content FROM documents WHERE id = ? AND user_id = ? AND deleted_at IS NULL", docID, userID).
+		Scan(&title, &content)
+	if err == sql.ErrNoRows {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	meta, _, err := frontmatter.Parse(content)
+	if err != nil || meta == nil {
+		return false, 0, nil
+	}
+
+	rows, err := h.db.Query(
+		"SELECT t.name FROM document_tags dt INNER JOIN tags t ON t.id = dt.tag_id WHERE dt.document_id = ? ORDER BY t.name",
+		docID,
+	)
+	if err != nil {
+		return false, 0, err
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			names = append(names, name)
+		}
+	}
+	rows.Close()
+
+	if current, ok := frontmatter.Get(meta, metaKeyTags); ok && sameTagSet(frontmatter.Strings(current), names) {
+		return false, 0, nil
+	}
+	updated, err := frontmatter.Patch(content, frontmatter.Field{Key: metaKeyTags, Value: names})
+	if err != nil {
+		return false, 0, err
+	}
+	saved, err := h.saveContent(docID, userID, title, updated, revisionSourceTags, 0)
+	if err != nil {
+		return false, 0, err
+	}
+	h.cache.InvalidatePosts(ctx, docID)
+	return true, saved.Version, nil
+}
+
+// sameTagSet 忽略顺序与大小写比较两组标签名
+func sameTagSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	norm := func(list []string) []string {
+		out := make([]string, len(list))
+		for i, s := range list {
+			out[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "#")))
+		}
+		sort.Strings(out)
+		return out
+	}
+	x, y := norm(a), norm(b)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// metaFilter 解析列表 / 搜索的 meta 参数，返回附加的 WHERE 条件（col 为文档 ID 列）。
+// meta 可重复，须全部满足：meta=key 要求存在该键，meta=key:value 要求该键取值相等（列表值命中任意一项即可）。
+// 参数无效时已写入错误响应，ok 为 false。
+func metaFilter(c *gin.Context, col string) (where string, args []interface{}, ok bool) {
+	filters := c.QueryArray("meta")
+	if len(filters) > maxMetaFilters {
+		api.Error(c, http.StatusBadRequest, "meta 筛选条件最多 "+strconv.Itoa(maxMetaFilters)+" 个")
+		return "", nil, false
+	}
+	for _, f := range filters {
+		key, value, hasValue := strings.Cut(f, ":")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			api.Error(c, http.StatusBadRequest, "无效的 meta 筛选条件")
+			return "", nil, false
+		}
+		if hasValue {
+			where += " AND EXISTS (SELECT 1 FROM document_meta m WHERE m.document_id = " + col + " AND m.meta_key = ? AND m.meta_value = ?)"
+			args = append(args, key, strings.TrimSpace(value))
+		} else {
+			where += " AND EXISTS (SELECT 1 FROM document_meta m WHERE m.document_id = " + col + " AND m.meta_key = ?)"
+			args = append(args, key)
+		}
+	}
+	return where, args, true
+}
+
+// GetDocumentMeta 返回文档解析后的 front matter 与可筛选的自定义元数据；作者与被授权用户可用
+func (h *DocumentHandler) GetDocumentMeta(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if _, ok := h.requireRole(c, id, userID, roleViewer); !ok {
+		return
+	}
+
+	var content string
+	if err := h.db.QueryRow("SELECT content FROM documents WHERE id = ? AND deleted_at IS NULL", id).Scan(&content); err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+
+	meta, _, err := frontmatter.Parse(content)
+	fm := gin.H{}
+	for _, item := range meta {
+		if key, ok := item.Key.(string); ok {
+			fm[key] = item.Value
+		}
+	}
+	entries := metaEntries(meta)
+	if entries == nil {
+		entries = []metaEntry{}
+	}
+	data := gin.H{"id": id, "front_matter": fm, "meta": entries}
+	if err != nil {
+		data["parse_error"] = "front matter 不是合法的 YAML: " + err.Error()
+	}
+
+	api.Success(c, data)
+}
+
+// ListMetaKeys 当前用户文档中出现过的自定义元数据键及使用该键的文档数
+func (h *DocumentHandler) ListMetaKeys(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT m.meta_key, COUNT(DISTINCT m.document_id)
+		FROM document_meta m
+		INNER JOIN documents d ON d.id = m.document_id
+		WHERE d.user_id = ? AND d.deleted_at IS NULL
+		GROUP BY m.meta_key
+		ORDER BY m.meta_key
+	`, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取元数据失败")
+		return
+	}
+	defer rows.Close()
+
+	type keyCount struct {
+		Key           string `json:"key"`
+		DocumentCount int    `json:"document_count"`
+	}
+	list := []keyCount{}
+	for rows.Next() {
+		var k keyCount
+		if err := rows.Scan(&k.Key, &k.DocumentCount); err != nil {
+			continue
+		}
+		list = append(list, k)
+	}
+
+	api.Success(c, list)
+}
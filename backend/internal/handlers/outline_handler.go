@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/frontmatter"
+	"markdown-editor-backend/internal/markdown"
+	"markdown-editor-backend/pkg/api"
+)
+
+// outlineCacheTTL 是大纲缓存的基础存活时间；key 含版本号，过期只影响命中率
+const outlineCacheTTL = 24 * time.Hour
+
+// outlineDocument 是生成大纲所需的文档字段
+type outlineDocument struct {
+	ID        int64
+	Title     string
+	Version   int
+	UpdatedAt time.Time
+	Headings  []markdown.Heading
+}
+
+// documentHeadings 提取文档标题列表，跳过开头的 front matter，偏移仍按完整原文计算。
+// 结果按文档 ID + 版本号缓存
+func documentHeadings(ctx context.Context, c *cache.Cache, docID int64, version int, content string) []markdown.Heading {
+	key := cache.OutlineKey(docID, version)
+	if cached, ok := c.Get(ctx, key); ok {
+		var headings []markdown.Heading
+		if err := json.Unmarshal(cached, &headings); err == nil {
+			return headings
+		}
+	}
+
+	_, body, _ := frontmatter.Split(content)
+	base := len(content) - len(body)
+	headings := markdown.Headings(body)
+	for i := range headings {
+		headings[i].Offset += base
+	}
+	if b, err := json.Marshal(headings); err == nil {
+		c.Set(ctx, key, b, cache.JitterTTL(outlineCacheTTL))
+	}
+	return headings
+}
+
+// loadOutline 读取文档并生成标题列表；作者与被授权用户可用。失败时已写入错误响应
+func (h *DocumentHandler) loadOutline(c *gin.Context) (outlineDocument, bool) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return outlineDocument{}, false
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return outlineDocument{}, false
+	}
+	if _, ok := h.requireRole(c, id, userID, roleViewer); !ok {
+		return outlineDocument{}, false
+	}
+
+	doc := outlineDocument{ID: id}
+	var content string
+	err = h.db.QueryRow("SELECT title, content, version, updated_at FROM documents WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&doc.Title, &content, &doc.Version, &doc.UpdatedAt)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return outlineDocument{}, false
+	}
+	doc.Headings = documentHeadings(c.Request.Context(), h.cache, id, doc.Version, content)
+	return doc, true
+}
+
+// GetOutline 返回文档的标题树：层级、纯文本、锚点（与渲染 HTML 的 id 一致）及在原文中的字节偏移
+func (h *DocumentHandler) GetOutline(c *gin.Context) {
+	doc, ok := h.loadOutline(c)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", versionETag(doc.Version))
+	api.Success(c, gin.H{
+		"id":       doc.ID,
+		"title":    doc.Title,
+		"version":  doc.Version,
+		"count":    len(doc.Headings),
+		"headings": markdown.Outline(doc.Headings),
+	})
+}
+
+// OPML 2.0 文档结构（http://opml.org/spec2.opml）
+type opmlDocument struct {
+	XMLName xml.Name    `xml:"opml"`
+	Version string      `xml:"version,attr"`
+	Head    opmlHead    `xml:"head"`
+	Body    opmlOutline `xml:"body"`
+}
+
+type opmlHead struct {
+	Title        string `xml:"title"`
+	DateModified string `xml:"dateModified"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr,omitempty"`
+	Children []opmlOutline `xml:"outline"`
+}
+
+// opmlOutlines 把大纲树转为 OPML outline 节点
+func opmlOutlines(nodes []*markdown.Node) []opmlOutline {
+	out := make([]opmlOutline, 0, len(nodes))
+	for _, n := range nodes {
+		out = append(out, opmlOutline{Text: n.Text, Children: opmlOutlines(n.Children)})
+	}
+	return out
+}
+
+// ExportOutlineOPML 以 OPML 下载文档大纲，供思维导图工具导入；
+// 文档标题作为唯一的根节点，各级标题依次挂在其下
+func (h *DocumentHandler) ExportOutlineOPML(c *gin.Context) {
+	doc, ok := h.loadOutline(c)
+	if !ok {
+		return
+	}
+
+	root := opmlOutline{Text: doc.Title, Children: opmlOutlines(markdown.Outline(doc.Headings))}
+	out, err := xml.MarshalIndent(opmlDocument{
+		Version: "2.0",
+		Head:    opmlHead{Title: doc.Title, DateModified: doc.UpdatedAt.UTC().Format(time.RFC1123Z)},
+		Body:    opmlOutline{Children: []opmlOutline{root}},
+	}, "", "  ")
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "生成 OPML 失败")
+		return
+	}
+
+	c.Header("ETag", versionETag(doc.Version))
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": strings.TrimSuffix(doc.Title, ".md") + ".opml"})
+	if disposition == "" {
+		disposition = `attachment; filename="outline-` + strconv.FormatInt(doc.ID, 10) + `.opml"`
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Data(http.StatusOK, "text/x-opml; charset=utf-8", append([]byte(xml.Header), out...))
+}
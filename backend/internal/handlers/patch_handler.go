@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// applyEdits 把一组互不重叠的替换应用到 content 上；偏移按 UTF-16 码元计（与浏览器中 JavaScript 字符串下标一致），
+// 均相对于原内容，不能落在代理对中间。同一位置的多个插入按请求中的顺序拼接
+func applyEdits(content string, edits []models.TextEdit) (string, error) {
+	if len(edits) == 0 {
+		return content, nil
+	}
+	units := utf16.Encode([]rune(content))
+	sorted := make([]models.TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var b strings.Builder
+	b.Grow(len(content))
+	pos := 0
+	for _, e := range sorted {
+		if e.Start < 0 || e.End < e.Start || e.End > len(units) {
+			return "", fmt.Errorf("替换范围 [%d, %d) 超出文档长度 %d", e.Start, e.End, len(units))
+		}
+		if e.Start < pos {
+			return "", fmt.Errorf("替换范围 [%d, %d) 与其他替换重叠", e.Start, e.End)
+		}
+		if splitsSurrogate(units, e.Start) || splitsSurrogate(units, e.End) {
+			return "", fmt.Errorf("替换范围 [%d, %d) 拆开了一个字符的代理对", e.Start, e.End)
+		}
+		b.WriteString(string(utf16.Decode(units[pos:e.Start])))
+		b.WriteString(e.Text)
+		pos = e.End
+	}
+	b.WriteString(string(utf16.Decode(units[pos:])))
+	return b.String(), nil
+}
+
+// splitsSurrogate 判断偏移 i 是否位于一个代理对的两个码元之间
+func splitsSurrogate(units []uint16, i int) bool {
+	return i > 0 && i < len(units) && units[i-1] >= 0xD800 && units[i-1] < 0xDC00 && units[i] >= 0xDC00 && units[i] < 0xE000
+}
+
+// PatchDocument 增量保存：PATCH /api/documents/:id，作者与 editor 角色可用。
+// 请求只带相对 base_version 的替换列表，服务端应用后整体保存（记录修订、更新 file_size 与 updated_at）；
+// base_version 已不是最新版本时返回 409 并附带服务器当前内容与版本，替换范围无效时返回 400，
+// content_hash 与应用结果不符时返回 422，客户端应改用 PUT 全量保存。内容与标题都未变化时不产生新版本
+func (h *DocumentHandler) PatchDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.PatchDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	if _, ok := h.requireRole(c, id, userID, roleEditor); !ok || !h.checkLock(c, id, userID) {
+		return
+	}
+
+	var title, content string
+	var version int
+	err = h.db.QueryRow("SELECT title, content, version FROM documents WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&title, &content, &version)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "文档不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+	if version != req.BaseVersion {
+		h.respondConflict(c, id)
+		return
+	}
+
+	updated, err := applyEdits(content, req.Edits)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	hash := contentHash(updated)
+	if req.ContentHash != "" && !strings.EqualFold(req.ContentHash, hash) {
+		api.ErrorWithData(c, http.StatusUnprocessableEntity, "应用后的内容与 content_hash 不符，请改用全量保存", gin.H{
+			"version":      version,
+			"content_hash": hash,
+		})
+		return
+	}
+	newTitle := title
+	if req.Title != nil && strings.TrimSpace(*req.Title) != "" {
+		newTitle = strings.TrimSpace(*req.Title)
+	}
+
+	if updated == content && newTitle == title {
+		c.Header("ETag", versionETag(version))
+		api.Success(c, gin.H{
+			"id":           id,
+			"title":        title,
+			"filename":     mdFilename(title),
+			"file_size":    len(content),
+			"version":      version,
+			"content_hash": hash,
+		})
+		return
+	}
+
+	// 以 base_version 为 If-Match 保存：读取后若被其他会话抢先保存，同样返回 409
+	saved, err := h.saveContent(id, userID, newTitle, updated, revisionSourceUpdate, req.BaseVersion)
+	if errors.Is(err, errVersionConflict) {
+		h.respondConflict(c, id)
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "更新文档失败")
+		return
+	}
+
+	h.cache.InvalidatePosts(c.Request.Context(), id)
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, gin.H{
+		"id":           id,
+		"title":        saved.Title,
+		"filename":     saved.Filename,
+		"file_size":    saved.FileSize,
+		"version":      saved.Version,
+		"content_hash": hash,
+	})
+}
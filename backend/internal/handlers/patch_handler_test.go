@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"testing"
+
+	"markdown-editor-backend/internal/models"
+)
+
+func TestApplyEdits(t *testing.T) {
+	// "😀" 占两个 UTF-16 码元，"中" 占一个
+	content := "a😀中b"
+	cases := []struct {
+		edits []models.TextEdit
+		want  string
+	}{
+		{[]models.TextEdit{{Start: 3, End: 4, Text: "文"}}, "a😀文b"},
+		{[]models.TextEdit{{Start: 1, End: 3, Text: ""}, {Start: 5, End: 5, Text: "!"}}, "a中b!"},
+		{[]models.TextEdit{{Start: 0, End: 0, Text: "x"}, {Start: 0, End: 0, Text: "y"}}, "xya😀中b"},
+	}
+	for _, c := range cases {
+		got, err := applyEdits(content, c.edits)
+		if err != nil {
+			t.Fatalf("applyEdits(%+v): %v", c.edits, err)
+		}
+		if got != c.want {
+			t.Errorf("applyEdits(%+v) = %q，期望 %q", c.edits, got, c.want)
+		}
+	}
+
+	for _, edits := range [][]models.TextEdit{
+		{{Start: 2, End: 3, Text: ""}},                     // 起点落在代理对中间
+		{{Start: 0, End: 6, Text: ""}},                     // 超出长度
+		{{Start: 0, End: 2, Text: ""}, {Start: 1, End: 1}}, // 重叠
+	} {
+		if _, err := applyEdits(content, edits); err == nil {
+			t.Errorf("applyEdits(%+v) 应返回错误", edits)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/imaging"
 	"markdown-editor-backend/internal/models"
 	"markdown-editor-backend/pkg/api"
 )
@@ -39,34 +40,55 @@ func NewPostHandler(db *sql.DB, c *cache.Cache) *PostHandler {
 	return &PostHandler{db: db, cache: c}
 }
 
-// ListPosts 社区贴文列表：从所有用户的 documents 表读取（Markdown 文档），按更新时间倒序，分页
+// maxPostsLimit 是贴文列表每页条数上限
+const maxPostsLimit = 50
+
+// postSortFields 贴文列表固定按更新时间排序，仅用于游标翻页
+var postSortFields = map[string]sortField{
+	"updated_at": {Column: "d.updated_at", Kind: sortTime},
+}
+
+// ListPosts 社区贴文列表：所有用户已公开（visibility = public）的文档，按更新时间倒序；
+// 按列表约定用 cursor 翻页（见 parseListQuery），page 参数仍兼容但深翻页走 OFFSET，较慢。
+// 不带 cursor 的请求（首页与 page 翻页）整体缓存；rendered_html=1 时每条附带服务端渲染的 HTML
 func (h *PostHandler) ListPosts(c *gin.Context) {
+	lq, ok := parseListQuery(c, postSortFields, "updated_at", "d.id")
+	if !ok {
+		return
+	}
+	lq.Limit = min(lq.Limit, maxPostsLimit)
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	if page < 1 {
+	if page < 1 || lq.after != nil {
 		page = 1
 	}
-	if limit < 1 || limit > 50 {
-		limit = 20
+	offset := 0
+	if lq.after == nil {
+		offset = (page - 1) * lq.Limit
 	}
-	offset := (page - 1) * limit
-
-	// 缓存查询：命中直接返回；写入侧用延迟双删失效，无需在 key 中编版本号
-	cacheKey := cache.PostsListKey(page, limit)
-	if cached, ok := h.cache.Get(c.Request.Context(), cacheKey); ok {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
-		return
+	rendered := wantRenderedHTML(c)
+
+	// 缓存查询：命中直接返回；写入侧用延迟双删失效，无需在 key 中编版本号。
+	// 游标页走索引定位，代价低且组合太多，不缓存
+	cacheable := lq.after == nil && lq.Desc
+	cacheKey := cache.PostsListKey(page, lq.Limit, rendered)
+	if cacheable {
+		if cached, ok := h.cache.Get(c.Request.Context(), cacheKey); ok {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
+			return
+		}
 	}
 
+	cursorWhere, cursorArgs := lq.where()
+	tail, tailArgs := lq.orderLimit()
 	rows, err := h.db.Query(`
 		SELECT d.id, d.user_id, d.title, d.content, d.created_at, d.updated_at,
 		       COALESCE(u.username, '匿名') AS author_name,
 		       d.likes_count AS likes_count
 		FROM documents d
 		LEFT JOIN users u ON d.user_id = u.id
-		ORDER BY d.updated_at DESC
-		LIMIT ? OFFSET ?
-	`, limit, offset)
+		WHERE d.visibility = 'public' AND d.deleted_at IS NULL`+cursorWhere+tail+" OFFSET ?",
+		append(append(cursorArgs, tailArgs...), offset)...,
+	)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "获取贴文列表失败")
 		return
@@ -82,7 +104,7 @@ func (h *PostHandler) ListPosts(c *gin.Context) {
 		}
 		p.CommentsCount = 0
 		if imgURL, ok := firstImageURL(p.Content); ok {
-			urlCopy := imgURL
+			urlCopy := imageVariantURL(imgURL, imaging.ThumbnailWidth) // 列表用缩略图，详情保留原图
 			p.MediaType = strPtr("image")
 			p.MediaURL = &urlCopy
 		} else {
@@ -90,50 +112,62 @@ func (h *PostHandler) ListPosts(c *gin.Context) {
 			p.MediaURL = nil
 		}
 		p.AuthorAvatar = "https://ui-avatars.com/api/?name=" + p.AuthorName + "&background=random"
+		if rendered {
+			p.RenderedHTML, _ = renderMarkdown(c.Request.Context(), h.cache, p.Content)
+		}
 		list = append(list, p)
 	}
 
-	var total int
-	_ = h.db.QueryRow("SELECT COUNT(*) FROM documents").Scan(&total)
-
-	resp := gin.H{
-		"success": true,
-		"data": gin.H{
-			"list":  list,
-			"total": total,
-			"page":  page,
-			"limit": limit,
-		},
+	result := pageOf(lq, list, func(p models.Post) (interface{}, int64) { return p.UpdatedAt, p.ID })
+	data := gin.H{
+		"list":        result.List,
+		"next_cursor": result.NextCursor,
+		"has_more":    result.HasMore,
+		"limit":       result.Limit,
+	}
+	if lq.after == nil {
+		// 游标翻页时不再统计总数
+		var total int
+		_ = h.db.QueryRow("SELECT COUNT(*) FROM documents WHERE visibility = 'public' AND deleted_at IS NULL").Scan(&total)
+		data["total"] = total
+		data["page"] = page
+	}
+
+	body, _ := json.Marshal(gin.H{"success": true, "data": data})
+	if cacheable {
+		h.cache.Set(c.Request.Context(), cacheKey, body, cache.JitterTTL(postsCacheTTL))
 	}
-	body, _ := json.Marshal(resp)
-	h.cache.Set(c.Request.Context(), cacheKey, body, cache.JitterTTL(postsCacheTTL))
 	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
-// GetPost 贴文详情：按文档 id 获取单篇文档（公开），内容为 Markdown
+// GetPost 贴文详情：public 文档按数字 id 获取，unlisted 文档只能按链接令牌获取，内容为 Markdown；
+// 私有文档、以数字 id 访问的 unlisted 文档均按不存在处理。rendered_html=1 时附带渲染后的 HTML。
+// 只缓存 public 文档，缓存 key 按数字 id，unlisted 文档不会经由 id 命中缓存
 func (h *PostHandler) GetPost(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		api.Error(c, http.StatusBadRequest, "无效的贴文 ID")
+	ref, ok := parsePostRef(c)
+	if !ok {
 		return
 	}
 
-	cacheKey := cache.PostDetailKey(id)
-	if cached, ok := h.cache.Get(c.Request.Context(), cacheKey); ok {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
-		return
+	rendered := wantRenderedHTML(c)
+	cacheKey := ""
+	if ref.Token == "" {
+		cacheKey = cache.PostDetailKey(ref.ID, rendered)
+		if cached, ok := h.cache.Get(c.Request.Context(), cacheKey); ok {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
+			return
+		}
 	}
 
+	where, arg := ref.where()
 	var p models.Post
-	err = h.db.QueryRow(`
+	err := h.db.QueryRow(`
 		SELECT d.id, d.user_id, d.title, d.content, d.created_at, d.updated_at,
 		       COALESCE(u.username, '匿名') AS author_name,
 		       d.likes_count
 		FROM documents d
 		LEFT JOIN users u ON d.user_id = u.id
-		WHERE d.id = ?
-	`, id).Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.AuthorName, &p.LikesCount)
+		WHERE `+where, arg).Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.UpdatedAt, &p.AuthorName, &p.LikesCount)
 
 	if err == sql.ErrNoRows {
 		api.Error(c, http.StatusNotFound, "贴文不存在")
@@ -154,10 +188,15 @@ func (h *PostHandler) GetPost(c *gin.Context) {
 		p.MediaURL = nil
 	}
 	p.AuthorAvatar = "https://ui-avatars.com/api/?name=" + p.AuthorName + "&background=random"
+	if rendered {
+		p.RenderedHTML, _ = renderMarkdown(c.Request.Context(), h.cache, p.Content)
+	}
 
 	resp := gin.H{"success": true, "data": p}
 	body, _ := json.Marshal(resp)
-	h.cache.Set(c.Request.Context(), cacheKey, body, cache.JitterTTL(postsCacheTTL))
+	if cacheKey != "" {
+		h.cache.Set(c.Request.Context(), cacheKey, body, cache.JitterTTL(postsCacheTTL))
+	}
 	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
@@ -174,15 +213,16 @@ func (h *PostHandler) LikePost(c *gin.Context) {
 	if !ok {
 		return
 	}
-	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		api.Error(c, http.StatusBadRequest, "无效的贴文 ID")
+	ref, ok := parsePostRef(c)
+	if !ok {
 		return
 	}
 
-	// 验证文档存在
+	// 验证文档存在且对外可见（私有文档不可点赞，unlisted 文档须凭链接令牌）
+	where, arg := ref.where()
+	var docID int64
 	var base int
-	err = h.db.QueryRow("SELECT likes_count FROM documents WHERE id = ?", docID).Scan(&base)
+	err := h.db.QueryRow("SELECT d.id, d.likes_count FROM documents d WHERE "+where, arg).Scan(&docID, &base)
 	if err == sql.ErrNoRows {
 		api.Error(c, http.StatusNotFound, "贴文不存在")
 		return
@@ -218,15 +258,23 @@ func (h *PostHandler) LikePost(c *gin.Context) {
 	api.Success(c, gin.H{"likes_count": current, "already_liked": false})
 }
 
-// UnlikePost 取消点赞：与 LikePost 对称。
+// UnlikePost 取消点赞：与 LikePost 对称，unlisted 文档同样须凭链接令牌。
 func (h *PostHandler) UnlikePost(c *gin.Context) {
 	userID, ok := h.getUserID(c)
 	if !ok {
 		return
 	}
-	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	ref, ok := parsePostRef(c)
+	if !ok {
+		return
+	}
+	docID, err := resolvePost(h.db, ref)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "贴文不存在")
+		return
+	}
 	if err != nil {
-		api.Error(c, http.StatusBadRequest, "无效的贴文 ID")
+		api.Error(c, http.StatusInternalServerError, "查询失败")
 		return
 	}
 
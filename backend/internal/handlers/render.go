@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/markdown"
+	"markdown-editor-backend/pkg/api"
+)
+
+// renderCacheTTL 是渲染结果缓存的基础存活时间；key 由内容哈希决定，过期只影响命中率
+const renderCacheTTL = 24 * time.Hour
+
+// contentHash 返回 Markdown 原文的 sha256 十六进制串
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderMarkdown 渲染并清洗 Markdown，结果按内容哈希缓存；返回 HTML 与内容哈希
+func renderMarkdown(ctx context.Context, c *cache.Cache, content string) (html, hash string) {
+	hash = contentHash(content)
+	key := cache.RenderKey(hash)
+	if cached, ok := c.Get(ctx, key); ok {
+		return string(cached), hash
+	}
+	html = markdown.Render(content)
+	c.Set(ctx, key, []byte(html), cache.JitterTTL(renderCacheTTL))
+	return html, hash
+}
+
+// wantRenderedHTML 判断请求是否带 rendered_html=1 / true
+func wantRenderedHTML(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("rendered_html"))
+	return v
+}
+
+// RenderDocument 返回文档经服务端渲染并清洗后的 HTML；作者与被授权用户（viewer 及以上）可用
+func (h *DocumentHandler) RenderDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	if _, ok := h.requireRole(c, id, userID, roleViewer); !ok {
+		return
+	}
+
+	var title, content string
+	var version int
+	err = h.db.QueryRow("SELECT title, content, version FROM documents WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&title, &content, &version)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "文档不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+
+	html, hash := renderMarkdown(c.Request.Context(), h.cache, content)
+	c.Header("ETag", versionETag(version))
+	api.Success(c, gin.H{
+		"id":           id,
+		"title":        title,
+		"version":      version,
+		"html":         html,
+		"content_hash": hash,
+	})
+}
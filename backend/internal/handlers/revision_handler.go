@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/diff"
+	"markdown-editor-backend/internal/links"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 修订来源
+const (
+	revisionSourceCreate  = "create"
+	revisionSourceUpdate  = "update"
+	revisionSourceRestore = "restore"
+)
+
+// insertRevision 在事务内记录一条修订快照，version 为该次保存后的文档版本号
+func insertRevision(tx *sql.Tx, docID, userID int64, title, content, source string, version int) error {
+	_, err := tx.Exec(
+		"INSERT INTO document_revisions (document_id, user_id, title, content, file_size, source, version) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		docID, userID, title, content, int64(len([]byte(content))), source, version,
+	)
+	return err
+}
+
+// savedDocument 是 saveContent / createDocument 写入后的结果
+type savedDocument struct {
+	ID        int64
+	OwnerID   int64  // 文档作者，变更日志记在作者名下
+	Title     string // front matter 有 title 时为其值
+	PrevTitle string // 保存前的标题，新建时为空
+	Filename  string
+	FileSize  int64
+	Version   int
+}
+
+// saveContent 更新文档标题与内容、记录修订、同步 front matter 并写入变更日志（同一事务），提交后执行 afterSave 并按保留策略清理旧修订。
+// 内容带 front matter title 时以其为标题。
+// ifVersion > 0 时要求文档当前版本与之相等，否则返回 errVersionConflict；
+// 版本读取使用 FOR UPDATE 行锁，保证校验与写入之间不会插入其他保存。
+// userID 记为修订作者；调用方需已确认文档存在且该用户有编辑权限。
+func (h *DocumentHandler) saveContent(docID, userID int64, title, content, source string, ifVersion int) (savedDocument, error) {
+	title = frontMatterTitle(content, title)
+	saved := savedDocument{
+		ID:       docID,
+		Title:    title,
+		Filename: mdFilename(title),
+		FileSize: int64(len([]byte(content))),
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return saved, err
+	}
+	var current int
+	if err := tx.QueryRow("SELECT version, title, user_id FROM documents WHERE id = ? AND deleted_at IS NULL FOR UPDATE", docID).Scan(&current, &saved.PrevTitle, &saved.OwnerID); err != nil {
+		tx.Rollback()
+		return saved, err
+	}
+	if ifVersion > 0 && current != ifVersion {
+		tx.Rollback()
+		return saved, errVersionConflict
+	}
+	saved.Version = current + 1
+
+	if _, err := tx.Exec(
+		"UPDATE documents SET title = ?, filename = ?, content = ?, file_size = ?, version = ?, updated_at = NOW() WHERE id = ?",
+		title, saved.Filename, content, saved.FileSize, saved.Version, docID,
+	); err != nil {
+		tx.Rollback()
+		return saved, err
+	}
+	if err := insertRevision(tx, docID, userID, title, content, source, saved.Version); err != nil {
+		tx.Rollback()
+		return saved, err
+	}
+	if err := recordSave(tx, saved, content); err != nil {
+		tx.Rollback()
+		return saved, err
+	}
+	if err := tx.Commit(); err != nil {
+		return saved, err
+	}
+
+	h.afterSave(saved, content)
+	h.pruneRevisions(docID)
+	return saved, nil
+}
+
+// recordSave 在保存文档的事务内同步 front matter（见 syncFrontMatter）并写入变更日志
+func recordSave(tx *sql.Tx, saved savedDocument, content string) error {
+	changes, err := syncFrontMatter(tx, saved.ID, saved.OwnerID, content)
+	if err != nil {
+		return err
+	}
+	_, err = changelog.RecordTx(tx, saved.OwnerID, append([]changelog.Change{changelog.Upsert(changelog.EntityDocument, saved.ID)}, changes...)...)
+	return err
+}
+
+// afterSave 文档写入提交后的同步：链接索引与附件关联，标题变化时重新解析指向它的链接。
+// front matter 的标签、元数据与变更日志已在保存事务内写入（见 recordSave）
+func (h *DocumentHandler) afterSave(saved savedDocument, content string) {
+	h.syncLinks(saved.ID, content)
+	h.linkContentAttachments(saved.ID, content)
+	if links.Key(saved.PrevTitle) != links.Key(saved.Title) {
+		h.retargetLinks(saved.ID, saved.Title)
+	}
+}
+
+// pruneRevisions 按 RevisionConfig 清理旧修订；失败只记日志，不影响保存结果。
+// 最新一条修订始终保留。
+func (h *DocumentHandler) pruneRevisions(docID int64) {
+	if max := h.revision.MaxPerDocument; max > 0 {
+		var cutoff int64
+		err := h.db.QueryRow(
+			"SELECT id FROM document_revisions WHERE document_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?",
+			docID, max-1,
+		).Scan(&cutoff)
+		if err == nil {
+			if _, err := h.db.Exec("DELETE FROM document_revisions WHERE document_id = ? AND id < ?", docID, cutoff); err != nil {
+				log.Printf("清理修订失败 doc=%d: %v", docID, err)
+			}
+		} else if err != sql.ErrNoRows {
+			log.Printf("查询修订失败 doc=%d: %v", docID, err)
+		}
+	}
+
+	if days := h.revision.RetentionDays; days > 0 {
+		var latest sql.NullInt64
+		if err := h.db.QueryRow("SELECT MAX(id) FROM document_revisions WHERE document_id = ?", docID).Scan(&latest); err != nil || !latest.Valid {
+			return
+		}
+		if _, err := h.db.Exec(
+			"DELETE FROM document_revisions WHERE document_id = ? AND id < ? AND created_at < DATE_SUB(NOW(), INTERVAL ? DAY)",
+			docID, latest.Int64, days,
+		); err != nil {
+			log.Printf("清理过期修订失败 doc=%d: %v", docID, err)
+		}
+	}
+}
+
+// ownsDocument 校验文档存在且属于当前用户；不满足时已写入错误响应
+func (h *DocumentHandler) ownsDocument(c *gin.Context, docID, userID int64) bool {
+	var count int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM documents WHERE id = ? AND user_id = ? AND deleted_at IS NULL", docID, userID).Scan(&count); err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return false
+	}
+	if count == 0 {
+		api.Error(c, http.StatusNotFound, "文档不存在")
+		return false
+	}
+	return true
+}
+
+// getRevision 读取某文档下的一条完整修订
+func (h *DocumentHandler) getRevision(docID, revID int64) (models.DocumentRevision, error) {
+	var r models.DocumentRevision
+	err := h.db.QueryRow(
+		"SELECT id, document_id, user_id, title, content, file_size, source, version, created_at FROM document_revisions WHERE id = ? AND document_id = ?",
+		revID, docID,
+	).Scan(&r.ID, &r.DocumentID, &r.UserID, &r.Title, &r.Content, &r.FileSize, &r.Source, &r.Version, &r.CreatedAt)
+	return r, err
+}
+
+// ListRevisions 文档修订列表（不含内容），按时间倒序
+func (h *DocumentHandler) ListRevisions(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	rows, err := h.db.Query(
+		"SELECT id, document_id, user_id, title, file_size, source, version, created_at FROM document_revisions WHERE document_id = ? ORDER BY id DESC",
+		id,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取修订列表失败")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.DocumentRevision{}
+	for rows.Next() {
+		var r models.DocumentRevision
+		if err := rows.Scan(&r.ID, &r.DocumentID, &r.UserID, &r.Title, &r.FileSize, &r.Source, &r.Version, &r.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, r)
+	}
+
+	api.Success(c, gin.H{"list": list})
+}
+
+// GetRevision 获取单条修订（含内容）
+func (h *DocumentHandler) GetRevision(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	revID, err := strconv.ParseInt(c.Param("revId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的修订 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	r, err := h.getRevision(id, revID)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "修订不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取修订失败")
+		return
+	}
+
+	api.Success(c, r)
+}
+
+// DiffRevisions 对比两条修订的按行差异：?from=修订ID&to=修订ID；to 省略时与文档当前内容对比
+func (h *DocumentHandler) DiffRevisions(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	fromID, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的修订 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	from, err := h.getRevision(id, fromID)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "修订不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取修订失败")
+		return
+	}
+
+	var toContent string
+	var toID int64
+	if toStr := c.Query("to"); toStr != "" {
+		toID, err = strconv.ParseInt(toStr, 10, 64)
+		if err != nil {
+			api.Error(c, http.StatusBadRequest, "无效的修订 ID")
+			return
+		}
+		to, err := h.getRevision(id, toID)
+		if err == sql.ErrNoRows {
+			api.Error(c, http.StatusNotFound, "修订不存在")
+			return
+		}
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "获取修订失败")
+			return
+		}
+		toContent = to.Content
+	} else if err := h.db.QueryRow("SELECT content FROM documents WHERE id = ?", id).Scan(&toContent); err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+
+	chunks, stats := diff.Lines(from.Content, toContent)
+	api.Success(c, gin.H{
+		"from":   fromID,
+		"to":     toID, // 0 表示文档当前内容
+		"chunks": chunks,
+		"stats":  stats,
+	})
+}
+
+// RestoreRevision 将旧修订的标题与内容作为一次新的保存写回文档（原有修订保持不变）
+func (h *DocumentHandler) RestoreRevision(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	revID, err := strconv.ParseInt(c.Param("revId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的修订 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) || !h.checkLock(c, id, userID) {
+		return
+	}
+
+	r, err := h.getRevision(id, revID)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "修订不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取修订失败")
+		return
+	}
+
+	saved, err := h.saveContent(id, userID, r.Title, r.Content, revisionSourceRestore, 0)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "还原修订失败")
+		return
+	}
+
+	h.cache.InvalidatePosts(c.Request.Context(), id)
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, gin.H{
+		"id":            id,
+		"title":         r.Title,
+		"filename":      saved.Filename,
+		"file_size":     saved.FileSize,
+		"version":       saved.Version,
+		"restored_from": revID,
+	})
+}
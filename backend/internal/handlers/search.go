@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ngramTokenSize 与 MySQL 的 ngram_token_size 保持一致（默认 2）。
+// 短于该长度的词无法命中 FULLTEXT 索引，改用 LIKE 兜底。
+const ngramTokenSize = 2
+
+// snippetRunes 是搜索结果片段的长度（字符数）
+const snippetRunes = 120
+
+// searchQuery 是解析后的搜索词：Terms 为普通词，Phrases 为引号包裹的短语。
+type searchQuery struct {
+	Terms   []string
+	Phrases []string
+}
+
+// all 返回全部词与短语，用于高亮
+func (q searchQuery) all() []string {
+	return append(append([]string{}, q.Phrases...), q.Terms...)
+}
+
+// parseSearchQuery 解析用户输入：双引号内为短语，其余按空白切分；
+// 去掉 MySQL 布尔模式的运算符，避免用户输入改变查询语义。
+func parseSearchQuery(input string) searchQuery {
+	var q searchQuery
+	parts := strings.Split(input, `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if p := cleanSearchTerm(part); p != "" {
+				q.Phrases = append(q.Phrases, p)
+			}
+			continue
+		}
+		for _, f := range strings.Fields(part) {
+			if t := cleanSearchTerm(f); t != "" {
+				q.Terms = append(q.Terms, t)
+			}
+		}
+	}
+	return q
+}
+
+var booleanOperators = strings.NewReplacer(
+	"+", " ", "-", " ", "<", " ", ">", " ", "(", " ", ")", " ",
+	"~", " ", "*", " ", "@", " ", `"`, " ",
+)
+
+func cleanSearchTerm(s string) string {
+	return strings.Join(strings.Fields(booleanOperators.Replace(s)), " ")
+}
+
+// booleanQuery 生成 MATCH ... AGAINST (? IN BOOLEAN MODE) 的查询串，所有词与短语都必须命中。
+// 返回的 short 为长度不足 ngram 的词，需由调用方用 LIKE 过滤。
+func (q searchQuery) booleanQuery() (against string, short []string) {
+	var b strings.Builder
+	add := func(s string) {
+		if utf8.RuneCountInString(s) < ngramTokenSize {
+			short = append(short, s)
+			return
+		}
+		// ngram 解析器把每个词当作 ngram 短语检索，统一用引号包裹
+		b.WriteString(`+"` + s + `" `)
+	}
+	for _, p := range q.Phrases {
+		add(p)
+	}
+	for _, t := range q.Terms {
+		add(t)
+	}
+	return strings.TrimSpace(b.String()), short
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// highlight 对文本做 HTML 转义并用 <mark> 包裹所有命中的词（不区分大小写）
+func highlight(text string, words []string) string {
+	type span struct{ start, end int }
+	var spans []span
+	for _, w := range words {
+		for from := 0; ; {
+			start, end := foldIndex(text, w, from)
+			if start < 0 {
+				break
+			}
+			spans = append(spans, span{start, end})
+			from = end
+		}
+	}
+	if len(spans) == 0 {
+		return html.EscapeString(text)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			if s.end > pos {
+				// 与上一段重叠：补上超出部分，相邻的 </mark><mark> 最后会被合并
+				b.WriteString("<mark>")
+				b.WriteString(html.EscapeString(text[pos:s.end]))
+				b.WriteString("</mark>")
+				pos = s.end
+			}
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:s.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[s.start:s.end]))
+		b.WriteString("</mark>")
+		pos = s.end
+	}
+	b.WriteString(html.EscapeString(text[pos:]))
+	return strings.ReplaceAll(b.String(), "</mark><mark>", "")
+}
+
+// buildSnippet 截取首个命中位置附近的内容并高亮；未命中时取开头
+func buildSnippet(content string, words []string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	first := -1
+	for _, w := range words {
+		if i, _ := foldIndex(content, w, 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	runes := []rune(content)
+	start := 0
+	if first > 0 {
+		start = utf8.RuneCountInString(content[:first]) - snippetRunes/4
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := min(start+snippetRunes, len(runes))
+
+	snippet := highlight(string(runes[start:end]), words)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// foldIndex 从 s[from:] 起不区分大小写地查找 sub，返回命中区间在 s 中的字节偏移，未命中时为 -1。
+// 直接比较原文而不是 ToLower 之后的副本：大小写转换可能改变字节长度，偏移会错位
+func foldIndex(s, sub string, from int) (start, end int) {
+	if sub == "" {
+		return -1, -1
+	}
+	first, _ := utf8.DecodeRuneInString(sub)
+	for i := from; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if equalFoldRune(r, first) {
+			if n := foldPrefix(s[i:], sub); n >= 0 {
+				return i, i + n
+			}
+		}
+		i += size
+	}
+	return -1, -1
+}
+
+// foldPrefix 判断 s 是否以 sub 开头（不区分大小写），是则返回 s 中对应部分的字节长度，否则返回 -1
+func foldPrefix(s, sub string) int {
+	n := 0
+	for _, want := range sub {
+		if n >= len(s) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !equalFoldRune(r, want) {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// equalFoldRune 判断两个字符在 Unicode 简单大小写折叠下是否相同
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
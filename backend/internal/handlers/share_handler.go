@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/utils"
+	"markdown-editor-backend/pkg/api"
+)
+
+// 文档访问角色，权限依次递增
+const (
+	roleViewer    = "viewer"    // 只读
+	roleCommenter = "commenter" // 只读 + 发表评论，不能修改内容
+	roleEditor    = "editor"    // 可编辑内容
+	roleOwner     = "owner"     // 作者本人，不可授予
+)
+
+var roleRank = map[string]int{
+	roleViewer:    1,
+	roleCommenter: 2,
+	roleEditor:    3,
+	roleOwner:     4,
+}
+
+// shareLinkMaxHours 是分享链接有效期上限（一年）
+const shareLinkMaxHours = 24 * 365
+
+// sharePasswordHeader 是访问带密码分享链接时携带密码的请求头。
+// 不接受查询参数，避免密码出现在访问日志、浏览器历史与 Referer 中
+const sharePasswordHeader = "X-Share-Password"
+
+// documentRole 返回用户对文档的角色：owner / editor / commenter / viewer；
+// 文档不存在、已删除或无权访问时返回空串
+func (h *DocumentHandler) documentRole(docID, userID int64) (string, error) {
+	var ownerID int64
+	var role sql.NullString
+	err := h.db.QueryRow(`
+		SELECT d.user_id, s.role
+		FROM documents d
+		LEFT JOIN document_shares s ON s.document_id = d.id AND s.user_id = ?
+		WHERE d.id = ? AND d.deleted_at IS NULL
+	`, userID, docID).Scan(&ownerID, &role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if ownerID == userID {
+		return roleOwner, nil
+	}
+	return role.String, nil
+}
+
+// requireRole 校验用户对文档至少具有 min 角色，返回实际角色；不满足时已写入错误响应。
+// 无任何权限时返回 404，不暴露文档是否存在
+func (h *DocumentHandler) requireRole(c *gin.Context, docID, userID int64, min string) (string, bool) {
+	role, err := h.documentRole(docID, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return "", false
+	}
+	if role == "" {
+		api.Error(c, http.StatusNotFound, "文档不存在")
+		return "", false
+	}
+	if roleRank[role] < roleRank[min] {
+		api.Error(c, http.StatusForbidden, "没有权限执行该操作")
+		return "", false
+	}
+	return role, true
+}
+
+// shareLinkSignature 对链接 ID 做 HMAC-SHA256 签名
+func (h *DocumentHandler) shareLinkSignature(linkID int64) string {
+	mac := hmac.New(sha256.New, h.shareSecret)
+	mac.Write([]byte("share-link:" + strconv.FormatInt(linkID, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// shareLinkToken 生成分享链接令牌：<链接ID>.<签名>
+func (h *DocumentHandler) shareLinkToken(linkID int64) string {
+	return strconv.FormatInt(linkID, 10) + "." + h.shareLinkSignature(linkID)
+}
+
+// parseShareLinkToken 校验令牌签名并返回链接 ID
+func (h *DocumentHandler) parseShareLinkToken(token string) (int64, bool) {
+	idStr, sig, found := strings.Cut(token, ".")
+	if !found {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(h.shareLinkSignature(id))) {
+		return 0, false
+	}
+	return id, true
+}
+
+// ListSharedDocuments 他人共享给当前用户的文档（不含内容），按更新时间倒序
+func (h *DocumentHandler) ListSharedDocuments(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT d.id, d.user_id, d.title, d.filename, d.file_size, d.version, d.created_at, d.updated_at, u.username, s.role
+		FROM document_shares s
+		INNER JOIN documents d ON d.id = s.document_id AND d.deleted_at IS NULL
+		INNER JOIN users u ON u.id = d.user_id
+		WHERE s.user_id = ?
+		ORDER BY d.updated_at DESC
+	`, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取共享文档失败")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.SharedDocument{}
+	for rows.Next() {
+		var d models.SharedDocument
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Title, &d.Filename, &d.FileSize, &d.Version, &d.CreatedAt, &d.UpdatedAt, &d.Owner, &d.Role); err != nil {
+			continue
+		}
+		list = append(list, d)
+	}
+
+	api.Success(c, list)
+}
+
+// ListShares 列出文档的用户授权与未吊销的分享链接（仅作者）
+func (h *DocumentHandler) ListShares(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT s.id, s.document_id, s.user_id, u.username, s.role, s.created_at
+		FROM document_shares s
+		INNER JOIN users u ON u.id = s.user_id
+		WHERE s.document_id = ?
+		ORDER BY s.created_at
+	`, id)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取共享列表失败")
+		return
+	}
+	defer rows.Close()
+	users := []models.DocumentShare{}
+	for rows.Next() {
+		var s models.DocumentShare
+		if err := rows.Scan(&s.ID, &s.DocumentID, &s.UserID, &s.Username, &s.Role, &s.CreatedAt); err != nil {
+			continue
+		}
+		users = append(users, s)
+	}
+
+	linkRows, err := h.db.Query(
+		"SELECT id, document_id, password_hash IS NOT NULL, expires_at, created_at FROM document_share_links WHERE document_id = ? AND revoked_at IS NULL ORDER BY id",
+		id,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取分享链接失败")
+		return
+	}
+	defer linkRows.Close()
+	links := []models.ShareLink{}
+	for linkRows.Next() {
+		var l models.ShareLink
+		if err := linkRows.Scan(&l.ID, &l.DocumentID, &l.HasPassword, &l.ExpiresAt, &l.CreatedAt); err != nil {
+			continue
+		}
+		l.Token = h.shareLinkToken(l.ID)
+		links = append(links, l)
+	}
+
+	api.Success(c, gin.H{"users": users, "links": links})
+}
+
+// ShareDocument 按用户名授权他人访问文档（仅作者）；已授权时更新角色
+func (h *DocumentHandler) ShareDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.ShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	if req.Role != roleViewer && req.Role != roleCommenter && req.Role != roleEditor {
+		api.Error(c, http.StatusBadRequest, "role 只能是 viewer、commenter 或 editor")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	var s models.DocumentShare
+	err = h.db.QueryRow("SELECT id, username FROM users WHERE username = ?", strings.TrimSpace(req.Username)).Scan(&s.UserID, &s.Username)
+	if err == sql.ErrNoRows {
+		api.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+	if s.UserID == userID {
+		api.Error(c, http.StatusBadRequest, "不能共享给自己")
+		return
+	}
+
+	if _, err := h.db.Exec(
+		"INSERT INTO document_shares (document_id, user_id, role, created_by) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE role = VALUES(role)",
+		id, s.UserID, req.Role, userID,
+	); err != nil {
+		api.Error(c, http.StatusInternalServerError, "共享文档失败")
+		return
+	}
+	err = h.db.QueryRow("SELECT id, created_at FROM document_shares WHERE document_id = ? AND user_id = ?", id, s.UserID).
+		Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "共享文档失败")
+		return
+	}
+	s.DocumentID = id
+	s.Role = req.Role
+
+	api.Success(c, s)
+}
+
+// RevokeShare 撤销某个用户对文档的授权（仅作者）
+func (h *DocumentHandler) RevokeShare(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	targetID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的用户 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM document_shares WHERE document_id = ? AND user_id = ?", id, targetID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "撤销共享失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		api.Error(c, http.StatusNotFound, "该用户没有此文档的权限")
+		return
+	}
+
+	api.Success(c, gin.H{"message": "已撤销共享"})
+}
+
+// CreateShareLink 创建分享链接（仅作者），返回可匿名只读访问的令牌
+func (h *DocumentHandler) CreateShareLink(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.CreateShareLinkRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+			return
+		}
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > shareLinkMaxHours {
+		api.Error(c, http.StatusBadRequest, "expires_in_hours 须在 0 到 "+strconv.Itoa(shareLinkMaxHours)+" 之间")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	link := models.ShareLink{DocumentID: id, CreatedAt: time.Now()}
+	var passwordHash *string
+	if req.Password != "" {
+		hashed, err := utils.HashPassword(req.Password)
+		if err != nil {
+			api.Error(c, http.StatusInternalServerError, "创建分享链接失败")
+			return
+		}
+		passwordHash = &hashed
+		link.HasPassword = true
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := link.CreatedAt.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+
+	result, err := h.db.Exec(
+		"INSERT INTO document_share_links (document_id, created_by, password_hash, expires_at) VALUES (?, ?, ?, ?)",
+		id, userID, passwordHash, link.ExpiresAt,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "创建分享链接失败")
+		return
+	}
+	link.ID, _ = result.LastInsertId()
+	link.Token = h.shareLinkToken(link.ID)
+
+	api.Success(c, link)
+}
+
+// RevokeShareLink 吊销分享链接（仅作者），令牌随即失效
+func (h *DocumentHandler) RevokeShareLink(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+	linkID, err := strconv.ParseInt(c.Param("linkId"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的链接 ID")
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	result, err := h.db.Exec(
+		"UPDATE document_share_links SET revoked_at = NOW() WHERE id = ? AND document_id = ? AND revoked_at IS NULL",
+		linkID, id,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "吊销分享链接失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		api.Error(c, http.StatusNotFound, "分享链接不存在")
+		return
+	}
+
+	api.Success(c, gin.H{"message": "已吊销分享链接"})
+}
+
+// ViewShareLink 凭分享链接令牌匿名只读访问文档：GET /api/share/:token。
+// 带密码的链接须通过 X-Share-Password 请求头提供密码；同一链接、同一 IP 在 15 分钟内
+// 密码错误 5 次后返回 429，窗口结束前不再校验（bcrypt 开销大，也防止暴力猜测）；
+// rendered_html=1 时附带服务端渲染的 HTML
+func (h *DocumentHandler) ViewShareLink(c *gin.Context) {
+	linkID, ok := h.parseShareLinkToken(c.Param("token"))
+	if !ok {
+		api.Error(c, http.StatusNotFound, "分享链接无效")
+		return
+	}
+
+	var (
+		passwordHash sql.NullString
+		expiresAt    *time.Time
+		revokedAt    *time.Time
+		d            models.Document
+		author       string
+	)
+	err := h.db.QueryRow(`
+		SELECT l.password_hash, l.expires_at, l.revoked_at,
+		       d.id, d.title, d.content, d.version, d.created_at, d.updated_at, u.username
+		FROM document_share_links l
+		INNER JOIN documents d ON d.id = l.document_id AND d.deleted_at IS NULL
+		INNER JOIN users u ON u.id = d.user_id
+		WHERE l.id = ?
+	`, linkID).Scan(&passwordHash, &expiresAt, &revokedAt, &d.ID, &d.Title, &d.Content, &d.Version, &d.CreatedAt, &d.UpdatedAt, &author)
+	if err == sql.ErrNoRows || (err == nil && revokedAt != nil) {
+		api.Error(c, http.StatusNotFound, "分享链接无效")
+		return
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取文档失败")
+		return
+	}
+	if expiresAt != nil && time.Now().After(*expiresAt) {
+		api.Error(c, http.StatusGone, "分享链接已过期")
+		return
+	}
+	if passwordHash.Valid {
+		password := c.GetHeader(sharePasswordHeader)
+		if password == "" {
+			api.ErrorWithData(c, http.StatusUnauthorized, "该分享链接需要访问密码", gin.H{"password_required": true})
+			return
+		}
+		ctx := c.Request.Context()
+		scope := "share:" + strconv.FormatInt(linkID, 10) + ":" + c.ClientIP()
+		if blocked, wait := h.sharePwd.blocked(ctx, scope); blocked {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			api.Error(c, http.StatusTooManyRequests, "密码错误次数过多，请稍后再试")
+			return
+		}
+		if !utils.CheckPasswordHash(password, passwordHash.String) {
+			h.sharePwd.fail(ctx, scope)
+			api.ErrorWithData(c, http.StatusForbidden, "访问密码错误", gin.H{"password_required": true})
+			return
+		}
+		h.sharePwd.reset(ctx, scope)
+	}
+
+	data := gin.H{
+		"id":         d.ID,
+		"title":      d.Title,
+		"content":    d.Content,
+		"version":    d.Version,
+		"author":     author,
+		"role":       roleViewer,
+		"created_at": d.CreatedAt,
+		"updated_at": d.UpdatedAt,
+		"expires_at": expiresAt,
+	}
+	if wantRenderedHTML(c) {
+		data["rendered_html"], _ = renderMarkdown(c.Request.Context(), h.cache, d.Content)
+	}
+	c.Header("Cache-Control", "private, no-store")
+	api.Success(c, data)
+}
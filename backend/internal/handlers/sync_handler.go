@@ -0,0 +1,1092 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// 变更流分页：默认与最大条数
+const (
+	syncDefaultLimit = 100
+	syncMaxLimit     = 500
+)
+
+// 推送结果状态
+const (
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncNotFound = "not_found"
+	syncRejected = "rejected"
+	syncLocked   = "locked"
+	syncError    = "error"
+)
+
+// errStaleRecord 表示标签或任务的 version 与客户端基于的不一致
+var errStaleRecord = errors.New("record modified since base")
+
+// errTagNameTaken 表示改名后的标签名已被该用户的其他标签使用
+var errTagNameTaken = errors.New("tag name taken")
+
+// clientIDMaxLen 是新建记录的 client_id 最大长度（见 sync_client_ids 表）
+const clientIDMaxLen = 64
+
+// 任务状态与优先级的取值（见 tasks 表注释）
+var (
+	taskStatuses   = map[string]bool{"pending": true, "in_progress": true, "completed": true}
+	taskPriorities = map[string]bool{"low": true, "medium": true, "high": true}
+)
+
+// queryer 是 *sql.DB 与 *sql.Tx 共有的查询方法
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryIDs 执行只返回一列 ID 的查询
+func queryIDs(q queryer, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// recordChanges 写入同步变更日志；失败只记日志，不影响已完成的操作
+func recordChanges(db *sql.DB, userID int64, changes ...changelog.Change) {
+	if _, err := changelog.Record(db, userID, changes...); err != nil {
+		log.Printf("记录同步变更失败 user=%d: %v", userID, err)
+	}
+}
+
+// documentTagChanges 为一组文档当前的全部标签关联生成 op 变更
+func documentTagChanges(q queryer, op string, docIDs []int64) ([]changelog.Change, error) {
+	placeholders, args := idPlaceholders(docIDs)
+	rows, err := q.Query("SELECT document_id, tag_id FROM document_tags WHERE document_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []changelog.Change
+	for rows.Next() {
+		var docID, tagID int64
+		if err := rows.Scan(&docID, &tagID); err != nil {
+			return nil, err
+		}
+		changes = append(changes, changelog.DocumentTag(op, docID, tagID))
+	}
+	return changes, rows.Err()
+}
+
+// recordDocumentsTrashed 文档移入回收站后记录变更（见 trashedChanges）
+func recordDocumentsTrashed(db *sql.DB, userID int64, docIDs []int64) {
+	if len(docIDs) == 0 {
+		return
+	}
+	changes, err := trashedChanges(db, docIDs)
+	if err != nil {
+		log.Printf("查询文档标签失败 user=%d: %v", userID, err)
+	}
+	recordChanges(db, userID, changes...)
+}
+
+// trashedChanges 文档移入回收站的变更：对同步客户端而言文档及其标签关联均已删除。
+// 查询标签关联失败时仍返回文档本身的删除
+func trashedChanges(q queryer, docIDs []int64) ([]changelog.Change, error) {
+	changes, err := documentTagChanges(q, changelog.OpDelete, docIDs)
+	for _, id := range docIDs {
+		changes = append(changes, changelog.Delete(changelog.EntityDocument, id))
+	}
+	return changes, err
+}
+
+// recordDocumentsRestored 文档从回收站还原后记录变更：文档及其标签关联重新出现
+func recordDocumentsRestored(db *sql.DB, userID int64, docIDs []int64) {
+	if len(docIDs) == 0 {
+		return
+	}
+	changes := make([]changelog.Change, 0, len(docIDs))
+	for _, id := range docIDs {
+		changes = append(changes, changelog.Upsert(changelog.EntityDocument, id))
+	}
+	tagChanges, err := documentTagChanges(db, changelog.OpUpsert, docIDs)
+	if err != nil {
+		log.Printf("查询文档标签失败 user=%d: %v", userID, err)
+	}
+	recordChanges(db, userID, append(changes, tagChanges...)...)
+}
+
+type SyncHandler struct {
+	db   *sql.DB
+	docs *DocumentHandler // 文档保存、front matter 回写
+}
+
+func NewSyncHandler(db *sql.DB, docs *DocumentHandler) *SyncHandler {
+	return &SyncHandler{db: db, docs: docs}
+}
+
+// Pull 拉取变更：GET /api/sync?since=<cursor>&limit=
+// 返回序号大于 since 的变更（按序号升序），每个实体只出现最新一条，data 为实体的当前状态；
+// 实体已不存在时 op 为 delete。客户端保存返回的 cursor，has_more 为 true 时继续拉取。
+// since 省略或为 0 时返回全部现存数据，可用于首次同步
+func (h *SyncHandler) Pull(c *gin.Context) {
+	userID, ok := h.docs.getUserID(c)
+	if !ok {
+		return
+	}
+	var since int64
+	if raw := c.Query("since"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			api.Error(c, http.StatusBadRequest, "无效的 since")
+			return
+		}
+		since = n
+	}
+	limit := syncDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			api.Error(c, http.StatusBadRequest, "无效的 limit")
+			return
+		}
+		limit = min(n, syncMaxLimit)
+	}
+
+	entries, err := changelog.Since(h.db, userID, since, limit+1)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询变更失败")
+		return
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	changes, err := h.resolve(userID, entries)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "查询变更失败")
+		return
+	}
+
+	cursor := since
+	if len(entries) > 0 {
+		cursor = entries[len(entries)-1].Seq
+	}
+	api.Success(c, gin.H{
+		"changes":  changes,
+		"cursor":   cursor,
+		"has_more": hasMore,
+	})
+}
+
+// resolve 为日志条目批量加载实体当前状态
+func (h *SyncHandler) resolve(userID int64, entries []changelog.Entry) ([]models.SyncChange, error) {
+	ids := make(map[string][]int64)
+	for _, e := range entries {
+		if e.Op == changelog.OpUpsert {
+			ids[e.Entity] = append(ids[e.Entity], e.ID)
+		}
+	}
+	docs, err := h.loadDocuments(userID, ids[changelog.EntityDocument])
+	if err != nil {
+		return nil, err
+	}
+	tags, err := h.loadTags(userID, ids[changelog.EntityTag])
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := h.loadTasks(userID, ids[changelog.EntityTask])
+	if err != nil {
+		return nil, err
+	}
+	links, err := h.loadDocumentTags(userID, ids[changelog.EntityDocumentTag])
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.SyncChange, 0, len(entries))
+	for _, e := range entries {
+		ch := models.SyncChange{Seq: e.Seq, Entity: e.Entity, Op: e.Op, ID: e.ID, TagID: e.RelatedID, ChangedAt: e.ChangedAt}
+		if e.Op == changelog.OpUpsert {
+			found := false
+			switch e.Entity {
+			case changelog.EntityDocument:
+				if d, ok := docs[e.ID]; ok {
+					ch.Data, found = d, true
+				}
+			case changelog.EntityTag:
+				if t, ok := tags[e.ID]; ok {
+					ch.Data, found = t, true
+				}
+			case changelog.EntityTask:
+				if t, ok := tasks[e.ID]; ok {
+					ch.Data, found = t, true
+				}
+			case changelog.EntityDocumentTag:
+				found = links[[2]int64{e.ID, e.RelatedID}]
+			}
+			if !found {
+				ch.Op = changelog.OpDelete
+			}
+		}
+		changes = append(changes, ch)
+	}
+	return changes, nil
+}
+
+// loadDocuments 加载用户未删除的文档（含内容）
+func (h *SyncHandler) loadDocuments(userID int64, ids []int64) (map[int64]models.Document, error) {
+	docs := make(map[int64]models.Document)
+	if len(ids) == 0 {
+		return docs, nil
+	}
+	placeholders, args := idPlaceholders(ids)
+	rows, err := h.db.Query(`
+		SELECT id, user_id, folder_id, title, filename, content, file_size, version, visibility, is_template, created_at, updated_at
+		FROM documents
+		WHERE user_id = ? AND deleted_at IS NULL AND id IN (`+placeholders+`)
+	`, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d models.Document
+		if err := rows.Scan(&d.ID, &d.UserID, &d.FolderID, &d.Title, &d.Filename, &d.Content, &d.FileSize,
+			&d.Version, &d.Visibility, &d.IsTemplate, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		docs[d.ID] = d
+	}
+	return docs, rows.Err()
+}
+
+// loadTags 加载用户的标签
+func (h *SyncHandler) loadTags(userID int64, ids []int64) (map[int64]models.Tag, error) {
+	tags := make(map[int64]models.Tag)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	placeholders, args := idPlaceholders(ids)
+	rows, err := h.db.Query(
+		"SELECT id, user_id, name, color, version, created_at, updated_at FROM tags WHERE user_id = ? AND id IN ("+placeholders+")",
+		append([]interface{}{userID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Color, &t.Version, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tags[int64(t.ID)] = t
+	}
+	return tags, rows.Err()
+}
+
+// loadTasks 加载用户的任务及其标签 ID
+func (h *SyncHandler) loadTasks(userID int64, ids []int64) (map[int64]models.SyncTask, error) {
+	tasks := make(map[int64]models.SyncTask)
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	placeholders, args := idPlaceholders(ids)
+	rows, err := h.db.Query(`
+		SELECT id, user_id, title, description, status, priority, due_date, completed_at, version, created_at, updated_at
+		FROM tasks
+		WHERE user_id = ? AND id IN (`+placeholders+`)
+	`, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := models.SyncTask{TagIDs: []int64{}}
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Title, &t.Description, &t.Status, &t.Priority,
+			&t.DueDate, &t.CompletedAt, &t.Version, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tasks[int64(t.ID)] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := h.db.Query("SELECT task_id, tag_id FROM task_tags WHERE task_id IN ("+placeholders+") ORDER BY tag_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var taskID, tagID int64
+		if err := tagRows.Scan(&taskID, &tagID); err != nil {
+			return nil, err
+		}
+		if t, ok := tasks[taskID]; ok {
+			t.TagIDs = append(t.TagIDs, tagID)
+			tasks[taskID] = t
+		}
+	}
+	return tasks, tagRows.Err()
+}
+
+// loadDocumentTags 返回用户未删除文档现存的标签关联，键为 {文档 ID, 标签 ID}
+func (h *SyncHandler) loadDocumentTags(userID int64, docIDs []int64) (map[[2]int64]bool, error) {
+	links := make(map[[2]int64]bool)
+	if len(docIDs) == 0 {
+		return links, nil
+	}
+	placeholders, args := idPlaceholders(docIDs)
+	rows, err := h.db.Query(`
+		SELECT dt.document_id, dt.tag_id
+		FROM document_tags dt
+		INNER JOIN documents d ON d.id = dt.document_id
+		WHERE d.user_id = ? AND d.deleted_at IS NULL AND dt.document_id IN (`+placeholders+`)
+	`, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var docID, tagID int64
+		if err := rows.Scan(&docID, &tagID); err != nil {
+			return nil, err
+		}
+		links[[2]int64{docID, tagID}] = true
+	}
+	return links, rows.Err()
+}
+
+// current 返回实体的当前状态，不存在或查询失败时为 nil
+func (h *SyncHandler) current(userID int64, entity string, id int64) interface{} {
+	var (
+		data  interface{}
+		found bool
+		err   error
+	)
+	switch entity {
+	case changelog.EntityDocument:
+		var docs map[int64]models.Document
+		if docs, err = h.loadDocuments(userID, []int64{id}); err == nil {
+			data, found = docs[id]
+		}
+	case changelog.EntityTag:
+		var tags map[int64]models.Tag
+		if tags, err = h.loadTags(userID, []int64{id}); err == nil {
+			data, found = tags[id]
+		}
+	case changelog.EntityTask:
+		var tasks map[int64]models.SyncTask
+		if tasks, err = h.loadTasks(userID, []int64{id}); err == nil {
+			data, found = tasks[id]
+		}
+	}
+	if err != nil {
+		log.Printf("加载同步记录失败 %s=%d: %v", entity, id, err)
+	}
+	if !found {
+		return nil
+	}
+	return data
+}
+
+// Push 推送离线变更：POST /api/sync，body 为 {changes: [...]}，最多 100 条，按顺序逐条应用。
+// 每条变更单独成败并在 results 中返回状态（applied / conflict / not_found / rejected / locked / error），
+// 冲突时 data 为服务器当前记录，由客户端合并后重新推送。
+// 新建（id 为 0 的 upsert）需带 client_id：同一 client_id 重复推送时不再新建，直接返回首次创建的记录，客户端可放心重试；
+// 文档、标签、任务的修改与删除需带 base_version；document_tag 的建立与解除是幂等的。
+// 每条变更与其变更日志在同一事务内写入。
+// 标签关联有变化的文档在全部变更应用后统一回写 front matter（文档版本随之递增）
+func (h *SyncHandler) Push(c *gin.Context) {
+	userID, ok := h.docs.getUserID(c)
+	if !ok {
+		return
+	}
+	var req models.SyncPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+
+	p := &syncPush{
+		h:       h,
+		ctx:     c.Request.Context(),
+		userID:  userID,
+		docRefs: make(map[string]int64),
+		tagRefs: make(map[string]int64),
+		tagged:  make(map[int64]bool),
+	}
+	results := make([]models.SyncResult, 0, len(req.Changes))
+	for _, ch := range req.Changes {
+		results = append(results, p.apply(ch))
+	}
+
+	docIDs := make([]int64, 0, len(p.tagged))
+	for id := range p.tagged {
+		docIDs = append(docIDs, id)
+	}
+	sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	for _, id := range docIDs {
+		if _, _, err := h.docs.syncFrontMatterTags(p.ctx, id, userID); err != nil {
+			log.Printf("回写 front matter 标签失败 doc=%d: %v", id, err)
+		}
+	}
+
+	cursor, err := changelog.Current(h.db, userID)
+	if err != nil {
+		log.Printf("查询同步序号失败 user=%d: %v", userID, err)
+	}
+	api.Success(c, gin.H{
+		"results": results,
+		"cursor":  cursor,
+	})
+}
+
+// syncPush 是一次推送的处理状态
+type syncPush struct {
+	h       *SyncHandler
+	ctx     context.Context
+	userID  int64
+	docRefs map[string]int64 // ref -> 本批新建的文档 ID
+	tagRefs map[string]int64 // ref -> 本批新建的标签 ID
+	tagged  map[int64]bool   // 标签关联有变化的文档
+}
+
+// apply 应用一条变更并返回结果
+func (p *syncPush) apply(ch models.SyncPushChange) models.SyncResult {
+	res := models.SyncResult{Ref: ch.Ref, Entity: ch.Entity, Op: ch.Op, ID: ch.ID}
+	if ch.ID < 0 {
+		return p.reject(res, "无效的 id")
+	}
+	if ch.Op == changelog.OpUpsert && ch.ID == 0 && ch.Entity != changelog.EntityDocumentTag &&
+		(ch.ClientID == "" || len(ch.ClientID) > clientIDMaxLen) {
+		return p.reject(res, "新建记录需带 client_id（不超过 64 个字符）")
+	}
+	switch ch.Entity {
+	case changelog.EntityDocument:
+		var data models.SyncDocumentData
+		if !decodeSyncData(ch.Data, &data) {
+			return p.reject(res, "data 格式错误")
+		}
+		switch {
+		case ch.Op == changelog.OpDelete:
+			return p.deleteDocument(res, ch)
+		case ch.ID == 0:
+			return p.createDocument(res, ch, data)
+		}
+		return p.updateDocument(res, ch, data)
+	case changelog.EntityTag:
+		var data models.SyncTagData
+		if !decodeSyncData(ch.Data, &data) {
+			return p.reject(res, "data 格式错误")
+		}
+		switch {
+		case ch.Op == changelog.OpDelete:
+			return p.deleteTag(res, ch)
+		case ch.ID == 0:
+			return p.createTag(res, ch, data)
+		}
+		return p.updateTag(res, ch, data)
+	case changelog.EntityTask:
+		var data models.SyncTaskData
+		if !decodeSyncData(ch.Data, &data) {
+			return p.reject(res, "data 格式错误")
+		}
+		if ch.Op == changelog.OpDelete {
+			return p.deleteTask(res, ch)
+		}
+		return p.upsertTask(res, ch, data)
+	}
+	var data models.SyncDocumentTagData
+	if !decodeSyncData(ch.Data, &data) {
+		return p.reject(res, "data 格式错误")
+	}
+	return p.documentTag(res, ch.Op, data)
+}
+
+// decodeSyncData 解析变更的 data；缺省时保持零值
+func decodeSyncData(raw json.RawMessage, v interface{}) bool {
+	if len(raw) == 0 || string(raw) == "null" {
+		return true
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+func (p *syncPush) applied(res models.SyncResult, id int64) models.SyncResult {
+	res.ID, res.Status = id, syncApplied
+	res.Data = p.h.current(p.userID, res.Entity, id)
+	if res.Ref != "" && res.Op == changelog.OpUpsert {
+		switch res.Entity {
+		case changelog.EntityDocument:
+			p.docRefs[res.Ref] = id
+		case changelog.EntityTag:
+			p.tagRefs[res.Ref] = id
+		}
+	}
+	return res
+}
+
+func (p *syncPush) conflict(res models.SyncResult) models.SyncResult {
+	res.Status, res.Error = syncConflict, "记录已被其他设备修改"
+	res.Data = p.h.current(p.userID, res.Entity, res.ID)
+	return res
+}
+
+func (p *syncPush) notFound(res models.SyncResult) models.SyncResult {
+	res.Status, res.Error = syncNotFound, "记录不存在"
+	return res
+}
+
+// locked 检查文档编辑锁，被他人持有时返回 locked 结果
+func (p *syncPush) locked(res models.SyncResult, docID int64) (models.SyncResult, bool) {
+	lease := p.h.docs.lockedByOther(p.ctx, docID, p.userID)
+	if lease == nil {
+		return res, false
+	}
+	res.Status, res.Error, res.Data = syncLocked, "文档正由 "+lease.Username+" 编辑", lease
+	return res, true
+}
+
+func (p *syncPush) reject(res models.SyncResult, msg string) models.SyncResult {
+	res.Status, res.Error = syncRejected, msg
+	return res
+}
+
+func (p *syncPush) fail(res models.SyncResult, err error) models.SyncResult {
+	log.Printf("应用同步变更失败 user=%d %s=%d: %v", p.userID, res.Entity, res.ID, err)
+	res.Status, res.Error = syncError, "服务器错误"
+	return res
+}
+
+// targetFolder 解析文档的 folder_id：0 为根目录；文件夹不属于该用户时 ok 为 false
+func (p *syncPush) targetFolder(folderID int64) (*int64, bool, error) {
+	if folderID == 0 {
+		return nil, true, nil
+	}
+	ok, err := folderExists(p.h.db, p.userID, folderID)
+	return &folderID, ok, err
+}
+
+// inTx 在一个事务内执行 fn，并把 fn 返回的变更写入变更日志；fn 出错时整体回滚
+func (p *syncPush) inTx(fn func(tx *sql.Tx) ([]changelog.Change, error)) error {
+	tx, err := p.h.db.Begin()
+	if err != nil {
+		return err
+	}
+	changes, err := fn(tx)
+	if err == nil {
+		_, err = changelog.RecordTx(tx, p.userID, changes...)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// createOnce 按 client_id 幂等地新建记录：与 insert 在同一事务内登记 client_id 并写入变更日志。
+// 该 client_id 已新建过时不再执行 insert，返回首次新建的记录 ID，created 为 false
+func (p *syncPush) createOnce(entity, clientID string, insert func(tx *sql.Tx) (int64, []changelog.Change, error)) (id int64, created bool, err error) {
+	err = p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		err := tx.QueryRow(
+			"SELECT entity_id FROM sync_client_ids WHERE user_id = ? AND entity = ? AND client_id = ? FOR UPDATE",
+			p.userID, entity, clientID,
+		).Scan(&id)
+		if err == nil {
+			return nil, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+		newID, changes, err := insert(tx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO sync_client_ids (user_id, entity, client_id, entity_id) VALUES (?, ?, ?, ?)",
+			p.userID, entity, clientID, newID,
+		); err != nil {
+			return nil, err
+		}
+		id, created = newID, true
+		return changes, nil
+	})
+	return id, created, err
+}
+
+func (p *syncPush) createDocument(res models.SyncResult, ch models.SyncPushChange, data models.SyncDocumentData) models.SyncResult {
+	var title, content string
+	if data.Title != nil {
+		title = strings.TrimSpace(*data.Title)
+	}
+	if data.Content != nil {
+		content = *data.Content
+	}
+	if frontMatterTitle(content, title) == "" {
+		return p.reject(res, "文档标题不能为空")
+	}
+	var folderID *int64
+	if data.FolderID != nil {
+		id, ok, err := p.targetFolder(*data.FolderID)
+		if err != nil {
+			return p.fail(res, err)
+		}
+		if !ok {
+			return p.reject(res, "文件夹不存在")
+		}
+		folderID = id
+	}
+
+	var saved savedDocument
+	id, created, err := p.createOnce(changelog.EntityDocument, ch.ClientID, func(tx *sql.Tx) (int64, []changelog.Change, error) {
+		var err error
+		// 文档的变更日志由 createDocumentTx 写入
+		saved, err = createDocumentTx(tx, p.userID, folderID, title, content)
+		return saved.ID, nil, err
+	})
+	if err != nil {
+		return p.fail(res, err)
+	}
+	if created {
+		p.h.docs.afterSave(saved, content)
+	}
+	return p.applied(res, id)
+}
+
+func (p *syncPush) updateDocument(res models.SyncResult, ch models.SyncPushChange, data models.SyncDocumentData) models.SyncResult {
+	if ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	var title, content string
+	var version int
+	var folderID sql.NullInt64
+	err := p.h.db.QueryRow("SELECT title, content, version, folder_id FROM documents WHERE id = ? AND user_id = ? AND deleted_at IS NULL", ch.ID, p.userID).
+		Scan(&title, &content, &version, &folderID)
+	if err == sql.ErrNoRows {
+		return p.notFound(res)
+	}
+	if err != nil {
+		return p.fail(res, err)
+	}
+	if version != ch.BaseVersion {
+		return p.conflict(res)
+	}
+	if r, locked := p.locked(res, ch.ID); locked {
+		return r
+	}
+
+	// 先校验目标文件夹，避免内容已保存而移动失败
+	move := false
+	var target *int64
+	if data.FolderID != nil && *data.FolderID != folderID.Int64 {
+		id, ok, err := p.targetFolder(*data.FolderID)
+		if err != nil {
+			return p.fail(res, err)
+		}
+		if !ok {
+			return p.reject(res, "文件夹不存在")
+		}
+		move, target = true, id
+	}
+
+	newTitle, newContent := title, content
+	if data.Title != nil && strings.TrimSpace(*data.Title) != "" {
+		newTitle = strings.TrimSpace(*data.Title)
+	}
+	if data.Content != nil {
+		newContent = *data.Content
+	}
+	if newTitle != title || newContent != content {
+		_, err := p.h.docs.saveContent(ch.ID, p.userID, newTitle, newContent, revisionSourceUpdate, ch.BaseVersion)
+		if errors.Is(err, errVersionConflict) {
+			return p.conflict(res)
+		}
+		if err == sql.ErrNoRows {
+			return p.notFound(res)
+		}
+		if err != nil {
+			return p.fail(res, err)
+		}
+		p.h.docs.cache.InvalidatePosts(p.ctx, ch.ID)
+	}
+	if move {
+		// 与 MoveDocument 相同：只改归属，不递增版本
+		err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+			if _, err := tx.Exec("UPDATE documents SET folder_id = ?, updated_at = updated_at WHERE id = ? AND user_id = ?", target, ch.ID, p.userID); err != nil {
+				return nil, err
+			}
+			return []changelog.Change{changelog.Upsert(changelog.EntityDocument, ch.ID)}, nil
+		})
+		if err != nil {
+			return p.fail(res, err)
+		}
+	}
+	return p.applied(res, ch.ID)
+}
+
+func (p *syncPush) deleteDocument(res models.SyncResult, ch models.SyncPushChange) models.SyncResult {
+	if ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	if r, locked := p.locked(res, ch.ID); locked {
+		return r
+	}
+	// 与 DeleteDocument 相同：移入回收站
+	err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		result, err := tx.Exec(
+			"UPDATE documents SET deleted_at = NOW(), updated_at = updated_at WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND version = ?",
+			ch.ID, p.userID, ch.BaseVersion,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			var count int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM documents WHERE id = ? AND user_id = ? AND deleted_at IS NULL", ch.ID, p.userID).Scan(&count); err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				return nil, sql.ErrNoRows
+			}
+			return nil, errStaleRecord
+		}
+		return trashedChanges(tx, []int64{ch.ID})
+	})
+	if r, done := p.result(res, err); done {
+		return r
+	}
+	p.h.docs.cache.InvalidatePosts(p.ctx, ch.ID)
+	res.Status = syncApplied
+	return res
+}
+
+// result 把 inTx 的错误转为推送结果：sql.ErrNoRows 为 not_found，errStaleRecord 为 conflict；
+// 没有错误时 done 为 false，由调用方继续
+func (p *syncPush) result(res models.SyncResult, err error) (models.SyncResult, bool) {
+	switch {
+	case err == nil:
+		return res, false
+	case err == sql.ErrNoRows:
+		return p.notFound(res), true
+	case errors.Is(err, errStaleRecord):
+		return p.conflict(res), true
+	}
+	return p.fail(res, err), true
+}
+
+// validTagName 去掉首尾空白与 # 前缀后校验标签名
+func validTagName(name string) (string, bool) {
+	name = strings.TrimSpace(strings.TrimPrefix(name, "#"))
+	return name, name != "" && utf8.RuneCountInString(name) <= tagNameMaxLen
+}
+
+func (p *syncPush) createTag(res models.SyncResult, ch models.SyncPushChange, data models.SyncTagData) models.SyncResult {
+	name, ok := validTagName(data.Name)
+	if !ok {
+		return p.reject(res, "无效的标签名")
+	}
+	color := data.Color
+	if color == "" {
+		color = defaultTagColor
+	}
+	id, _, err := p.createOnce(changelog.EntityTag, ch.ClientID, func(tx *sql.Tx) (int64, []changelog.Change, error) {
+		// 同名标签已存在时合并到已有标签（两台设备离线创建同名标签）
+		result, err := tx.Exec(
+			"INSERT INTO tags (user_id, name, color) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)",
+			p.userID, name, color,
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+		id, _ := result.LastInsertId()
+		if n, _ := result.RowsAffected(); n == 1 {
+			return id, []changelog.Change{changelog.Upsert(changelog.EntityTag, id)}, nil
+		}
+		return id, nil, nil
+	})
+	if err != nil {
+		return p.fail(res, err)
+	}
+	return p.applied(res, id)
+}
+
+func (p *syncPush) updateTag(res models.SyncResult, ch models.SyncPushChange, data models.SyncTagData) models.SyncResult {
+	if ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	name := ""
+	if strings.TrimSpace(data.Name) != "" {
+		var ok bool
+		if name, ok = validTagName(data.Name); !ok {
+			return p.reject(res, "无效的标签名")
+		}
+	}
+
+	err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		var version int
+		if err := tx.QueryRow("SELECT version FROM tags WHERE id = ? AND user_id = ? FOR UPDATE", ch.ID, p.userID).Scan(&version); err != nil {
+			return nil, err
+		}
+		if version != ch.BaseVersion {
+			return nil, errStaleRecord
+		}
+		if name != "" {
+			var count int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM tags WHERE user_id = ? AND name = ? AND id <> ?", p.userID, name, ch.ID).Scan(&count); err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				return nil, errTagNameTaken
+			}
+		}
+		if _, err := tx.Exec(
+			"UPDATE tags SET name = COALESCE(NULLIF(?, ''), name), color = COALESCE(NULLIF(?, ''), color), version = version + 1 WHERE id = ?",
+			name, data.Color, ch.ID,
+		); err != nil {
+			return nil, err
+		}
+		return []changelog.Change{changelog.Upsert(changelog.EntityTag, ch.ID)}, nil
+	})
+	if errors.Is(err, errTagNameTaken) {
+		return p.reject(res, "标签名已存在")
+	}
+	if r, done := p.result(res, err); done {
+		return r
+	}
+	return p.applied(res, ch.ID)
+}
+
+func (p *syncPush) deleteTag(res models.SyncResult, ch models.SyncPushChange) models.SyncResult {
+	if ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	if r, done := p.result(res, deleteTag(p.h.db, p.userID, ch.ID, ch.BaseVersion)); done {
+		return r
+	}
+	res.Status = syncApplied
+	return res
+}
+
+// upsertTask 新建任务或以客户端的完整状态覆盖任务；completed_at 随 status 维护
+func (p *syncPush) upsertTask(res models.SyncResult, ch models.SyncPushChange, data models.SyncTaskData) models.SyncResult {
+	data.Title = strings.TrimSpace(data.Title)
+	if data.Title == "" {
+		return p.reject(res, "任务标题不能为空")
+	}
+	if data.Status == "" {
+		data.Status = "pending"
+	}
+	if data.Priority == "" {
+		data.Priority = "medium"
+	}
+	if !taskStatuses[data.Status] || !taskPriorities[data.Priority] {
+		return p.reject(res, "无效的任务状态或优先级")
+	}
+	if ch.ID > 0 && ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	if len(data.TagIDs) > 0 {
+		placeholders, args := idPlaceholders(data.TagIDs)
+		var count int
+		if err := p.h.db.QueryRow(
+			"SELECT COUNT(DISTINCT id) FROM tags WHERE user_id = ? AND id IN ("+placeholders+")",
+			append([]interface{}{p.userID}, args...)...,
+		).Scan(&count); err != nil {
+			return p.fail(res, err)
+		}
+		if count != len(uniqueIDs(data.TagIDs)) {
+			return p.reject(res, "标签不存在")
+		}
+	}
+
+	if ch.ID == 0 {
+		id, _, err := p.createOnce(changelog.EntityTask, ch.ClientID, func(tx *sql.Tx) (int64, []changelog.Change, error) {
+			result, err := tx.Exec(`
+				INSERT INTO tasks (user_id, title, description, status, priority, due_date, completed_at)
+				VALUES (?, ?, ?, ?, ?, ?, IF(? = 'completed', NOW(), NULL))
+			`, p.userID, data.Title, data.Description, data.Status, data.Priority, data.DueDate, data.Status)
+			if err != nil {
+				return 0, nil, err
+			}
+			id, _ := result.LastInsertId()
+			if err := setTaskTags(tx, id, data.TagIDs); err != nil {
+				return 0, nil, err
+			}
+			return id, []changelog.Change{changelog.Upsert(changelog.EntityTask, id)}, nil
+		})
+		if err != nil {
+			return p.fail(res, err)
+		}
+		return p.applied(res, id)
+	}
+
+	err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		var version int
+		if err := tx.QueryRow("SELECT version FROM tasks WHERE id = ? AND user_id = ? FOR UPDATE", ch.ID, p.userID).Scan(&version); err != nil {
+			return nil, err
+		}
+		if version != ch.BaseVersion {
+			return nil, errStaleRecord
+		}
+		if _, err := tx.Exec(`
+			UPDATE tasks
+			SET title = ?, description = ?, status = ?, priority = ?, due_date = ?,
+			    completed_at = IF(? = 'completed', COALESCE(completed_at, NOW()), NULL),
+			    version = version + 1
+			WHERE id = ?
+		`, data.Title, data.Description, data.Status, data.Priority, data.DueDate, data.Status, ch.ID); err != nil {
+			return nil, err
+		}
+		if err := setTaskTags(tx, ch.ID, data.TagIDs); err != nil {
+			return nil, err
+		}
+		return []changelog.Change{changelog.Upsert(changelog.EntityTask, ch.ID)}, nil
+	})
+	if r, done := p.result(res, err); done {
+		return r
+	}
+	return p.applied(res, ch.ID)
+}
+
+// setTaskTags 把任务的标签替换为 tagIDs；tagIDs 为 nil 时不修改
+func setTaskTags(tx *sql.Tx, taskID int64, tagIDs []int64) error {
+	if tagIDs == nil {
+		return nil
+	}
+	if _, err := tx.Exec("DELETE FROM task_tags WHERE task_id = ?", taskID); err != nil {
+		return err
+	}
+	for _, tagID := range uniqueIDs(tagIDs) {
+		if _, err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) VALUES (?, ?)", taskID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *syncPush) deleteTask(res models.SyncResult, ch models.SyncPushChange) models.SyncResult {
+	if ch.BaseVersion < 1 {
+		return p.reject(res, "缺少 base_version")
+	}
+	err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		var version int
+		if err := tx.QueryRow("SELECT version FROM tasks WHERE id = ? AND user_id = ? FOR UPDATE", ch.ID, p.userID).Scan(&version); err != nil {
+			return nil, err
+		}
+		if version != ch.BaseVersion {
+			return nil, errStaleRecord
+		}
+		if _, err := tx.Exec("DELETE FROM task_tags WHERE task_id = ?", ch.ID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM tasks WHERE id = ?", ch.ID); err != nil {
+			return nil, err
+		}
+		return []changelog.Change{changelog.Delete(changelog.EntityTask, ch.ID)}, nil
+	})
+	if r, done := p.result(res, err); done {
+		return r
+	}
+	res.Status = syncApplied
+	return res
+}
+
+// documentTag 建立或解除文档与标签的关联；重复操作视为成功
+func (p *syncPush) documentTag(res models.SyncResult, op string, data models.SyncDocumentTagData) models.SyncResult {
+	docID, tagID := data.DocumentID, data.TagID
+	if data.DocumentRef != "" {
+		id, ok := p.docRefs[data.DocumentRef]
+		if !ok {
+			return p.reject(res, "未知的 document_ref")
+		}
+		docID = id
+	}
+	if data.TagRef != "" {
+		id, ok := p.tagRefs[data.TagRef]
+		if !ok {
+			return p.reject(res, "未知的 tag_ref")
+		}
+		tagID = id
+	}
+	if docID <= 0 || tagID <= 0 {
+		return p.reject(res, "缺少 document_id 或 tag_id")
+	}
+	res.ID = docID
+	res.Data = gin.H{"document_id": docID, "tag_id": tagID}
+
+	var count int
+	if err := p.h.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM documents WHERE id = ? AND user_id = ? AND deleted_at IS NULL)
+		     * (SELECT COUNT(*) FROM tags WHERE id = ? AND user_id = ?)
+	`, docID, p.userID, tagID, p.userID).Scan(&count); err != nil {
+		return p.fail(res, err)
+	}
+	if count == 0 {
+		return p.notFound(res)
+	}
+	// 关联变化后会回写文档 front matter
+	if r, locked := p.locked(res, docID); locked {
+		return r
+	}
+
+	query := "INSERT IGNORE INTO document_tags (document_id, tag_id) VALUES (?, ?)"
+	if op == changelog.OpDelete {
+		query = "DELETE FROM document_tags WHERE document_id = ? AND tag_id = ?"
+	}
+	changed := false
+	err := p.inTx(func(tx *sql.Tx) ([]changelog.Change, error) {
+		result, err := tx.Exec(query, docID, tagID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil, nil
+		}
+		changed = true
+		return []changelog.Change{changelog.DocumentTag(op, docID, tagID)}, nil
+	})
+	if err != nil {
+		return p.fail(res, err)
+	}
+	if changed {
+		p.tagged[docID] = true
+	}
+	res.Status = syncApplied
+	return res
+}
+
+// uniqueIDs 去重并保持原顺序
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"markdown-editor-backend/internal/changelog"
 	"markdown-editor-backend/internal/models"
 	"markdown-editor-backend/pkg/api"
 
@@ -13,21 +15,45 @@ import (
 )
 
 type TagHandler struct {
-	db *sql.DB
+	db   *sql.DB
+	docs *DocumentHandler // 修改文档标签后回写 front matter
 }
 
 type TaskHandler struct {
 	db *sql.DB
 }
 
-func NewTagHandler(db *sql.DB) *TagHandler {
-	return &TagHandler{db: db}
+func NewTagHandler(db *sql.DB, docs *DocumentHandler) *TagHandler {
+	return &TagHandler{db: db, docs: docs}
 }
 
 func NewTaskHandler(db *sql.DB) *TaskHandler {
 	return &TaskHandler{db: db}
 }
 
+// syncFrontMatter 文档标签变化后把标签写回文档的 front matter，返回给客户端的结果：
+// content_updated 为 true 时文档内容与版本已变化，客户端需重新拉取（version 为新版本号）
+func (h *TagHandler) syncFrontMatter(c *gin.Context, docID int, userID interface{}) gin.H {
+	uid, _ := userID.(int64)
+	updated, version, err := h.docs.syncFrontMatterTags(c.Request.Context(), int64(docID), uid)
+	if err != nil {
+		log.Printf("回写 front matter 标签失败 doc=%d: %v", docID, err)
+	}
+	if !updated {
+		return gin.H{"content_updated": false}
+	}
+	return gin.H{"content_updated": true, "version": version}
+}
+
+// tagSortFields 是标签列表可用的排序字段
+var tagSortFields = map[string]sortField{
+	"name":       {Column: "name", Kind: sortString},
+	"created_at": {Column: "created_at", Kind: sortTime},
+	"updated_at": {Column: "updated_at", Kind: sortTime},
+}
+
+// GetTags 标签列表，按列表约定分页排序（见 parseListQuery），默认按创建时间倒序；
+// 支持 created_after / created_before / updated_after / updated_before 时间范围筛选
 func (h *TagHandler) GetTags(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -35,12 +61,28 @@ func (h *TagHandler) GetTags(c *gin.Context) {
 		return
 	}
 
+	lq, ok := parseListQuery(c, tagSortFields, "created_at", "id")
+	if !ok {
+		return
+	}
+	createdWhere, createdArgs, ok := timeRangeFilter(c, "created", "created_at")
+	if !ok {
+		return
+	}
+	updatedWhere, updatedArgs, ok := timeRangeFilter(c, "updated", "updated_at")
+	if !ok {
+		return
+	}
+	cursorWhere, cursorArgs := lq.where()
+	tail, tailArgs := lq.orderLimit()
+	args := append(append([]interface{}{userID}, createdArgs...), updatedArgs...)
+
 	rows, err := h.db.Query(`
-		SELECT id, user_id, name, color, created_at, updated_at 
+		SELECT id, user_id, name, color, version, created_at, updated_at 
 		FROM tags 
-		WHERE user_id = ? 
-		ORDER BY created_at DESC
-	`, userID)
+		WHERE user_id = ?`+createdWhere+updatedWhere+cursorWhere+tail,
+		append(append(args, cursorArgs...), tailArgs...)...,
+	)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "查询失败")
 		return
@@ -50,14 +92,22 @@ func (h *TagHandler) GetTags(c *gin.Context) {
 	var tags []models.Tag
 	for rows.Next() {
 		var tag models.Tag
-		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.Version, &tag.CreatedAt, &tag.UpdatedAt)
 		if err != nil {
 			continue
 		}
 		tags = append(tags, tag)
 	}
 
-	api.Success(c, gin.H{"list": tags})
+	api.Success(c, pageOf(lq, tags, func(t models.Tag) (interface{}, int64) {
+		switch lq.Sort {
+		case "name":
+			return t.Name, int64(t.ID)
+		case "updated_at":
+			return t.UpdatedAt, int64(t.ID)
+		}
+		return t.CreatedAt, int64(t.ID)
+	}))
 }
 
 func (h *TagHandler) CreateTag(c *gin.Context) {
@@ -90,6 +140,8 @@ func (h *TagHandler) CreateTag(c *gin.Context) {
 	}
 
 	id, _ := result.LastInsertId()
+	uid, _ := userID.(int64)
+	recordChanges(h.db, uid, changelog.Upsert(changelog.EntityTag, id))
 	api.Success(c, gin.H{"id": id})
 }
 
@@ -115,16 +167,21 @@ func (h *TagHandler) UpdateTag(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	result, err := h.db.Exec(`
 		UPDATE tags 
 		SET name = COALESCE(NULLIF(?, ''), name), 
-		    color = COALESCE(NULLIF(?, ''), color)
+		    color = COALESCE(NULLIF(?, ''), color),
+		    version = version + 1
 		WHERE id = ? AND user_id = ?
 	`, req.Name, req.Color, tagID, userID)
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "更新失败")
 		return
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		uid, _ := userID.(int64)
+		recordChanges(h.db, uid, changelog.Upsert(changelog.EntityTag, int64(tagID)))
+	}
 
 	api.Success(c, nil)
 }
@@ -136,41 +193,79 @@ func (h *TagHandler) DeleteTag(c *gin.Context) {
 		return
 	}
 
-	tagID, err := strconv.Atoi(c.Param("id"))
+	tagID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		api.Error(c, http.StatusBadRequest, "参数错误")
 		return
 	}
 
-	tx, err := h.db.Begin()
-	if err != nil {
-		api.Error(c, http.StatusInternalServerError, "操作失败")
+	uid, _ := userID.(int64)
+	// 标签不存在时同样返回成功
+	if err := deleteTag(h.db, uid, tagID, 0); err != nil && err != sql.ErrNoRows {
+		api.Error(c, http.StatusInternalServerError, "删除失败")
 		return
 	}
+	api.Success(c, nil)
+}
 
-	_, err = tx.Exec("DELETE FROM document_tags WHERE tag_id = ?", tagID)
+// deleteTag 删除用户的标签及其文档、任务关联，并在同一事务内记录同步变更。
+// ifVersion > 0 时要求标签的 version 与之相同，否则返回 errStaleRecord；标签不存在时返回 sql.ErrNoRows
+func deleteTag(db *sql.DB, userID, tagID int64, ifVersion int) error {
+	tx, err := db.Begin()
 	if err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRow("SELECT version FROM tags WHERE id = ? AND user_id = ? FOR UPDATE", tagID, userID).Scan(&version); err != nil {
 		tx.Rollback()
-		api.Error(c, http.StatusInternalServerError, "删除失败")
-		return
+		return err
 	}
-
-	_, err = tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", tagID)
+	if ifVersion > 0 && version != ifVersion {
+		tx.Rollback()
+		return errStaleRecord
+	}
+	docIDs, err := queryIDs(tx, "SELECT document_id FROM document_tags WHERE tag_id = ?", tagID)
 	if err != nil {
 		tx.Rollback()
-		api.Error(c, http.StatusInternalServerError, "删除失败")
-		return
+		return err
 	}
-
-	_, err = tx.Exec("DELETE FROM tags WHERE id = ? AND user_id = ?", tagID, userID)
+	taskIDs, err := queryIDs(tx, "SELECT task_id FROM task_tags WHERE tag_id = ?", tagID)
 	if err != nil {
 		tx.Rollback()
-		api.Error(c, http.StatusInternalServerError, "删除失败")
-		return
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM document_tags WHERE tag_id = ?",
+		"DELETE FROM task_tags WHERE tag_id = ?",
+		"DELETE FROM tags WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, tagID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if len(taskIDs) > 0 {
+		// 任务的 tag_ids 随之变化，版本递增
+		placeholders, args := idPlaceholders(taskIDs)
+		if _, err := tx.Exec("UPDATE tasks SET version = version + 1 WHERE id IN ("+placeholders+")", args...); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
-	tx.Commit()
-	api.Success(c, nil)
+	// 任务的 tag_ids 随之变化，记为任务更新
+	changes := make([]changelog.Change, 0, len(docIDs)+len(taskIDs)+1)
+	for _, id := range docIDs {
+		changes = append(changes, changelog.DocumentTag(changelog.OpDelete, id, tagID))
+	}
+	for _, id := range taskIDs {
+		changes = append(changes, changelog.Upsert(changelog.EntityTask, id))
+	}
+	if _, err := changelog.RecordTx(tx, userID, append(changes, changelog.Delete(changelog.EntityTag, tagID))...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 func (h *TagHandler) GetDocumentTags(c *gin.Context) {
@@ -179,9 +274,12 @@ func (h *TagHandler) GetDocumentTags(c *gin.Context) {
 		api.Error(c, http.StatusBadRequest, "参数错误")
 		return
 	}
+	if _, ok := h.docs.requireRole(c, int64(docID), c.GetInt64("userID"), roleViewer); !ok {
+		return
+	}
 
 	rows, err := h.db.Query(`
-		SELECT t.id, t.user_id, t.name, t.color, t.created_at, t.updated_at 
+		SELECT t.id, t.user_id, t.name, t.color, t.version, t.created_at, t.updated_at 
 		FROM tags t
 		INNER JOIN document_tags dt ON t.id = dt.tag_id
 		WHERE dt.document_id = ?
@@ -195,7 +293,7 @@ func (h *TagHandler) GetDocumentTags(c *gin.Context) {
 	var tags []models.Tag
 	for rows.Next() {
 		var tag models.Tag
-		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Color, &tag.Version, &tag.CreatedAt, &tag.UpdatedAt)
 		if err != nil {
 			continue
 		}
@@ -226,6 +324,15 @@ func (h *TagHandler) AddDocumentTag(c *gin.Context) {
 		return
 	}
 
+	// 改标签至少需要编辑者角色；标签变化会回写 front matter（见 syncFrontMatter），他人持有编辑锁时拒绝
+	uid, _ := userID.(int64)
+	if _, ok := h.docs.requireRole(c, int64(docID), uid, roleEditor); !ok {
+		return
+	}
+	if !h.docs.checkLock(c, int64(docID), uid) {
+		return
+	}
+
 	// 验证标签属于当前用户
 	var count int
 	err = h.db.QueryRow("SELECT COUNT(*) FROM tags WHERE id = ? AND user_id = ?", req.TagID, userID).Scan(&count)
@@ -235,9 +342,14 @@ func (h *TagHandler) AddDocumentTag(c *gin.Context) {
 	}
 
 	// 忽略重复插入错误
-	h.db.Exec("INSERT IGNORE INTO document_tags (document_id, tag_id) VALUES (?, ?)", docID, req.TagID)
+	result, err := h.db.Exec("INSERT IGNORE INTO document_tags (document_id, tag_id) VALUES (?, ?)", docID, req.TagID)
+	if err == nil {
+		if n, _ := result.RowsAffected(); n > 0 {
+			recordChanges(h.db, uid, changelog.DocumentTag(changelog.OpUpsert, int64(docID), int64(req.TagID)))
+		}
+	}
 
-	api.Success(c, nil)
+	api.Success(c, h.syncFrontMatter(c, docID, userID))
 }
 
 func (h *TagHandler) RemoveDocumentTag(c *gin.Context) {
@@ -259,6 +371,15 @@ func (h *TagHandler) RemoveDocumentTag(c *gin.Context) {
 		return
 	}
 
+	// 改标签至少需要编辑者角色；标签变化会回写 front matter（见 syncFrontMatter），他人持有编辑锁时拒绝
+	uid, _ := userID.(int64)
+	if _, ok := h.docs.requireRole(c, int64(docID), uid, roleEditor); !ok {
+		return
+	}
+	if !h.docs.checkLock(c, int64(docID), uid) {
+		return
+	}
+
 	// 验证标签属于当前用户
 	var count int
 	err = h.db.QueryRow("SELECT COUNT(*) FROM tags WHERE id = ? AND user_id = ?", tagID, userID).Scan(&count)
@@ -267,9 +388,14 @@ func (h *TagHandler) RemoveDocumentTag(c *gin.Context) {
 		return
 	}
 
-	h.db.Exec("DELETE FROM document_tags WHERE document_id = ? AND tag_id = ?", docID, tagID)
+	result, err := h.db.Exec("DELETE FROM document_tags WHERE document_id = ? AND tag_id = ?", docID, tagID)
+	if err == nil {
+		if n, _ := result.RowsAffected(); n > 0 {
+			recordChanges(h.db, uid, changelog.DocumentTag(changelog.OpDelete, int64(docID), int64(tagID)))
+		}
+	}
 
-	api.Success(c, nil)
+	api.Success(c, h.syncFrontMatter(c, docID, userID))
 }
 
 func (h *TagHandler) UpdateDocumentTags(c *gin.Context) {
@@ -293,12 +419,28 @@ func (h *TagHandler) UpdateDocumentTags(c *gin.Context) {
 		return
 	}
 
+	// 改标签至少需要编辑者角色；标签变化会回写 front matter（见 syncFrontMatter），他人持有编辑锁时拒绝
+	uid, _ := userID.(int64)
+	if _, ok := h.docs.requireRole(c, int64(docID), uid, roleEditor); !ok {
+		return
+	}
+	if !h.docs.checkLock(c, int64(docID), uid) {
+		return
+	}
+
 	tx, err := h.db.Begin()
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, "操作失败")
 		return
 	}
 
+	before, err := queryIDs(tx, "SELECT tag_id FROM document_tags WHERE document_id = ? FOR UPDATE", docID)
+	if err != nil {
+		tx.Rollback()
+		api.Error(c, http.StatusInternalServerError, "更新失败")
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM document_tags WHERE document_id = ?", docID)
 	if err != nil {
 		tx.Rollback()
@@ -306,6 +448,7 @@ func (h *TagHandler) UpdateDocumentTags(c *gin.Context) {
 		return
 	}
 
+	after := make(map[int64]bool, len(req.TagIDs))
 	for _, tagID := range req.TagIDs {
 		var count int
 		err := tx.QueryRow("SELECT COUNT(*) FROM tags WHERE id = ? AND user_id = ?", tagID, userID).Scan(&count)
@@ -316,12 +459,43 @@ func (h *TagHandler) UpdateDocumentTags(c *gin.Context) {
 		if err != nil {
 			continue
 		}
+		after[int64(tagID)] = true
 	}
 
-	tx.Commit()
-	api.Success(c, nil)
+	if err := tx.Commit(); err == nil {
+		recordChanges(h.db, uid, tagSetChanges(int64(docID), before, after)...)
+	}
+	api.Success(c, h.syncFrontMatter(c, docID, userID))
+}
+
+// tagSetChanges 比较文档修改前后的标签集合，生成关联的建立与解除变更
+func tagSetChanges(docID int64, before []int64, after map[int64]bool) []changelog.Change {
+	var changes []changelog.Change
+	had := make(map[int64]bool, len(before))
+	for _, id := range before {
+		had[id] = true
+		if !after[id] {
+			changes = append(changes, changelog.DocumentTag(changelog.OpDelete, docID, id))
+		}
+	}
+	for id := range after {
+		if !had[id] {
+			changes = append(changes, changelog.DocumentTag(changelog.OpUpsert, docID, id))
+		}
+	}
+	return changes
+}
+
+// taskSortFields 是任务列表可用的排序字段
+var taskSortFields = map[string]sortField{
+	"title":      {Column: "title", Kind: sortString},
+	"created_at": {Column: "created_at", Kind: sortTime},
+	"updated_at": {Column: "updated_at", Kind: sortTime},
 }
 
+// GetTasks 任务列表，按列表约定分页排序（见 parseListQuery），默认按创建时间倒序。
+// 筛选：status、priority；tag_ids 逗号分隔的标签 ID，须全部带有；
+// created_* / updated_* / due_* 时间范围（_after 含、_before 不含）
 func (h *TaskHandler) GetTasks(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -329,9 +503,14 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		return
 	}
 
+	lq, ok := parseListQuery(c, taskSortFields, "created_at", "id")
+	if !ok {
+		return
+	}
+
 	status := c.Query("status")
 	query := `
-		SELECT id, user_id, title, description, status, priority, due_date, completed_at, created_at, updated_at 
+		SELECT id, user_id, title, description, status, priority, due_date, completed_at, version, created_at, updated_at 
 		FROM tasks 
 		WHERE user_id = ?
 	`
@@ -341,7 +520,25 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		query += " AND status = ?"
 		args = append(args, status)
 	}
-	query += " ORDER BY created_at DESC"
+	if priority := c.Query("priority"); priority != "" {
+		query += " AND priority = ?"
+		args = append(args, priority)
+	}
+	tagWhere, tagArgs := tagFilter(parseIDList(c.Query("tag_ids")), "id", "task_tags", "task_id")
+	query += tagWhere
+	args = append(args, tagArgs...)
+	for _, r := range [][2]string{{"created", "created_at"}, {"updated", "updated_at"}, {"due", "due_date"}} {
+		where, rangeArgs, ok := timeRangeFilter(c, r[0], r[1])
+		if !ok {
+			return
+		}
+		query += where
+		args = append(args, rangeArgs...)
+	}
+	cursorWhere, cursorArgs := lq.where()
+	tail, tailArgs := lq.orderLimit()
+	query += cursorWhere + tail
+	args = append(append(args, cursorArgs...), tailArgs...)
 
 	rows, err := h.db.Query(query, args...)
 	if err != nil {
@@ -356,7 +553,7 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		err := rows.Scan(
 			&task.ID, &task.UserID, &task.Title, &task.Description,
 			&task.Status, &task.Priority, &task.DueDate, &task.CompletedAt,
-			&task.CreatedAt, &task.UpdatedAt,
+			&task.Version, &task.CreatedAt, &task.UpdatedAt,
 		)
 		if err != nil {
 			continue
@@ -364,7 +561,15 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		tasks = append(tasks, task)
 	}
 
-	api.Success(c, gin.H{"list": tasks})
+	api.Success(c, pageOf(lq, tasks, func(t models.Task) (interface{}, int64) {
+		switch lq.Sort {
+		case "title":
+			return t.Title, int64(t.ID)
+		case "updated_at":
+			return t.UpdatedAt, int64(t.ID)
+		}
+		return t.CreatedAt, int64(t.ID)
+	}))
 }
 
 func (h *TaskHandler) CreateTask(c *gin.Context) {
@@ -405,6 +610,8 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		h.db.Exec("INSERT INTO task_tags (task_id, tag_id) VALUES (?, ?)", taskID, tagID)
 	}
 
+	uid, _ := userID.(int64)
+	recordChanges(h.db, uid, changelog.Upsert(changelog.EntityTask, taskID))
 	api.Success(c, gin.H{"id": taskID})
 }
 
@@ -462,7 +669,8 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 			    description = COALESCE(?, description),
 			    status = COALESCE(NULLIF(?, ''), status),
 			    priority = COALESCE(NULLIF(?, ''), priority),
-			    due_date = ?
+			    due_date = ?,
+			    version = version + 1
 			WHERE id = ? AND user_id = ?
 		`, title, description, status, priority, dueDate, taskID, userID)
 	} else {
@@ -471,7 +679,8 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 			SET title = COALESCE(NULLIF(?, ''), title), 
 			    description = COALESCE(?, description),
 			    status = COALESCE(NULLIF(?, ''), status),
-			    priority = COALESCE(NULLIF(?, ''), priority)
+			    priority = COALESCE(NULLIF(?, ''), priority),
+			    version = version + 1
 			WHERE id = ? AND user_id = ?
 		`, title, description, status, priority, taskID, userID)
 	}
@@ -519,6 +728,8 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		api.Error(c, http.StatusInternalServerError, "提交事务失败")
 		return
 	}
+	uid, _ := userID.(int64)
+	recordChanges(h.db, uid, changelog.Upsert(changelog.EntityTask, int64(taskID)))
 	api.Success(c, nil)
 }
 
@@ -548,13 +759,18 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
-	_, err = tx.Exec("DELETE FROM tasks WHERE id = ? AND user_id = ?", taskID, userID)
+	result, err := tx.Exec("DELETE FROM tasks WHERE id = ? AND user_id = ?", taskID, userID)
 	if err != nil {
 		tx.Rollback()
 		api.Error(c, http.StatusInternalServerError, "删除失败")
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit(); err == nil {
+		if n, _ := result.RowsAffected(); n > 0 {
+			uid, _ := userID.(int64)
+			recordChanges(h.db, uid, changelog.Delete(changelog.EntityTask, int64(taskID)))
+		}
+	}
 	api.Success(c, nil)
 }
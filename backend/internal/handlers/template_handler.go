@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/templates"
+	"markdown-editor-backend/pkg/api"
+)
+
+// templateSource 是从模板新建文档时的模板内容
+type templateSource struct {
+	Title   string
+	Content string
+	Tags    []string
+}
+
+// ListTemplates 可用模板：内置系统模板 system 与当前用户标记的模板 user；
+// variables 为模板中需要用户填写的自定义占位符
+func (h *DocumentHandler) ListTemplates(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	system := make([]gin.H, 0, len(templates.System))
+	for _, t := range templates.System {
+		system = append(system, gin.H{
+			"id":          t.ID,
+			"title":       t.Title,
+			"description": t.Description,
+			"tags":        t.Tags,
+			"variables":   templates.Variables(t.Title, t.Content),
+		})
+	}
+
+	rows, err := h.db.Query(
+		"SELECT id, title, content, updated_at FROM documents WHERE user_id = ? AND is_template = 1 AND deleted_at IS NULL ORDER BY updated_at DESC",
+		userID,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取模板列表失败")
+		return
+	}
+	defer rows.Close()
+	user := []gin.H{}
+	for rows.Next() {
+		var (
+			id             int64
+			title, content string
+			updatedAt      time.Time
+		)
+		if err := rows.Scan(&id, &title, &content, &updatedAt); err != nil {
+			continue
+		}
+		user = append(user, gin.H{
+			"id":         id,
+			"title":      title,
+			"variables":  templates.Variables(title, content),
+			"updated_at": updatedAt,
+		})
+	}
+
+	api.Success(c, gin.H{"system": system, "user": user})
+}
+
+// SetTemplate 标记或取消标记文档为模板（仅作者）
+func (h *DocumentHandler) SetTemplate(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.TemplateFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+		return
+	}
+	if !h.ownsDocument(c, id, userID) {
+		return
+	}
+
+	if _, err := h.db.Exec(
+		"UPDATE documents SET is_template = ?, updated_at = updated_at WHERE id = ? AND user_id = ?",
+		*req.IsTemplate, id, userID,
+	); err != nil {
+		api.Error(c, http.StatusInternalServerError, "修改模板标记失败")
+		return
+	}
+	recordChanges(h.db, userID, changelog.Upsert(changelog.EntityDocument, id))
+
+	api.Success(c, gin.H{"id": id, "is_template": *req.IsTemplate})
+}
+
+// loadTemplate 读取模板：非数字 ID 为系统模板；数字 ID 为用户模板，须标记为模板且当前用户可读。
+// 找不到或无权访问时已写入错误响应
+func (h *DocumentHandler) loadTemplate(c *gin.Context, userID int64, idParam string) (templateSource, bool) {
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		t, found := templates.Lookup(idParam)
+		if !found {
+			api.Error(c, http.StatusNotFound, "模板不存在")
+			return templateSource{}, false
+		}
+		return templateSource{Title: t.Title, Content: t.Content, Tags: t.Tags}, true
+	}
+
+	if _, ok := h.requireRole(c, id, userID, roleViewer); !ok {
+		return templateSource{}, false
+	}
+	var src templateSource
+	var isTemplate bool
+	err = h.db.QueryRow("SELECT title, content, is_template FROM documents WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&src.Title, &src.Content, &isTemplate)
+	if err == sql.ErrNoRows || (err == nil && !isTemplate) {
+		api.Error(c, http.StatusNotFound, "模板不存在")
+		return templateSource{}, false
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取模板失败")
+		return templateSource{}, false
+	}
+
+	rows, err := h.db.Query(
+		"SELECT t.name FROM document_tags dt INNER JOIN tags t ON t.id = dt.tag_id WHERE dt.document_id = ? ORDER BY t.name",
+		id,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取模板标签失败")
+		return templateSource{}, false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			src.Tags = append(src.Tags, name)
+		}
+	}
+	return src, true
+}
+
+// CreateFromTemplate 从模板新建文档：POST /api/documents/from-template/:id。
+// :id 为系统模板 ID（如 meeting-notes）或用户模板的文档 ID；
+// 标题与正文中的内置占位符自动替换，自定义占位符须在 variables 中全部给出（值可为空串），
+// 模板的标签按名称复制到新文档（当前用户没有同名标签时自动创建）
+func (h *DocumentHandler) CreateFromTemplate(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.FromTemplateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+			return
+		}
+	}
+	src, ok := h.loadTemplate(c, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	vars := templates.Normalize(req.Variables)
+	var missing []string
+	for _, name := range templates.Variables(src.Title, src.Content) {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		api.ErrorWithData(c, http.StatusBadRequest, "缺少模板变量: "+strings.Join(missing, "、"), gin.H{"missing": missing})
+		return
+	}
+	for k, v := range templates.Builtins(time.Now(), c.GetString("username")) {
+		vars[k] = v
+	}
+
+	// 先确定标题，再展开正文：模板标题中的 {{title}} 取请求给出的标题（省略时为空串），
+	// 不含 {{title}} 的模板标题只在请求未给出标题时使用
+	title := strings.TrimSpace(req.Title)
+	if title == "" || templates.HasVariable(src.Title, templates.VarTitle) {
+		vars[templates.VarTitle] = title
+		title = strings.Join(strings.Fields(templates.Expand(src.Title, vars)), " ")
+	}
+	if title == "" {
+		api.Error(c, http.StatusBadRequest, "文档标题不能为空")
+		return
+	}
+	vars[templates.VarTitle] = title
+	content := templates.Expand(src.Content, vars)
+
+	if !checkTargetFolder(c, h.db, userID, req.FolderID) {
+		return
+	}
+	saved, err := h.createDocument(userID, req.FolderID, title, content)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "创建文档失败")
+		return
+	}
+	tagIDs, err := h.ensureTags(userID, src.Tags)
+	if err == nil {
+		err = h.tagDocument(userID, saved.ID, tagIDs)
+	}
+	if err != nil {
+		// 文档已创建，标签失败不回滚，只记录日志
+		log.Printf("复制模板标签失败 doc=%d: %v", saved.ID, err)
+	}
+
+	h.cache.InvalidatePosts(c.Request.Context(), saved.ID)
+	c.Header("ETag", versionETag(saved.Version))
+	api.Success(c, gin.H{
+		"id":        saved.ID,
+		"title":     saved.Title,
+		"filename":  saved.Filename,
+		"file_size": saved.FileSize,
+		"folder_id": req.FolderID,
+		"version":   saved.Version,
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"markdown-editor-backend/internal/cache"
+)
+
+// 分享链接访问密码：同一链接、同一客户端 IP 在窗口内最多失败的次数
+const (
+	sharePasswordMaxFailures = 5
+	sharePasswordWindow      = 15 * time.Minute
+)
+
+// attemptLimiter 限制同一对象在窗口内的失败尝试次数，达到上限后直到窗口结束前拒绝继续尝试。
+// 计数优先存 Redis（多实例共享）；Redis 不可用时退回进程内计数，不会因此放开限制
+type attemptLimiter struct {
+	cache  *cache.Cache
+	max    int64
+	window time.Duration
+
+	mu    sync.Mutex
+	local map[string]localAttempts
+}
+
+type localAttempts struct {
+	n       int64
+	expires time.Time
+}
+
+func newAttemptLimiter(c *cache.Cache, max int64, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{cache: c, max: max, window: window, local: make(map[string]localAttempts)}
+}
+
+// blocked 返回 scope 是否已达到失败上限，以及还需等待的时长
+func (l *attemptLimiter) blocked(ctx context.Context, scope string) (bool, time.Duration) {
+	if n, ttl, ok := l.cache.Attempts(ctx, scope); ok {
+		return n >= l.max, ttl
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.local[scope]
+	if !ok || time.Now().After(a.expires) {
+		return false, 0
+	}
+	return a.n >= l.max, time.Until(a.expires)
+}
+
+// fail 记录一次失败
+func (l *attemptLimiter) fail(ctx context.Context, scope string) {
+	if _, ok := l.cache.IncrAttempts(ctx, scope, l.window); ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	a, ok := l.local[scope]
+	if !ok || now.After(a.expires) {
+		a = localAttempts{expires: now.Add(l.window)}
+		// 条目较多时顺带清掉过期的，避免进程内计数无限增长
+		if len(l.local) >= 1024 {
+			for k, v := range l.local {
+				if now.After(v.expires) {
+					delete(l.local, k)
+				}
+			}
+		}
+	}
+	a.n++
+	l.local[scope] = a
+}
+
+// reset 清除 scope 的失败计数
+func (l *attemptLimiter) reset(ctx context.Context, scope string) {
+	l.cache.ResetAttempts(ctx, scope)
+	l.mu.Lock()
+	delete(l.local, scope)
+	l.mu.Unlock()
+}
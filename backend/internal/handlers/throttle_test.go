@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Redis 不可用（nil 缓存）时按进程内计数限制
+func TestAttemptLimiterLocal(t *testing.T) {
+	ctx := context.Background()
+	l := newAttemptLimiter(nil, 3, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if blocked, _ := l.blocked(ctx, "a"); blocked {
+			t.Fatalf("第 %d 次失败前不应被限制", i+1)
+		}
+		l.fail(ctx, "a")
+	}
+	if blocked, wait := l.blocked(ctx, "a"); !blocked || wait <= 0 {
+		t.Fatalf("达到上限后应被限制，blocked=%v wait=%v", blocked, wait)
+	}
+	if blocked, _ := l.blocked(ctx, "b"); blocked {
+		t.Fatal("其他 scope 不应受影响")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if blocked, _ := l.blocked(ctx, "a"); blocked {
+		t.Fatal("窗口结束后应解除限制")
+	}
+
+	l.fail(ctx, "c")
+	l.fail(ctx, "c")
+	l.reset(ctx, "c")
+	l.fail(ctx, "c")
+	if blocked, _ := l.blocked(ctx, "c"); blocked {
+		t.Fatal("reset 后应重新计数")
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// purgeBatchSize 是永久清除时每批处理的文档数，避免单个事务过大
+const purgeBatchSize = 200
+
+// purgeDocuments 永久删除回收站中满足条件的文档（where 以 AND 拼接在 deleted_at IS NOT NULL 之后），
+// 连同其修订、标签关联、元数据、附件关联、链接、点赞与共享记录；附件属于用户，不随文档删除。返回删除的文档数。
+func purgeDocuments(db *sql.DB, where string, args ...interface{}) (int, error) {
+	total := 0
+	for {
+		rows, err := db.Query(
+			"SELECT id FROM documents WHERE deleted_at IS NOT NULL"+where+" ORDER BY id LIMIT ?",
+			append(append([]interface{}{}, args...), purgeBatchSize)...,
+		)
+		if err != nil {
+			return total, err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		placeholders, idArgs := idPlaceholders(ids)
+		tx, err := db.Begin()
+		if err != nil {
+			return total, err
+		}
+		for _, stmt := range []string{
+			"DELETE FROM document_revisions WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_tags WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_likes WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_shares WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_share_links WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_comments WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_meta WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_attachments WHERE document_id IN (" + placeholders + ")",
+			"DELETE FROM document_links WHERE source_id IN (" + placeholders + ")",
+			"UPDATE document_links SET target_id = NULL WHERE target_id IN (" + placeholders + ")",
+			"DELETE FROM documents WHERE deleted_at IS NOT NULL AND id IN (" + placeholders + ")",
+		} {
+			if _, err := tx.Exec(stmt, idArgs...); err != nil {
+				tx.Rollback()
+				return total, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return total, err
+		}
+		total += len(ids)
+		if len(ids) < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// PurgeExpiredTrash 永久清除在回收站中超过 retentionDays 天的文档；retentionDays <= 0 时不清除
+func PurgeExpiredTrash(db *sql.DB, retentionDays int) (int, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	return purgeDocuments(db, " AND deleted_at < DATE_SUB(NOW(), INTERVAL ? DAY)", retentionDays)
+}
+
+// RunTrashPurge 每隔 interval 清除一次过期的回收站文档，直到 ctx 取消；启动时先执行一次
+func RunTrashPurge(ctx context.Context, db *sql.DB, retentionDays int, interval time.Duration) {
+	if retentionDays <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := PurgeExpiredTrash(db, retentionDays)
+		if err != nil {
+			log.Printf("清理回收站失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已永久清除 %d 篇回收站文档", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListTrash 回收站列表（不含内容），按删除时间倒序；purge_at 为预计永久清除的时间
+func (h *DocumentHandler) ListTrash(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(
+		"SELECT id, user_id, folder_id, title, filename, file_size, version, created_at, updated_at, deleted_at FROM documents WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC",
+		userID,
+	)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "获取回收站失败")
+		return
+	}
+	defer rows.Close()
+
+	type trashItem struct {
+		models.Document
+		PurgeAt *time.Time `json:"purge_at"`
+	}
+	list := []trashItem{}
+	for rows.Next() {
+		var item trashItem
+		d := &item.Document
+		if err := rows.Scan(&d.ID, &d.UserID, &d.FolderID, &d.Title, &d.Filename, &d.FileSize, &d.Version, &d.CreatedAt, &d.UpdatedAt, &d.DeletedAt); err != nil {
+			continue
+		}
+		if days := h.trash.RetentionDays; days > 0 && d.DeletedAt != nil {
+			purgeAt := d.DeletedAt.AddDate(0, 0, days)
+			item.PurgeAt = &purgeAt
+		}
+		list = append(list, item)
+	}
+
+	api.Success(c, gin.H{"list": list, "retention_days": h.trash.RetentionDays})
+}
+
+// RestoreTrash 从回收站还原文档；原所在文件夹已被删除时还原到根目录
+func (h *DocumentHandler) RestoreTrash(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE documents d
+		LEFT JOIN folders f ON f.id = d.folder_id AND f.user_id = d.user_id
+		SET d.deleted_at = NULL, d.folder_id = f.id, d.updated_at = d.updated_at
+		WHERE d.id = ? AND d.user_id = ? AND d.deleted_at IS NOT NULL
+	`, id, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "还原文档失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		api.Error(c, http.StatusNotFound, "回收站中没有该文档")
+		return
+	}
+
+	recordDocumentsRestored(h.db, userID, []int64{id})
+	h.cache.InvalidatePosts(c.Request.Context(), id)
+	api.Success(c, gin.H{"id": id, "message": "已还原"})
+}
+
+// DeleteTrash 永久删除回收站中的一篇文档
+func (h *DocumentHandler) DeleteTrash(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	n, err := purgeDocuments(h.db, " AND id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "删除文档失败")
+		return
+	}
+	if n == 0 {
+		api.Error(c, http.StatusNotFound, "回收站中没有该文档")
+		return
+	}
+
+	api.Success(c, gin.H{"message": "已永久删除"})
+}
+
+// EmptyTrash 清空回收站
+func (h *DocumentHandler) EmptyTrash(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+
+	n, err := purgeDocuments(h.db, " AND user_id = ?", userID)
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "清空回收站失败")
+		return
+	}
+
+	api.Success(c, gin.H{"deleted": n})
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"markdown-editor-backend/internal/cache"
+	"markdown-editor-backend/internal/storage"
+)
+
+// DedupeReport 是 DedupeUploads 的结果
+type DedupeReport struct {
+	Renamed   int      // 改为按内容命名的对象数
+	Merged    int      // 其中内容与已有对象相同、合并为一份的数
+	Documents int      // 改写了链接的文档数
+	Deleted   int      // 删除的旧文件数（deleteOld 时）
+	Kept      int      // 仍被修订历史或回收站中的文档引用、没有删除的旧文件数（deleteOld 时）
+	Locked    int      // 引用它的文档正在编辑、本次跳过的对象数，重新执行时处理
+	Missing   []string // 有附件记录但文件已不存在的对象
+	Failed    int
+}
+
+// DedupeUploads 把以随机文件名保存的旧上传文件改为按内容命名（见 storeAttachment），内容相同的合并为一份：
+// 附件记录与引用计数指向新对象，文档中的 /uploads/<旧键> 链接改写为新地址，作为一次保存记录修订与同步变更
+// （见 rewriteUploadLinks）。修订历史保持原样，仍指向旧地址。
+// 引用旧文件的文档正持有编辑锁时跳过该文件。deleteOld 为 false 时保留旧文件，不再被引用后由孤儿文件清理回收；
+// 为 true 时删除不再被任何文档或修订引用的旧文件。dryRun 只统计不修改
+func DedupeUploads(ctx context.Context, db *sql.DB, store storage.Storage, c *cache.Cache, dryRun, deleteOld bool) (DedupeReport, error) {
+	var report DedupeReport
+	rows, err := db.QueryContext(ctx, "SELECT storage_path FROM upload_blobs ORDER BY id")
+	if err != nil {
+		return report, err
+	}
+	var legacy []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return report, err
+		}
+		if !storage.IsHashKey(key) {
+			legacy = append(legacy, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	h := &DocumentHandler{db: db, cache: c, store: store}
+	for _, oldKey := range legacy {
+		oldURL := "/uploads/" + oldKey
+		docIDs, err := linkedDocuments(ctx, db, oldURL)
+		if err != nil {
+			log.Printf("查询引用文档失败 %s: %v", oldKey, err)
+			report.Failed++
+			continue
+		}
+		if !dryRun && h.anyLocked(ctx, docIDs) {
+			log.Printf("引用 %s 的文档正在编辑，跳过", oldKey)
+			report.Locked++
+			continue
+		}
+		newKey, merged, err := rehashBlob(ctx, db, store, oldKey, dryRun)
+		if errors.Is(err, storage.ErrNotExist) {
+			report.Missing = append(report.Missing, oldKey)
+			continue
+		}
+		if err != nil {
+			log.Printf("按内容重命名失败 %s: %v", oldKey, err)
+			report.Failed++
+			continue
+		}
+		report.Renamed++
+		if merged {
+			report.Merged++
+		}
+		if dryRun {
+			continue
+		}
+		n, err := rewriteUploadLinks(ctx, h, docIDs, oldURL, "/uploads/"+newKey)
+		report.Documents += n
+		if err != nil {
+			log.Printf("改写文档链接失败 %s: %v", oldKey, err)
+			report.Failed++
+			continue
+		}
+		if deleteOld {
+			referenced, err := uploadURLReferenced(ctx, db, oldURL)
+			if err != nil {
+				log.Printf("查询旧文件引用失败 %s: %v", oldKey, err)
+				continue
+			}
+			if referenced {
+				report.Kept++
+				continue
+			}
+			if err := store.Delete(ctx, oldKey); err != nil {
+				log.Printf("删除旧文件失败 %s: %v", oldKey, err)
+				continue
+			}
+			if path.Dir(oldKey) == imagesSubdir {
+				removeImageVariants(ctx, store, path.Base(oldKey))
+			}
+			report.Deleted++
+		}
+	}
+	return report, nil
+}
+
+// rehashBlob 计算旧对象的内容哈希，把它写到按内容命名的键下，并把引用计数与附件记录转到新键；
+// merged 为 true 表示新键已有相同内容的对象。dryRun 时只计算新键
+func rehashBlob(ctx context.Context, db *sql.DB, store storage.Storage, oldKey string, dryRun bool) (newKey string, merged bool, err error) {
+	obj, err := store.Get(ctx, oldKey)
+	if err != nil {
+		return "", false, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, obj)
+	obj.Close()
+	if err != nil {
+		return "", false, err
+	}
+	newKey = storage.HashKey(path.Dir(oldKey), hash.Sum(nil), strings.ToLower(path.Ext(oldKey)))
+	if dryRun {
+		_, err := store.Stat(ctx, newKey)
+		return newKey, err == nil, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	var refs int
+	if err := tx.QueryRow("SELECT ref_count FROM upload_blobs WHERE storage_path = ? FOR UPDATE", oldKey).Scan(&refs); err != nil {
+		return "", false, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO upload_blobs (storage_path, size, ref_count) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE ref_count = ref_count + VALUES(ref_count)",
+		newKey, size, refs,
+	)
+	if err != nil {
+		return "", false, err
+	}
+	affected, _ := result.RowsAffected()
+	merged = affected == 2 // ON DUPLICATE KEY 更新已有行时为 2
+
+	if info, err := store.Stat(ctx, newKey); err != nil || info.Size != size {
+		if err != nil && !errors.Is(err, storage.ErrNotExist) {
+			return "", false, err
+		}
+		if err := copyObject(ctx, store, oldKey, newKey); err != nil {
+			return "", false, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE attachments SET storage_path = ? WHERE storage_path = ?", newKey, oldKey); err != nil {
+		return "", false, err
+	}
+	if _, err := tx.Exec("DELETE FROM upload_blobs WHERE storage_path = ?", oldKey); err != nil {
+		return "", false, err
+	}
+	return newKey, merged, tx.Commit()
+}
+
+// copyObject 把 store 中的对象 src 复制到 dst
+func copyObject(ctx context.Context, store storage.Storage, src, dst string) error {
+	obj, err := store.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	return store.Put(ctx, dst, obj, obj.Size)
+}
+
+// linkedDocuments 返回内容中含 url 的未删除文档
+func linkedDocuments(ctx context.Context, db *sql.DB, url string) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM documents WHERE content LIKE ? AND deleted_at IS NULL", "%"+escapeLike(url)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// anyLocked 判断 ids 中是否有文档正持有编辑锁（不论持有者）
+func (h *DocumentHandler) anyLocked(ctx context.Context, ids []int64) bool {
+	for _, id := range ids {
+		if h.lockedByOther(ctx, id, 0) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadURLReferenced 判断是否仍有文档（含回收站）或修订的内容引用 url
+func uploadURLReferenced(ctx context.Context, db *sql.DB, url string) (bool, error) {
+	pattern := "%" + escapeLike(url) + "%"
+	var referenced bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM documents WHERE content LIKE ?) OR EXISTS(SELECT 1 FROM document_revisions WHERE content LIKE ?)",
+		pattern, pattern,
+	).Scan(&referenced)
+	return referenced, err
+}
+
+const (
+	// revisionSourceDedupe 上传文件按内容重命名后改写文档链接产生的修订
+	revisionSourceDedupe = "dedupe"
+	// rewriteUploadLinksMaxTries 是改写一篇文档时遇到并发保存（版本冲突）的最多尝试次数
+	rewriteUploadLinksMaxTries = 3
+)
+
+// rewriteUploadLinks 把文档 ids 内容中的 oldURL 替换为 newURL，按普通保存处理（saveContent）：版本号加一、
+// 记录来源为 dedupe 的修订并写入同步变更，持有旧版本的客户端保存时会收到冲突并重新拉取。已有修订不改动。
+// 正持有编辑锁的文档跳过并返回错误，旧地址仍可访问。返回改写的文档数
+func rewriteUploadLinks(ctx context.Context, h *DocumentHandler, ids []int64, oldURL, newURL string) (int, error) {
+	rewritten, locked := 0, 0
+	for _, id := range ids {
+		if h.lockedByOther(ctx, id, 0) != nil {
+			locked++
+			continue
+		}
+		ok, err := h.rewriteDocumentLink(id, oldURL, newURL)
+		if err != nil {
+			return rewritten, err
+		}
+		if ok {
+			rewritten++
+			h.cache.InvalidatePosts(ctx, id)
+		}
+	}
+	if locked > 0 {
+		return rewritten, fmt.Errorf("%d 篇文档正在编辑，未改写", locked)
+	}
+	return rewritten, nil
+}
+
+// rewriteDocumentLink 改写一篇文档内容中的 oldURL，修订记在文档作者名下；文档已删除或不再含 oldURL 时 ok 为 false
+func (h *DocumentHandler) rewriteDocumentLink(docID int64, oldURL, newURL string) (ok bool, err error) {
+	for try := 0; try < rewriteUploadLinksMaxTries; try++ {
+		var ownerID int64
+		var title, content string
+		var version int
+		err := h.db.QueryRow(
+			"SELECT user_id, title, content, version FROM documents WHERE id = ? AND deleted_at IS NULL", docID,
+		).Scan(&ownerID, &title, &content, &version)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !strings.Contains(content, oldURL) {
+			return false, nil
+		}
+		_, err = h.saveContent(docID, ownerID, title, strings.ReplaceAll(content, oldURL, newURL), revisionSourceDedupe, version)
+		if errors.Is(err, errVersionConflict) {
+			continue
+		}
+		return err == nil, err
+	}
+	return false, errVersionConflict
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"markdown-editor-backend/internal/config"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/internal/storage"
+)
+
+const (
+	// quarantineDir 是隔离区：待删除的孤儿文件移到 quarantine/<原对象键>，期满后永久删除
+	quarantineDir = "quarantine"
+	// uploadGCLockName 是清理任务的 MySQL 命名锁，多个实例同时只有一个在清理
+	uploadGCLockName = "markdown_editor_upload_gc"
+	// uploadGCMinAge 内新写入的文件不视为孤儿：上传时先写文件、后提交附件记录
+	uploadGCMinAge = time.Hour
+)
+
+// errUploadGCRunning 表示另一次清理正在进行（可能在其他实例上）
+var errUploadGCRunning = errors.New("孤儿文件清理正在进行中")
+
+// variantStemRe 从缩小尺寸的文件名中取出原图文件名去扩展名的部分，见 imageVariantKey
+var variantStemRe = regexp.MustCompile(`^(.+)_w[0-9]+\.[A-Za-z0-9]+$`)
+
+// uploadRefs 扫描全部文档内容（含回收站）、修订与附件记录，返回被引用的对象键；
+// live 为未删除文档引用的对象键 → 文档 ID，用于报告缺失的文件
+func uploadRefs(ctx context.Context, db *sql.DB) (refs map[string]bool, live map[string][]int64, err error) {
+	refs = make(map[string]bool)
+	live = make(map[string][]int64)
+
+	rows, err := db.QueryContext(ctx, "SELECT id, deleted_at IS NULL, content FROM documents")
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var id int64
+		var alive bool
+		var content string
+		if err := rows.Scan(&id, &alive, &content); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		seen := make(map[string]bool)
+		for _, m := range attachmentLinkRe.FindAllStringSubmatch(content, -1) {
+			refs[m[1]] = true
+			if alive && !seen[m[1]] {
+				seen[m[1]] = true
+				live[m[1]] = append(live[m[1]], id)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// 修订可以还原，其中的链接同样保留文件
+	rows, err = db.QueryContext(ctx, "SELECT content FROM document_revisions")
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		for _, m := range attachmentLinkRe.FindAllStringSubmatch(content, -1) {
+			refs[m[1]] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// 附件属于用户，即使没有文档引用也不清理，由用户在附件列表中删除
+	rows, err = db.QueryContext(ctx, "SELECT DISTINCT storage_path FROM attachments")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, nil, err
+		}
+		refs[key] = true
+	}
+	return refs, live, rows.Err()
+}
+
+// quarantineUpload 把对象 key 移入隔离区。锁住引用计数行后再次确认没有附件记录引用它，与同一内容的并发上传串行执行；
+// 期间被上传引用时 moved 为 false
+func quarantineUpload(ctx context.Context, db *sql.DB, store storage.Storage, key string, size int64) (moved bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var refs int
+	if err := tx.QueryRow("SELECT ref_count FROM upload_blobs WHERE storage_path = ? FOR UPDATE", key).Scan(&refs); err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM attachments WHERE storage_path = ?", key).Scan(&n); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO upload_quarantine (storage_path, size) VALUES (?, ?) ON DUPLICATE KEY UPDATE size = VALUES(size), quarantined_at = CURRENT_TIMESTAMP",
+		key, size,
+	); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM upload_blobs WHERE storage_path = ?", key); err != nil {
+		return false, err
+	}
+	if err := copyObject(ctx, store, key, quarantineDir+"/"+key); err != nil {
+		return false, err
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// collectUploads 清理孤儿上传文件：
+//  1. 隔离区中重新被引用的文件移回原处，隔离超过 grace 仍无引用的永久删除；
+//  2. 存储中没有被任何文档、修订或附件引用的文件移入隔离区；
+//  3. 原图已不在的缩小尺寸直接删除（可重新生成）；
+//  4. 报告未删除文档仍在引用、存储中却不存在的文件。
+//
+// dryRun 时只检查不修改。同一时间只有一次清理，否则返回 errUploadGCRunning
+func collectUploads(ctx context.Context, db *sql.DB, store storage.Storage, grace time.Duration, dryRun bool) (models.UploadGCReport, error) {
+	report := models.UploadGCReport{
+		DryRun:      dryRun,
+		Quarantined: []string{},
+		Restored:    []string{},
+		Deleted:     []string{},
+		Missing:     []models.MissingUpload{},
+		StartedAt:   time.Now().UTC(),
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", uploadGCLockName).Scan(&locked); err != nil {
+		return report, err
+	}
+	if locked.Int64 != 1 {
+		return report, errUploadGCRunning
+	}
+	defer conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", uploadGCLockName)
+
+	refs, live, err := uploadRefs(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	existing := make(map[string]storage.Info)
+	var variants []storage.Info
+	for _, prefix := range []string{imagesSubdir + "/", filesSubdir + "/"} {
+		err := store.List(ctx, prefix, func(info storage.Info) error {
+			if strings.HasPrefix(info.Key, imagesSubdir+"/"+imageVariantsDir+"/") {
+				variants = append(variants, info)
+			} else {
+				existing[info.Key] = info
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	// 1. 隔离区
+	rows, err := db.QueryContext(ctx, "SELECT storage_path, quarantined_at FROM upload_quarantine")
+	if err != nil {
+		return report, err
+	}
+	type quarantined struct {
+		Key string
+		At  time.Time
+	}
+	var held []quarantined
+	for rows.Next() {
+		var q quarantined
+		if err := rows.Scan(&q.Key, &q.At); err != nil {
+			rows.Close()
+			return report, err
+		}
+		held = append(held, q)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	for _, q := range held {
+		switch {
+		case refs[q.Key]:
+			if !dryRun {
+				if err := copyObject(ctx, store, quarantineDir+"/"+q.Key, q.Key); err != nil && !errors.Is(err, storage.ErrNotExist) {
+					log.Printf("恢复隔离文件失败 %s: %v", q.Key, err)
+					continue
+				}
+				_ = store.Delete(ctx, quarantineDir+"/"+q.Key)
+				if _, err := db.ExecContext(ctx, "DELETE FROM upload_quarantine WHERE storage_path = ?", q.Key); err != nil {
+					return report, err
+				}
+				if info, err := store.Stat(ctx, q.Key); err == nil {
+					existing[q.Key] = info
+				}
+			} else {
+				existing[q.Key] = storage.Info{Key: q.Key, ModTime: q.At}
+			}
+			report.Restored = append(report.Restored, q.Key)
+		case time.Since(q.At) >= grace:
+			if !dryRun {
+				if err := store.Delete(ctx, quarantineDir+"/"+q.Key); err != nil {
+					log.Printf("删除隔离文件失败 %s: %v", q.Key, err)
+					continue
+				}
+				if _, err := db.ExecContext(ctx, "DELETE FROM upload_quarantine WHERE storage_path = ?", q.Key); err != nil {
+					return report, err
+				}
+			}
+			report.Deleted = append(report.Deleted, q.Key)
+		}
+	}
+
+	// 2. 未被引用的文件移入隔离区
+	for key, info := range existing {
+		report.Scanned++
+		if refs[key] {
+			report.Referenced++
+			continue
+		}
+		if time.Since(info.ModTime) < uploadGCMinAge {
+			continue
+		}
+		if dryRun {
+			report.Quarantined = append(report.Quarantined, key)
+			continue
+		}
+		moved, err := quarantineUpload(ctx, db, store, key, info.Size)
+		if err != nil {
+			log.Printf("隔离孤儿文件失败 %s: %v", key, err)
+			continue
+		}
+		if moved {
+			report.Quarantined = append(report.Quarantined, key)
+			delete(existing, key)
+		}
+	}
+
+	// 3. 缩小尺寸
+	stems := make(map[string]bool)
+	for key := range existing {
+		if path.Dir(key) == imagesSubdir {
+			stems[strings.TrimSuffix(path.Base(key), path.Ext(key))] = true
+		}
+	}
+	for _, v := range variants {
+		m := variantStemRe.FindStringSubmatch(path.Base(v.Key))
+		if m != nil && stems[m[1]] {
+			continue
+		}
+		if time.Since(v.ModTime) < uploadGCMinAge {
+			continue
+		}
+		if !dryRun {
+			if err := store.Delete(ctx, v.Key); err != nil {
+				log.Printf("删除缩小尺寸失败 %s: %v", v.Key, err)
+				continue
+			}
+		}
+		report.VariantsDeleted++
+	}
+
+	// 4. 缺失的文件
+	for key, ids := range live {
+		if _, ok := existing[key]; !ok {
+			report.Missing = append(report.Missing, models.MissingUpload{Path: key, DocumentIDs: ids})
+		}
+	}
+
+	sort.Strings(report.Quarantined)
+	sort.Strings(report.Restored)
+	sort.Strings(report.Deleted)
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].Path < report.Missing[j].Path })
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// uploadGCGrace 返回隔离期
+func uploadGCGrace(cfg config.UploadGCConfig) time.Duration {
+	if cfg.GraceDays <= 0 {
+		return 0
+	}
+	return time.Duration(cfg.GraceDays) * 24 * time.Hour
+}
+
+// RunUploadGC 每隔 cfg.IntervalHours 小时清理一次孤儿上传文件，直到 ctx 取消；启动时先执行一次
+func RunUploadGC(ctx context.Context, db *sql.DB, store storage.Storage, cfg config.UploadGCConfig) {
+	if cfg.IntervalHours <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.IntervalHours) * time.Hour)
+	defer ticker.Stop()
+	for {
+		report, err := collectUploads(ctx, db, store, uploadGCGrace(cfg), false)
+		switch {
+		case errors.Is(err, errUploadGCRunning):
+		case err != nil:
+			log.Printf("清理孤儿上传文件失败: %v", err)
+		default:
+			if n := len(report.Quarantined) + len(report.Restored) + len(report.Deleted) + report.VariantsDeleted; n > 0 {
+				log.Printf("孤儿上传文件清理：隔离 %d 个，恢复 %d 个，永久删除 %d 个，删除缩小尺寸 %d 个",
+					len(report.Quarantined), len(report.Restored), len(report.Deleted), report.VariantsDeleted)
+			}
+			for _, m := range report.Missing {
+				log.Printf("文档引用的文件不存在 %s（文档 %v）", m.Path, m.DocumentIDs)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"markdown-editor-backend/internal/changelog"
+	"markdown-editor-backend/internal/models"
+	"markdown-editor-backend/pkg/api"
+)
+
+// 文档可见性
+const (
+	visibilityPrivate  = "private"  // 仅作者可见（默认）
+	visibilityUnlisted = "unlisted" // 凭链接令牌可通过 GetPost 查看，不出现在社区列表
+	visibilityPublic   = "public"   // 出现在社区列表
+)
+
+// linkTokenLen 是 unlisted 文档链接令牌的长度（16 字节随机数的 base64url 编码）；数字 ID 不会这么长
+const linkTokenLen = 22
+
+// newLinkToken 生成不可猜测的链接令牌
+func newLinkToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// setVisibility 修改文档可见性并失效贴文缓存；文档不存在（或不属于该用户）时返回 false。
+// 设为 unlisted 时沿用已有的链接令牌，没有则生成；设为 private 时清除令牌，旧链接随之失效
+func (h *DocumentHandler) setVisibility(c *gin.Context, docID, userID int64, visibility string) bool {
+	var err error
+	switch visibility {
+	case visibilityPrivate:
+		_, err = h.db.Exec("UPDATE documents SET visibility = ?, link_token = NULL, updated_at = updated_at WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+			visibility, docID, userID)
+	case visibilityUnlisted:
+		var token string
+		if token, err = newLinkToken(); err == nil {
+			_, err = h.db.Exec("UPDATE documents SET visibility = ?, link_token = COALESCE(link_token, ?), published_at = NOW(), updated_at = updated_at WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+				visibility, token, docID, userID)
+		}
+	default:
+		_, err = h.db.Exec("UPDATE documents SET visibility = ?, published_at = NOW(), updated_at = updated_at WHERE id = ? AND user_id = ? AND deleted_at IS NULL",
+			visibility, docID, userID)
+	}
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, "修改可见性失败")
+		return false
+	}
+	recordChanges(h.db, userID, changelog.Upsert(changelog.EntityDocument, docID))
+	h.cache.InvalidatePosts(c.Request.Context(), docID)
+	return true
+}
+
+// PublishDocument 发布文档：body 中 visibility 为 public（默认，进入社区列表）或 unlisted（仅凭链接令牌访问，
+// 响应中的 link_token 即 GetPost 等接口的路径参数）
+func (h *DocumentHandler) PublishDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	var req models.PublishRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.Error(c, http.StatusBadRequest, "请求参数无效: "+err.Error())
+			return
+		}
+	}
+	if req.Visibility == "" {
+		req.Visibility = visibilityPublic
+	}
+	if req.Visibility != visibilityPublic && req.Visibility != visibilityUnlisted {
+		api.Error(c, http.StatusBadRequest, "visibility 只能是 public 或 unlisted")
+		return
+	}
+
+	if !h.ownsDocument(c, id, userID) || !h.setVisibility(c, id, userID, req.Visibility) {
+		return
+	}
+	resp := gin.H{"id": id, "visibility": req.Visibility}
+	if req.Visibility == visibilityUnlisted {
+		var token sql.NullString
+		if err := h.db.QueryRow("SELECT link_token FROM documents WHERE id = ?", id).Scan(&token); err != nil {
+			api.Error(c, http.StatusInternalServerError, "修改可见性失败")
+			return
+		}
+		resp["link_token"] = token.String
+	}
+	api.Success(c, resp)
+}
+
+// UnpublishDocument 取消发布：文档恢复为 private，从社区列表与贴文详情中移除，链接令牌作废
+func (h *DocumentHandler) UnpublishDocument(c *gin.Context) {
+	userID, ok := h.getUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的文档 ID")
+		return
+	}
+
+	if !h.ownsDocument(c, id, userID) || !h.setVisibility(c, id, userID, visibilityPrivate) {
+		return
+	}
+	api.Success(c, gin.H{"id": id, "visibility": visibilityPrivate})
+}
+
+// postRef 是贴文接口的路径参数 :id：public 文档用数字 ID，unlisted 文档只能用链接令牌访问
+type postRef struct {
+	ID    int64
+	Token string
+}
+
+// parsePostRef 解析路径参数 :id；无效时已写入错误响应
+func parsePostRef(c *gin.Context) (postRef, bool) {
+	raw := c.Param("id")
+	if len(raw) == linkTokenLen {
+		return postRef{Token: raw}, true
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, "无效的贴文 ID")
+		return postRef{}, false
+	}
+	return postRef{ID: id}, true
+}
+
+// where 返回匹配该贴文的条件（documents 别名为 d）：数字 ID 只匹配 public 文档，令牌只匹配 unlisted 文档
+func (r postRef) where() (string, interface{}) {
+	if r.Token != "" {
+		return "d.link_token = ? AND d.visibility = 'unlisted' AND d.deleted_at IS NULL", r.Token
+	}
+	return "d.id = ? AND d.visibility = 'public' AND d.deleted_at IS NULL", r.ID
+}
+
+// resolvePost 返回贴文对应的文档 ID；不存在或不可见时返回 sql.ErrNoRows
+func resolvePost(db *sql.DB, ref postRef) (int64, error) {
+	where, arg := ref.where()
+	var id int64
+	err := db.QueryRow("SELECT d.id FROM documents d WHERE "+where, arg).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,225 @@
+// Package imaging 用标准库处理上传的图片：解码后重新编码以去掉 EXIF（含 GPS）等元数据，
+// 按 EXIF 方向摆正照片、把过大的图片缩到 FullMaxSide，并生成缩略图等较小尺寸。
+//
+// 支持 JPEG、PNG 与 GIF（动图保留全部帧，各帧像素数之和不超过 MaxAnimationPixels）。标准库没有 WebP 编解码器：WebP 只在 RIFF 容器层面
+// 删除 EXIF / XMP 块后原样保存，不缩放，也不生成其他尺寸；其余格式的缩略图同样不输出 WebP。
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// FullMaxSide 是保存的原图长边上限，超过时等比缩小
+	FullMaxSide = 2560
+	// ThumbnailWidth 是缩略图宽度（社区列表的 media_url）
+	ThumbnailWidth = 320
+	// CardWidth 是信息流卡片宽度
+	CardWidth = 640
+	// MaxPixels 是允许解码的最大像素数，防止小文件声明超大尺寸耗尽内存
+	MaxPixels = 50_000_000
+	// MaxAnimationPixels 是动图各帧像素数之和的上限，逐帧解码前按帧头统计
+	MaxAnimationPixels = 100_000_000
+
+	jpegQuality = 85
+)
+
+// VariantWidths 是可生成的缩小尺寸（宽度，升序）；更宽的请求直接使用原图
+var VariantWidths = []int{ThumbnailWidth, CardWidth, 1280}
+
+var (
+	// ErrTooLarge 图片像素数超过 MaxPixels
+	ErrTooLarge = errors.New("图片尺寸过大")
+	// ErrUnsupported 不是可处理的图片格式
+	ErrUnsupported = errors.New("不支持的图片格式")
+)
+
+// Result 是 Process 的结果
+type Result struct {
+	Data []byte      // 去掉元数据后的文件内容
+	Ext  string      // 按实际格式确定的扩展名：.jpg / .png / .gif / .webp
+	Img  image.Image // 摆正后的静态图像（动图为第一帧），供生成缩小尺寸；WebP 为 nil
+}
+
+// Process 解码并重新编码一张上传的图片。JPEG 按 EXIF 方向摆正，JPEG 与 PNG 长边超过 FullMaxSide 时缩小；
+// GIF 逐帧重新编码（去掉注释与应用扩展），尺寸不变；WebP 删除元数据块。
+func Process(data []byte) (*Result, error) {
+	if isWebP(data) {
+		stripped, err := stripWebP(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Data: stripped, Ext: ".webp"}, nil
+	}
+
+	format, err := checkConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == "gif" {
+		if err := checkGIFFrames(data); err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, err
+		}
+		var img image.Image = image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		if len(g.Image) > 0 {
+			img = firstFrame(g.Config.Width, g.Config.Height, g.Image[0])
+		}
+		return &Result{Data: buf.Bytes(), Ext: ".gif", Img: img}, nil
+	}
+
+	img, err := decodeStatic(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if b := img.Bounds(); max(b.Dx(), b.Dy()) > FullMaxSide {
+		img = Resize(img, max(1, b.Dx()*FullMaxSide/max(b.Dx(), b.Dy())))
+	}
+	out, ext, err := Encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Data: out, Ext: ext, Img: img}, nil
+}
+
+// Decode 解码已保存的图片用于生成缩小尺寸：JPEG 按 EXIF 方向摆正，GIF 只解码第一帧。WebP 返回 ErrUnsupported
+func Decode(data []byte) (image.Image, error) {
+	if isWebP(data) {
+		return nil, ErrUnsupported
+	}
+	format, err := checkConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == "gif" {
+		cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		frame, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return firstFrame(cfg.Width, cfg.Height, frame), nil
+	}
+	return decodeStatic(data, format)
+}
+
+// Encode 把图像编码为 format（"jpeg" 为 JPEG，其余为 PNG），返回内容与扩展名
+func Encode(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+// VariantFormat 返回某扩展名的图片生成缩小尺寸时使用的格式与扩展名；不支持时 ok 为 false
+func VariantFormat(ext string) (format, variantExt string, ok bool) {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return "jpeg", ".jpg", true
+	case ".png", ".gif":
+		return "png", ".png", true
+	}
+	return "", "", false
+}
+
+// checkConfig 读取图片头，返回格式并拒绝像素数超过 MaxPixels 的图片
+func checkConfig(data []byte) (string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return "", ErrTooLarge
+	}
+	switch format {
+	case "jpeg", "png", "gif":
+		return format, nil
+	}
+	return "", ErrUnsupported
+}
+
+// decodeStatic 解码 JPEG / PNG；JPEG 按 EXIF 方向摆正
+func decodeStatic(data []byte, format string) (image.Image, error) {
+	if format == "jpeg" {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if o := jpegOrientation(data); o > 1 {
+			return orient(toRGBA(img), o), nil
+		}
+		return img, nil
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// checkGIFFrames 只读帧头统计动图各帧的像素数之和，超过 MaxAnimationPixels 时返回 ErrTooLarge。
+// 截断或格式错误的文件交给解码器报错
+func checkGIFFrames(data []byte) error {
+	if len(data) < 13 {
+		return ErrUnsupported
+	}
+	pos := 13
+	if data[10]&0x80 != 0 { // 全局颜色表
+		pos += 3 << (data[10]&7 + 1)
+	}
+	total := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展：标签后是数据子块
+			pos += 2
+		case 0x2C: // 图像描述符：左、上、宽、高各 2 字节，再接标志位
+			if pos+10 > len(data) {
+				return nil
+			}
+			total += int(binary.LittleEndian.Uint16(data[pos+5:])) * int(binary.LittleEndian.Uint16(data[pos+7:]))
+			if total > MaxAnimationPixels {
+				return ErrTooLarge
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 { // 局部颜色表
+				pos += 3 << (flags&7 + 1)
+			}
+			pos++ // LZW 最小码长
+		default: // 0x3B 结尾或无法识别
+			return nil
+		}
+		for pos < len(data) && data[pos] != 0 {
+			pos += int(data[pos]) + 1
+		}
+		pos++
+	}
+	return nil
+}
+
+// firstFrame 把动图第一帧画到 width×height 的完整画布上
+func firstFrame(width, height int, frame image.Image) image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas
+}
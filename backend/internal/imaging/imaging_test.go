@@ -0,0 +1,52 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func encodeGIF(t *testing.T, frames, width, height int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+		frame.SetColorIndex(0, 0, uint8(i%2))
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckGIFFrames(t *testing.T) {
+	if err := checkGIFFrames(encodeGIF(t, 3, 100, 100)); err != nil {
+		t.Fatalf("小动图被拒绝: %v", err)
+	}
+	// 每帧 1000×1000，101 帧超过 MaxAnimationPixels
+	if err := checkGIFFrames(encodeGIF(t, 101, 1000, 1000)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("期望 ErrTooLarge，得到 %v", err)
+	}
+	if _, err := Process(encodeGIF(t, 101, 1000, 1000)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Process 期望 ErrTooLarge，得到 %v", err)
+	}
+}
+
+func TestDecodeGIFFirstFrame(t *testing.T) {
+	img, err := Decode(encodeGIF(t, 5, 40, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Fatalf("尺寸 %v", b)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0 {
+		t.Fatalf("不是第一帧的像素: %v", img.At(0, 0))
+	}
+}
@@ -0,0 +1,117 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resize 把图像等比缩小到 width 宽，按源像素面积取平均（box 滤波），适合缩小；width 不小于原宽时原样返回
+func Resize(src image.Image, width int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if width <= 0 || width >= sw {
+		return src
+	}
+	height := max(1, (sh*width+sw/2)/sw)
+	s := toRGBA(src)
+
+	// 先横向再纵向，两遍都是一维区间平均
+	tmp := image.NewRGBA(image.Rect(0, 0, width, sh))
+	for y := 0; y < sh; y++ {
+		row := s.Pix[y*s.Stride:]
+		out := tmp.Pix[y*tmp.Stride:]
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, sw)
+			var sum [4]uint32
+			for i := x0; i < x1; i++ {
+				p := row[i*4 : i*4+4]
+				sum[0] += uint32(p[0])
+				sum[1] += uint32(p[1])
+				sum[2] += uint32(p[2])
+				sum[3] += uint32(p[3])
+			}
+			average(out[x*4:x*4+4], sum, uint32(x1-x0))
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, sh)
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var sum [4]uint32
+			for j := y0; j < y1; j++ {
+				p := tmp.Pix[j*tmp.Stride+x*4:]
+				sum[0] += uint32(p[0])
+				sum[1] += uint32(p[1])
+				sum[2] += uint32(p[2])
+				sum[3] += uint32(p[3])
+			}
+			average(out[x*4:x*4+4], sum, uint32(y1-y0))
+		}
+	}
+	return dst
+}
+
+// span 返回目标第 i 个像素（共 n 个）覆盖的源像素区间 [from, to)，源共 total 个
+func span(i, n, total int) (int, int) {
+	from := i * total / n
+	to := (i + 1) * total / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// average 把四个通道的和除以 count（四舍五入）写入 dst
+func average(dst []byte, sum [4]uint32, count uint32) {
+	for c := 0; c < 4; c++ {
+		dst[c] = uint8((sum[c] + count/2) / count)
+	}
+}
+
+// toRGBA 转为以 (0,0) 为原点的 *image.RGBA（预乘 alpha，平均时透明像素不会把颜色染黑）
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// orient 按 EXIF Orientation（2~8）翻转或旋转图像，使其按正常方向显示
+func orient(src *image.RGBA, o int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,214 @@
+// Package links 提取 Markdown 中指向其他文档的链接，并在文档改名时改写这些链接。
+//
+// 支持两种写法：
+//
+//	[[其他笔记]]、[[其他笔记#标题|显示文字]]、![[其他笔记]]（Obsidian 风格 wiki-link）
+//	[显示文字](其他笔记.md)、[显示文字](../目录/其他%20笔记.md#标题)（相对路径的 .md 链接）
+//
+// 链接目标按文件名匹配文档标题（忽略目录、.md 扩展名与大小写），代码块与行内代码中的内容不计。
+package links
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 链接类型
+const (
+	KindWiki     = "wiki"
+	KindMarkdown = "markdown"
+)
+
+// contextMaxLen 是链接所在行摘录的最大字符数
+const contextMaxLen = 200
+
+var (
+	wikiRe     = regexp.MustCompile(`(!?)\[\[([^\[\]\n]+?)\]\]`)
+	markdownRe = regexp.MustCompile(`(!?)\[([^\[\]\n]*)\]\(\s*(<[^<>\n]+>|[^()\s]+)(\s+"[^"\n]*")?\s*\)`)
+	schemeRe   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+)
+
+// attachmentExts 是 ![[...]] 嵌入中常见的附件扩展名，这类目标不是文档
+var attachmentExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true, ".bmp": true,
+	".pdf": true, ".mp3": true, ".mp4": true, ".webm": true, ".mov": true, ".wav": true, ".ogg": true,
+	".zip": true, ".csv": true, ".xlsx": true, ".docx": true, ".pptx": true,
+}
+
+// Link 是文档中的一个链接
+type Link struct {
+	Target  string // 链接中写的目标（去掉 #标题 与 |别名）
+	Key     string // 用于匹配文档的规范化名称，见 Key
+	Kind    string // wiki / markdown
+	Context string // 链接所在行（截断），用于反向链接展示
+}
+
+// Key 把文档标题或链接目标规范化为匹配用的名称：取最后一段路径、去掉 .md 扩展名、转小写
+func Key(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexAny(s, `/\`); i >= 0 {
+		s = s[i+1:]
+	}
+	if strings.HasSuffix(strings.ToLower(s), ".md") {
+		s = s[:len(s)-3]
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// splitWikiTarget 拆分 wiki-link 内部文本：目标、#标题部分（含 #）、|别名部分（含 |）
+func splitWikiTarget(inner string) (target, heading, alias string) {
+	target = inner
+	if i := strings.Index(target, "|"); i >= 0 {
+		target, alias = target[:i], target[i:]
+	}
+	if i := strings.Index(target, "#"); i >= 0 {
+		target, heading = target[:i], target[i:]
+	}
+	return target, heading, alias
+}
+
+// markdownTarget 解析 Markdown 链接地址：相对路径的 .md 链接返回解码后的路径、#片段与 true
+func markdownTarget(dest string) (p, fragment string, ok bool) {
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "/") || schemeRe.MatchString(dest) {
+		return "", "", false
+	}
+	if i := strings.IndexAny(dest, "#?"); i >= 0 {
+		dest, fragment = dest[:i], dest[i:]
+	}
+	if decoded, err := url.PathUnescape(dest); err == nil {
+		dest = decoded
+	}
+	if !strings.HasSuffix(strings.ToLower(dest), ".md") {
+		return "", "", false
+	}
+	return dest, fragment, true
+}
+
+// isAttachment 判断 wiki 目标是否为附件（图片等）而非文档
+func isAttachment(target string) bool {
+	return attachmentExts[strings.ToLower(path.Ext(strings.TrimSpace(target)))]
+}
+
+// eachProse 对内容中代码块与行内代码之外的文本片段调用 fn，并用其返回值替换该片段
+func eachProse(content string, fn func(line, segment string) string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var fence string
+	var b strings.Builder
+	b.Grow(len(content))
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(trimmed), fence) {
+				fence = ""
+			}
+			b.WriteString(line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			b.WriteString(line)
+			continue
+		}
+		// 按反引号切分：奇数段为行内代码
+		parts := strings.Split(line, "`")
+		for i, part := range parts {
+			if i > 0 {
+				b.WriteByte('`')
+			}
+			if i%2 == 1 && i < len(parts)-1 {
+				b.WriteString(part)
+				continue
+			}
+			b.WriteString(fn(line, part))
+		}
+	}
+	return b.String()
+}
+
+// excerpt 返回链接所在行的摘录
+func excerpt(line string) string {
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) > contextMaxLen {
+		line = string([]rune(line)[:contextMaxLen]) + "…"
+	}
+	return line
+}
+
+// Extract 提取内容中指向其他文档的链接（按出现顺序，不去重）
+func Extract(content string) []Link {
+	var out []Link
+	eachProse(content, func(line, segment string) string {
+		for _, m := range wikiRe.FindAllStringSubmatch(segment, -1) {
+			target, _, _ := splitWikiTarget(m[2])
+			target = strings.TrimSpace(target)
+			if target == "" || isAttachment(target) {
+				continue // [[#标题]] 是文内链接
+			}
+			out = append(out, Link{Target: target, Key: Key(target), Kind: KindWiki, Context: excerpt(line)})
+		}
+		for _, m := range markdownRe.FindAllStringSubmatch(segment, -1) {
+			if m[1] == "!" {
+				continue
+			}
+			p, _, ok := markdownTarget(m[3])
+			if !ok || Key(p) == "" {
+				continue
+			}
+			out = append(out, Link{Target: p, Key: Key(p), Kind: KindMarkdown, Context: excerpt(line)})
+		}
+		return segment
+	})
+	return out
+}
+
+// Rewrite 把内容中目标为 oldKey 的链接改为指向 newTitle：
+// wiki-link 保留 #标题 与 |别名，去掉目录前缀；Markdown 链接保留目录与 #片段，只替换文件名。
+// 返回改写后的内容与改写的链接数
+func Rewrite(content, oldKey, newTitle string) (string, int) {
+	newTitle = strings.TrimSpace(newTitle)
+	newName := newTitle
+	if !strings.HasSuffix(strings.ToLower(newName), ".md") {
+		newName += ".md"
+	}
+	wikiTitle := strings.TrimSuffix(newName, path.Ext(newName))
+	n := 0
+	out := eachProse(content, func(_, segment string) string {
+		segment = wikiRe.ReplaceAllStringFunc(segment, func(s string) string {
+			m := wikiRe.FindStringSubmatch(s)
+			target, heading, alias := splitWikiTarget(m[2])
+			if isAttachment(target) || Key(target) != oldKey {
+				return s
+			}
+			n++
+			return m[1] + "[[" + wikiTitle + heading + alias + "]]"
+		})
+		return markdownRe.ReplaceAllStringFunc(segment, func(s string) string {
+			m := markdownRe.FindStringSubmatch(s)
+			if m[1] == "!" {
+				return s
+			}
+			p, fragment, ok := markdownTarget(m[3])
+			if !ok || Key(p) != oldKey {
+				return s
+			}
+			dir := ""
+			if i := strings.LastIndex(p, "/"); i >= 0 {
+				dir = p[:i+1]
+			}
+			dest := dir + newName + fragment
+			switch {
+			case strings.ContainsAny(dest, "<>"):
+				dest = (&url.URL{Path: dir + newName}).EscapedPath() + fragment
+			case strings.ContainsAny(dest, " ()"):
+				dest = "<" + dest + ">"
+			}
+			n++
+			return "[" + m[2] + "](" + dest + m[4] + ")"
+		})
+	})
+	return out, n
+}
@@ -0,0 +1,147 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// 语法高亮只做轻量的词法着色：关键字、字符串、注释、数字，
+// 输出 <span class="tok-kw|tok-str|tok-com|tok-num">，颜色由前端样式表决定。
+
+type langSpec struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLike = langSpec{lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`"}
+	hashy = langSpec{lineComments: []string{"#"}, quotes: "\"'"}
+
+	langs = map[string]langSpec{}
+)
+
+func init() {
+	add := func(base langSpec, kw string, names ...string) {
+		base.keywords = words(kw)
+		for _, n := range names {
+			langs[n] = base
+		}
+	}
+	add(cLike, "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota", "go", "golang")
+	add(cLike, "async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof let new of return static super switch this throw try typeof var void while with yield null undefined true false interface type enum implements readonly", "js", "javascript", "ts", "typescript", "jsx", "tsx", "vue")
+	add(cLike, "abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch this throw throws try void volatile while true false", "java", "kotlin", "scala")
+	add(cLike, "auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while class namespace template typename public private protected virtual new delete nullptr true false", "c", "h", "cpp", "c++", "cc", "hpp", "cs", "csharp")
+	add(cLike, "as break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while async await dyn", "rust", "rs")
+	add(cLike, "", "json")
+	add(hashy, "and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False", "python", "py")
+	add(hashy, "if then else elif fi case esac for select while until do done in function time return export local readonly", "bash", "sh", "shell", "zsh")
+	add(hashy, "true false null yes no", "yaml", "yml", "toml")
+	add(langSpec{lineComments: []string{"--", "#"}, blockComment: [2]string{"/*", "*/"}, quotes: "'\"`"},
+		"select from where insert into values update set delete create table alter drop index primary key foreign references not null default and or in is like join left right inner outer on group by order having limit offset as distinct union all case when then else end unique engine charset",
+		"sql", "mysql")
+}
+
+// Highlight 返回代码的 HTML（已转义）；未知语言只做转义。
+func Highlight(lang, code string) string {
+	spec, ok := langs[lang]
+	if !ok {
+		return html.EscapeString(code)
+	}
+	caseless := lang == "sql" || lang == "mysql"
+
+	var out strings.Builder
+	span := func(class, text string) {
+		out.WriteString(`<span class="` + class + `">` + html.EscapeString(text) + "</span>")
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+
+		if open := spec.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			end := strings.Index(rest[len(open):], spec.blockComment[1])
+			n := len(rest)
+			if end >= 0 {
+				n = len(open) + end + len(spec.blockComment[1])
+			}
+			span("tok-com", rest[:n])
+			i += n
+			continue
+		}
+		if lineComment(spec, rest) {
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 {
+				n = len(rest)
+			}
+			span("tok-com", rest[:n])
+			i += n
+			continue
+		}
+
+		c := code[i]
+		switch {
+		case strings.IndexByte(spec.quotes, c) >= 0:
+			n := 1
+			for n < len(rest) && rest[n] != c && (c == '`' || rest[n] != '\n') {
+				if rest[n] == '\\' {
+					n++
+				}
+				n++
+			}
+			n = min(n+1, len(rest))
+			span("tok-str", rest[:n])
+			i += n
+
+		case c >= '0' && c <= '9':
+			n := 1
+			for n < len(rest) && (isWordByte(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			span("tok-num", rest[:n])
+			i += n
+
+		case isWordByte(c) && c < 0x80:
+			n := 1
+			for n < len(rest) && isWordByte(rest[n]) && rest[n] < 0x80 {
+				n++
+			}
+			word := rest[:n]
+			if caseless {
+				word = strings.ToLower(word)
+			}
+			if spec.keywords[word] {
+				span("tok-kw", rest[:n])
+			} else {
+				out.WriteString(html.EscapeString(rest[:n]))
+			}
+			i += n
+
+		default:
+			out.WriteString(html.EscapeString(rest[:1]))
+			i++
+		}
+	}
+	return out.String()
+}
+
+func lineComment(spec langSpec, s string) bool {
+	for _, p := range spec.lineComments {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,111 @@
+package markdown
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	// maxNesting 列表与引用的最大嵌套层数，更深的内容按段落文本处理
+	maxNesting = 32
+	// maxInlineMisses 单个块内链接、行内代码解析失败的次数上限。
+	// 每次失败都要向后扫描到块尾，不设上限时 "[a](" 或 "`a" 重复数万次会退化为平方复杂度
+	maxInlineMisses = 64
+	// maxTableCells 表格单元格（列数 × 行数）上限；GFM 会把短行补齐到表头列数，超出时整段按文本输出
+	maxTableCells = 20000
+)
+
+// nestingLimited 在容器块（列表、引用）超过 maxNesting 层时不再打开新的容器
+type nestingLimited struct {
+	parser.BlockParser
+}
+
+func (p nestingLimited) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	depth := 0
+	for n := parent; n != nil; n = n.Parent() {
+		if n.Kind() == ast.KindList || n.Kind() == ast.KindBlockquote {
+			depth++
+		}
+	}
+	if depth >= maxNesting {
+		return nil, parser.NoChildren
+	}
+	return p.BlockParser.Open(parent, reader, pc)
+}
+
+// budgetedInline 统计单个块内解析失败的次数，达到 maxInlineMisses 后该块内不再尝试，触发字符按文本输出
+type budgetedInline struct {
+	parser.InlineParser
+	key parser.ContextKey
+}
+
+func (p *budgetedInline) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	misses, _ := pc.Get(p.key).(int)
+	if misses >= maxInlineMisses {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if len(line) == 0 {
+		return nil
+	}
+	trigger := line[0]
+	n := p.InlineParser.Parse(parent, block, pc)
+	// "]" 与 "`" 是需要向后扫描的位置：没有得到链接 / 行内代码即记一次失败
+	switch trigger {
+	case ']':
+		if n == nil {
+			pc.Set(p.key, misses+1)
+		}
+	case '`':
+		if _, ok := n.(*ast.CodeSpan); !ok {
+			pc.Set(p.key, misses+1)
+		}
+	}
+	return n
+}
+
+func (p *budgetedInline) CloseBlock(parent ast.Node, block text.Reader, pc parser.Context) {
+	pc.Set(p.key, nil)
+	if cb, ok := p.InlineParser.(parser.CloseBlocker); ok {
+		cb.CloseBlock(parent, block, pc)
+	}
+}
+
+// tableLimit 在表格扩展之前检查段落：若像表格且单元格数超过 maxTableCells，整段替换为纯文本块
+type tableLimit struct{}
+
+func (tableLimit) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	lines := node.Lines()
+	if lines.Len() < 2 {
+		return
+	}
+	second := lines.At(1)
+	delim := bytes.TrimSpace(second.Value(reader.Source()))
+	// 分隔行只能由 | - : 与空白组成
+	if !bytes.Contains(delim, []byte("-")) || len(bytes.Trim(delim, "|-: \t")) > 0 {
+		return
+	}
+	cols := bytes.Count(delim, []byte("|")) + 1
+	if cols*lines.Len() <= maxTableCells {
+		return
+	}
+	tb := &textBlock{}
+	tb.SetLines(lines)
+	node.Parent().ReplaceChild(node.Parent(), node, tb)
+}
+
+var kindTextBlock = ast.NewNodeKind("TextBlock")
+
+// textBlock 是按原文转义输出的段落，不再做行内解析
+type textBlock struct {
+	ast.BaseBlock
+}
+
+func (n *textBlock) Kind() ast.NodeKind { return kindTextBlock }
+
+func (n *textBlock) IsRaw() bool { return true }
+
+func (n *textBlock) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
@@ -0,0 +1,50 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading 是文档中的一个标题
+type Heading struct {
+	Level  int    `json:"level"`  // 1-6
+	Text   string `json:"text"`   // 去掉行内标记后的纯文本
+	Slug   string `json:"slug"`   // 锚点，与 Render 输出的 id 一致
+	Offset int    `json:"offset"` // 标题所在块在原文中的字节偏移；引用、列表内的标题取外层块的偏移
+}
+
+// Node 是大纲树的节点
+type Node struct {
+	Heading
+	Children []*Node `json:"children"`
+}
+
+// Headings 按出现顺序返回文档中的全部标题。
+// 识别规则与 Render 相同（代码块中的 # 不算标题），锚点与渲染结果一一对应。
+func Headings(src string) []Heading {
+	pc := parser.NewContext()
+	md.Parser().Parse(text.NewReader([]byte(src)), parser.WithContext(pc))
+	headings, _ := pc.Get(headingsKey).([]Heading)
+	return headings
+}
+
+// Outline 把标题列表组织为树：每个标题挂在它之前最近的更高级标题下。
+// 跳级的标题（如 h1 后直接 h3）直接作为子节点，不补空节点。
+func Outline(headings []Heading) []*Node {
+	roots := []*Node{}
+	var stack []*Node
+	for _, h := range headings {
+		n := &Node{Heading: h, Children: []*Node{}}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, n)
+		}
+		stack = append(stack, n)
+	}
+	return roots
+}
@@ -0,0 +1,245 @@
+// Package markdown 在服务端把 Markdown（CommonMark + GFM：表格、删除线、任务列表、自动链接）
+// 渲染为 HTML，并用白名单清洗输出。解析基于 goldmark；标题带锚点 id，代码块按语言做轻量高亮。
+// 原始 HTML 一律按文本转义输出，不做透传。Headings / Outline 按同样的规则提取标题大纲。
+//
+// 匿名访客也能触发渲染（社区贴文、分享链接），因此对容器嵌套层数、单个块内的链接与行内代码解析次数
+// 以及表格单元格数设有上限（见 limits.go），超出部分按普通文本处理，保证耗时与输入长度成线性关系。
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var md = goldmark.New(
+	goldmark.WithParser(newParser()),
+	goldmark.WithExtensions(
+		extension.Strikethrough,
+		extension.NewLinkify(extension.WithLinkifyEmailRegexp(emailRe)),
+		extension.TaskList,
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&htmlRenderer{}, 100)),
+	),
+)
+
+// emailRe 识别裸邮箱地址。锚定行首并限制本地部分长度：goldmark 默认的扫描会沿整行查找 "@"，
+// 在没有空白的长行上每个触发位置都要扫到行尾
+var emailRe = regexp.MustCompile(`^[A-Za-z0-9.!#$%&'*+/=?^_{|}~-]{1,64}@[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?)+`)
+
+// newParser 创建带嵌套与解析次数上限的 CommonMark 解析器
+func newParser() parser.Parser {
+	blocks := parser.DefaultBlockParsers()
+	for i, v := range blocks {
+		if v.Value == parser.NewListParser() || v.Value == parser.NewBlockquoteParser() {
+			blocks[i].Value = nestingLimited{v.Value.(parser.BlockParser)}
+		}
+	}
+	inlines := parser.DefaultInlineParsers()
+	for i, v := range inlines {
+		if v.Value == parser.NewLinkParser() || v.Value == parser.NewCodeSpanParser() {
+			inlines[i].Value = &budgetedInline{InlineParser: v.Value.(parser.InlineParser), key: parser.NewContextKey()}
+		}
+	}
+	return parser.NewParser(
+		parser.WithBlockParsers(blocks...),
+		parser.WithInlineParsers(inlines...),
+		parser.WithParagraphTransformers(append(parser.DefaultParagraphTransformers(),
+			util.Prioritized(tableLimit{}, 100))...),
+		parser.WithASTTransformers(util.Prioritized(&documentTransformer{}, 100)),
+	)
+}
+
+// Render 渲染 Markdown 并经 Sanitize 清洗，返回可直接嵌入页面的 HTML。
+func Render(src string) string {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return ""
+	}
+	return Sanitize(buf.String())
+}
+
+// headingsKey 在解析上下文中保存 documentTransformer 收集到的标题
+var headingsKey = parser.NewContextKey()
+
+// documentTransformer 在行内解析完成后补充渲染所需的属性：
+// 标题的锚点 id 与 <a class="anchor">、任务列表的 class、图片的 loading="lazy"
+type documentTransformer struct{}
+
+func (documentTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	slugs := NewSlugger()
+	var headings []Heading
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			plain := plainText(n, source)
+			slug := slugs.Slug(plain)
+			n.SetAttributeString("id", []byte(slug))
+			anchor := ast.NewLink()
+			anchor.Destination = []byte("#" + slug)
+			anchor.SetAttributeString("class", []byte("anchor"))
+			anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+			if n.FirstChild() != nil {
+				n.InsertBefore(n, n.FirstChild(), anchor)
+			} else {
+				n.AppendChild(n, anchor)
+			}
+			headings = append(headings, Heading{
+				Level:  n.Level,
+				Text:   strings.Join(strings.Fields(plain), " "),
+				Slug:   slug,
+				Offset: blockOffset(n, source),
+			})
+			return ast.WalkSkipChildren, nil
+		case *extast.TaskCheckBox:
+			if item := n.Parent().Parent(); item != nil && item.Kind() == ast.KindListItem {
+				item.SetAttributeString("class", []byte("task-list-item"))
+				if list := item.Parent(); list != nil {
+					list.SetAttributeString("class", []byte("contains-task-list"))
+				}
+			}
+		case *ast.Image:
+			n.SetAttributeString("loading", []byte("lazy"))
+		}
+		return ast.WalkContinue, nil
+	})
+	pc.Set(headingsKey, headings)
+}
+
+// plainText 返回节点的纯文本（去掉行内标记与链接地址），用于生成锚点
+func plainText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.AutoLink:
+			b.Write(c.Label(source))
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// blockOffset 返回节点所在顶层块第一行在原文中的字节偏移
+func blockOffset(n ast.Node, source []byte) int {
+	top := n
+	for top.Parent() != nil && top.Parent().Kind() != ast.KindDocument {
+		top = top.Parent()
+	}
+	pos := -1
+	_ = ast.Walk(top, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && c.Type() == ast.TypeBlock && c.Lines().Len() > 0 {
+			pos = c.Lines().At(0).Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if pos < 0 {
+		// 空标题等没有内容行的块无法定位
+		return 0
+	}
+	return bytes.LastIndexByte(source[:pos], '\n') + 1
+}
+
+// htmlRenderer 覆盖默认的代码块与原始 HTML 渲染
+type htmlRenderer struct{}
+
+func (r *htmlRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeBlock, r.renderCode)
+	reg.Register(ast.KindFencedCodeBlock, r.renderCode)
+	reg.Register(ast.KindHTMLBlock, r.renderHTMLBlock)
+	reg.Register(ast.KindRawHTML, r.renderRawHTML)
+	reg.Register(kindTextBlock, r.renderTextBlock)
+}
+
+// renderCode 输出 <pre><code class="language-xx">，内容经 Highlight 着色
+func (r *htmlRenderer) renderCode(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	lang := ""
+	if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+		lang = strings.ToLower(string(fenced.Language(source)))
+	}
+	_, _ = w.WriteString("<pre><code")
+	if lang != "" {
+		_, _ = w.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	_, _ = w.WriteString(">")
+	_, _ = w.WriteString(Highlight(lang, strings.TrimSuffix(linesText(n, source), "\n")))
+	_, _ = w.WriteString("</code></pre>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// renderHTMLBlock 把 HTML 块按文本转义输出为段落
+func (r *htmlRenderer) renderHTMLBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	content := linesText(n, source)
+	if block := n.(*ast.HTMLBlock); block.HasClosure() {
+		content += string(block.ClosureLine.Value(source))
+	}
+	_, _ = w.WriteString("<p>" + html.EscapeString(strings.TrimRight(content, "\n")) + "</p>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// renderRawHTML 把行内 HTML 按文本转义输出
+func (r *htmlRenderer) renderRawHTML(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	segs := n.(*ast.RawHTML).Segments
+	for i := 0; i < segs.Len(); i++ {
+		seg := segs.At(i)
+		_, _ = w.WriteString(html.EscapeString(string(seg.Value(source))))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// renderTextBlock 把超出解析上限的段落按纯文本输出
+func (r *htmlRenderer) renderTextBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<p>" + html.EscapeString(strings.TrimRight(linesText(n, source), "\n")) + "</p>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// linesText 拼接块的原文各行
+func linesText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.Write(seg.Value(source))
+	}
+	return b.String()
+}
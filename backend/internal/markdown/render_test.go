@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name, src string
+		want      []string
+	}{
+		{"嵌套强调", "*a **b** c*", []string{"<em>a <strong>b</strong> c</em>"}},
+		{"删除线", "~~x~~", []string{"<del>x</del>"}},
+		{"无语言代码块", "```\n<b>x</b>\n```", []string{"<pre><code>&lt;b&gt;x&lt;/b&gt;</code></pre>"}},
+		{"带语言代码块", "```Go\nx := 1\n```", []string{`<code class="language-go">`}},
+		{"标题锚点", "# Hello World", []string{`<h1 id="hello-world"><a href="#hello-world" class="anchor" rel="nofollow">#</a>Hello World</h1>`}},
+		{"任务列表", "- [x] done\n- [ ] todo", []string{`<ul class="contains-task-list">`, `<li class="task-list-item"><input checked="" disabled="" type="checkbox"`}},
+		{"表格对齐", "| a | b |\n|:-|-:|\n| 1 | 2 |", []string{`<th align="left">a</th>`, `<td align="right">2</td>`}},
+		{"图片懒加载", "![alt](/u/a.png)", []string{`<img src="/u/a.png" alt="alt" loading="lazy"`}},
+		{"自动链接", "见 https://example.com 或 a@b.co", []string{`<a href="https://example.com" rel="nofollow">https://example.com</a>`, `<a href="mailto:a@b.co" rel="nofollow">a@b.co</a>`}},
+	}
+	for _, c := range cases {
+		got := Render(c.src)
+		for _, w := range c.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: %q 中缺少 %q", c.name, got, w)
+			}
+		}
+	}
+}
+
+func TestRenderSanitize(t *testing.T) {
+	cases := []struct {
+		src    string
+		banned []string
+	}{
+		{"<script>alert(1)</script>", []string{"<script"}},
+		{"a <img src=x onerror=alert(1)> b", []string{"<img"}},
+		{"[x](javascript:alert(1))", []string{"javascript:"}},
+		{"[x](JaVaScRiPt:alert(1))", []string{"JaVaScRiPt:"}},
+		{"![x](data:text/html;base64,PHNjcmlwdD4=)", []string{"data:"}},
+		{"<a href=\"https://x\" style=\"color:red\">x</a>", []string{"<a href"}},
+	}
+	for _, c := range cases {
+		got := Render(c.src)
+		for _, b := range c.banned {
+			if strings.Contains(got, b) {
+				t.Errorf("Render(%q) = %q，不应包含 %q", c.src, got, b)
+			}
+		}
+	}
+	if got := Render("<b>x</b>"); !strings.Contains(got, "&lt;b&gt;x&lt;/b&gt;") {
+		t.Errorf("原始 HTML 应按文本输出，得到 %q", got)
+	}
+
+	got := Sanitize(`<p class="evil" onclick="x()">a<iframe src="https://x"></iframe><span class="tok-kw">b</span></p>`)
+	if got != `<p>a<span class="tok-kw">b</span></p>` {
+		t.Errorf("Sanitize 得到 %q", got)
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	src := "# A\r\n\r\n```\n# 不是标题\n```\n\n> ## B *x*\n\nC\n---\n\n# A\n"
+	got := Headings(src)
+	want := []Heading{
+		{Level: 1, Text: "A", Slug: "a", Offset: 0},
+		{Level: 2, Text: "B x", Slug: "b-x", Offset: strings.Index(src, "> ##")},
+		{Level: 2, Text: "C", Slug: "c", Offset: strings.Index(src, "C\n")},
+		{Level: 1, Text: "A", Slug: "a-1", Offset: strings.LastIndex(src, "# A")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("得到 %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 个标题 %+v，期望 %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// 病态输入：耗时应与长度成线性关系
+func TestRenderPathological(t *testing.T) {
+	var table strings.Builder
+	table.WriteString(strings.Repeat("|a", 20000) + "\n" + strings.Repeat("|-", 20000) + "\n")
+	for i := 0; i < 2000; i++ {
+		table.WriteString("b\n")
+	}
+	cases := map[string]string{
+		"深层列表":  strings.Repeat("- ", 40000),
+		"深层引用":  strings.Repeat(">", 40000),
+		"引用套列表": strings.Repeat("> - ", 20000),
+		"有序列表":  strings.Repeat("1. ", 40000),
+		"未闭合链接": strings.Repeat("[a](", 80000),
+		"未闭合图片": strings.Repeat("![a](<", 80000),
+		"未闭合代码": strings.Repeat("``a`", 80000),
+		"长邮箱前缀": strings.Repeat("`a", 80000),
+		"下划线":   strings.Repeat("_a", 80000),
+		"网址括号":  strings.Repeat("http://a(", 40000),
+		"宽表格":   table.String(),
+	}
+	for name, src := range cases {
+		start := time.Now()
+		out := Render(src)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: 耗时 %v", name, d)
+		}
+		if len(out) > 20*len(src) {
+			t.Errorf("%s: 输出 %d 字节，输入 %d 字节", name, len(out), len(src))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package markdown
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+var (
+	classRe = regexp.MustCompile(`^(?:anchor|contains-task-list|task-list-item|language-[a-z0-9+#_-]+|tok-(?:kw|str|com|num))$`)
+	idRe    = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+	alignRe = regexp.MustCompile(`^(?:left|right|center)$`)
+	startRe = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// policy 是渲染结果的白名单：不在表中的标签去掉（保留其文本），script / style 等连同内容删除，
+// 不在表中或取值不合规的属性直接丢弃；链接与图片只允许 http / https / mailto 与相对地址。
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowElements("p", "br", "hr", "blockquote", "pre", "em", "strong", "del",
+		"table", "thead", "tbody", "tr", "ul", "ol", "li", "code", "span")
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^lazy$`)).OnElements("img")
+	p.AllowAttrs("class").Matching(classRe).OnElements("a", "ul", "ol", "li", "code", "span")
+	p.AllowAttrs("id").Matching(idRe).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("start").Matching(startRe).OnElements("ol")
+	p.AllowAttrs("align").Matching(alignRe).OnElements("th", "td")
+	p.AllowElements("th", "td")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Sanitize 按白名单清洗 HTML，输出保证标签闭合与转义正确。
+func Sanitize(src string) string {
+	return policy.Sanitize(src)
+}
@@ -0,0 +1,52 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Slugify 生成标题锚点：转小写，字母（含中文）、数字、连字符与下划线保留，空白变为连字符，其余标点去掉。
+// 规则与 GitHub 的标题锚点一致，便于前端沿用同样的链接。
+func Slugify(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// Slugger 为同一篇文档生成不重复的锚点：重复的 slug 依次追加 -1、-2……
+type Slugger struct {
+	next map[string]int  // base slug → 下一个尝试的序号
+	used map[string]bool // 已分配的 slug
+}
+
+// NewSlugger 创建 Slugger。
+func NewSlugger() *Slugger {
+	return &Slugger{next: make(map[string]int), used: make(map[string]bool)}
+}
+
+// Slug 返回 text 在当前文档内唯一的锚点。
+func (s *Slugger) Slug(text string) string {
+	base := Slugify(text)
+	if base == "" {
+		base = "section"
+	}
+	for n := s.next[base]; ; n++ {
+		slug := base
+		if n > 0 {
+			slug = base + "-" + strconv.Itoa(n)
+		}
+		if !s.used[slug] {
+			s.used[slug] = true
+			s.next[base] = n + 1
+			return slug
+		}
+	}
+}
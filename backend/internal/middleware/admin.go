@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"markdown-editor-backend/pkg/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin 只放行 userIDs（逗号分隔的用户 ID）中的用户，须挂在 JWTAuth 之后；未配置管理员时一律拒绝。
+// 按令牌中的用户 ID 判断而不是用户名，改名或注册同名账号都不会获得管理员权限
+func RequireAdmin(userIDs string) gin.HandlerFunc {
+	admins := make(map[int64]bool)
+	for _, raw := range strings.Split(userIDs, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			log.Printf("忽略无效的管理员用户 ID %q", raw)
+			continue
+		}
+		admins[id] = true
+	}
+	return func(c *gin.Context) {
+		if !admins[c.GetInt64("userID")] {
+			api.Error(c, http.StatusForbidden, "需要管理员权限")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
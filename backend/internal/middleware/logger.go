@@ -24,8 +24,8 @@ func Logger() gin.HandlerFunc {
 		// 请求方式
 		reqMethod := c.Request.Method
 
-		// 请求路由
-		reqUri := c.Request.RequestURI
+		// 请求路由（隐去查询串中的令牌）
+		reqUri := RedactURI(c.Request.RequestURI)
 
 		// 状态码
 		statusCode := c.Writer.Status()
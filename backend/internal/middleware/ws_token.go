@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sensitiveQueryParams 是访问日志中需要隐去取值的查询参数
+var sensitiveQueryParams = []string{"token"}
+
+// TokenFromQuery 供 WebSocket 路由使用：浏览器无法为 WebSocket 握手设置 Authorization 头，
+// 因此允许把 access token 放在查询参数中，由本中间件转成 Bearer 头后交给 JWTAuth 校验。
+// 请求已带 Authorization 头时不做改动。访问日志经 RedactURI 隐去该参数。
+func TokenFromQuery(param string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") == "" {
+			if token := ctx.Query(param); token != "" {
+				ctx.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// RedactURI 隐去 uri 查询串中的令牌等敏感参数，供访问日志使用
+func RedactURI(uri string) string {
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return path + "?[已隐去]"
+	}
+	changed := false
+	for _, name := range sensitiveQueryParams {
+		if _, found := query[name]; found {
+			query.Set(name, "***")
+			changed = true
+		}
+	}
+	if !changed {
+		return uri
+	}
+	return path + "?" + query.Encode()
+}
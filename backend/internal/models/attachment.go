@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Attachment 用户上传的附件（图片、PDF、压缩包、音频等），属于上传者，可关联到多篇文档
+type Attachment struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Filename    string    `json:"filename"` // 上传时的原始文件名
+	Kind        string    `json:"kind"`     // image / pdf / document / archive / audio / video
+	MimeType    string    `json:"mime_type"`
+	Size        int64     `json:"size"`
+	URL         string    `json:"url"`
+	Markdown    string    `json:"markdown"`               // 插入文档用的 Markdown：图片为 ![](url)，其余为链接
+	DocumentIDs []int64   `json:"document_ids,omitempty"` // 关联的文档，仅详情返回
+	CreatedAt   time.Time `json:"created_at"`
+	StoragePath string    `json:"-"` // 存储中的对象键，即相对 /uploads 的路径
+}
+
+// AttachmentLinkRequest 把附件关联到文档
+type AttachmentLinkRequest struct {
+	DocumentID int64 `json:"document_id" binding:"required"`
+}
+
+// UploadGCReport 一次孤儿上传文件清理的结果；路径均为对象键（相对 /uploads）
+type UploadGCReport struct {
+	DryRun          bool            `json:"dry_run"` // 只检查，未移动或删除任何文件
+	Scanned         int             `json:"scanned"` // 存储中的文件数，不含缩小尺寸与隔离区
+	Referenced      int             `json:"referenced"`
+	Quarantined     []string        `json:"quarantined"`      // 本次移入隔离区
+	Restored        []string        `json:"restored"`         // 隔离期内重新被引用，已移回原处
+	Deleted         []string        `json:"deleted"`          // 隔离期满，已永久删除
+	VariantsDeleted int             `json:"variants_deleted"` // 原图已不在而删除的缩小尺寸
+	Missing         []MissingUpload `json:"missing"`          // 文档仍在引用但已不存在的文件
+	StartedAt       time.Time       `json:"started_at"`
+	FinishedAt      time.Time       `json:"finished_at"`
+}
+
+// MissingUpload 是文档引用但存储中不存在的文件
+type MissingUpload struct {
+	Path        string  `json:"path"`
+	DocumentIDs []int64 `json:"document_ids"` // 引用它的未删除文档
+}
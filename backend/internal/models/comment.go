@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DocumentComment 文档评论；作者、commenter 与 editor 可发表，能访问文档的用户都可查看
+type DocumentComment struct {
+	ID         int64     `json:"id"`
+	DocumentID int64     `json:"document_id"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateCommentRequest 发表评论
+type CreateCommentRequest struct {
+	Content string `json:"content" binding:"required"`
+}
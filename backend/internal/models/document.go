@@ -5,22 +5,102 @@ import (
 )
 
 type Document struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Title     string    `json:"title"`
-	Filename  string    `json:"filename"`
-	Content   string    `json:"content"`
-	FileSize  int64     `json:"file_size"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64           `json:"id"`
+	UserID     int64           `json:"user_id"`
+	FolderID   *int64          `json:"folder_id"` // nil 表示位于根目录
+	Title      string          `json:"title"`
+	Filename   string          `json:"filename"`
+	Content    string          `json:"content"`
+	FileSize   int64           `json:"file_size"`
+	Version    int             `json:"version"`              // 每次保存 +1，用作 ETag
+	Visibility string          `json:"visibility,omitempty"` // private / unlisted / public
+	LinkToken  string          `json:"link_token,omitempty"` // unlisted 文档的链接令牌，仅作者调用 GetDocument 时返回
+	IsTemplate bool            `json:"is_template"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	DeletedAt  *time.Time      `json:"deleted_at,omitempty"`  // 仅回收站列表返回
+	Role       string          `json:"role,omitempty"`        // 当前用户对文档的角色，仅 GetDocument 返回
+	ForkedFrom *DocumentOrigin `json:"forked_from,omitempty"` // 复刻自社区贴文时的来源，仅 GetDocument 返回
+}
+
+// DocumentOrigin 复刻文档的来源与原作者署名；Title 为复刻时的标题快照
+type DocumentOrigin struct {
+	DocumentID int64  `json:"document_id"`
+	Title      string `json:"title"`
+	AuthorID   int64  `json:"author_id"`
+	AuthorName string `json:"author_name"`
+}
+
+// CopyDocumentRequest 复制文档或复刻贴文；title 省略时按来源标题生成，
+// folder_id 为 0 表示根目录，省略时复制自己的文档放在原文件夹，其余放在根目录
+type CopyDocumentRequest struct {
+	Title    string `json:"title"`
+	FolderID *int64 `json:"folder_id"`
+}
+
+// SearchResult 全文搜索结果；Snippet / TitleHighlight 已做 HTML 转义，命中词以 <mark> 包裹
+type SearchResult struct {
+	Document
+	Score          float64 `json:"score"`
+	Snippet        string  `json:"snippet"`
+	TitleHighlight string  `json:"title_highlight"`
 }
 
 type UploadDocumentRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content"`
+	Title    string `json:"title" binding:"required"`
+	Content  string `json:"content"`
+	FolderID *int64 `json:"folder_id"` // 可选，省略时放在根目录
+}
+
+// PublishRequest 发布文档；Visibility 省略时为 public
+type PublishRequest struct {
+	Visibility string `json:"visibility"`
+}
+
+// TemplateFlagRequest 标记或取消标记文档为模板
+type TemplateFlagRequest struct {
+	IsTemplate *bool `json:"is_template" binding:"required"`
+}
+
+// FromTemplateRequest 从模板新建文档；Title 省略时使用替换占位符后的模板标题，
+// Variables 为模板中自定义占位符的取值
+type FromTemplateRequest struct {
+	Title     string            `json:"title"`
+	FolderID  *int64            `json:"folder_id"`
+	Variables map[string]string `json:"variables"`
 }
 
 type UpdateDocumentRequest struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title        string `json:"title"`
+	Content      string `json:"content"`
+	RewriteLinks bool   `json:"rewrite_links"` // 标题变化时改写其他文档中指向旧标题的链接（仅作者）
+}
+
+// DocumentLock 文档编辑锁（租约）：持有期间其他用户不能保存文档，过期后自动释放
+type DocumentLock struct {
+	DocumentID int64     `json:"document_id"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// LockRequest 获取或续期编辑锁；ttl_seconds 省略时使用默认有效期
+type LockRequest struct {
+	TTLSeconds int `json:"ttl_seconds" binding:"omitempty,min=15,max=3600"`
+}
+
+// TextEdit 是增量保存中的一处替换：把基础版本内容中 [start, end) 的字符替换为 text。
+// 偏移按 UTF-16 码元计，即浏览器中 JavaScript 字符串的下标（emoji 等补充平面字符占 2）
+type TextEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// PatchDocumentRequest 增量保存：edits 均以 base_version 的内容为准，互不重叠，顺序不限
+type PatchDocumentRequest struct {
+	BaseVersion int        `json:"base_version" binding:"required,min=1"`
+	Edits       []TextEdit `json:"edits" binding:"max=1000"`
+	Title       *string    `json:"title"`        // 可选，同时修改标题
+	ContentHash string     `json:"content_hash"` // 可选，应用后内容的 sha256 十六进制串，用于校验
 }
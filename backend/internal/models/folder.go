@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Folder 用户的文件夹，ParentID 为 nil 表示位于根目录
+type Folder struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	ParentID      *int64    `json:"parent_id"`
+	Name          string    `json:"name"`
+	DocumentCount int       `json:"document_count"` // 直接位于该文件夹下的文档数
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type RenameFolderRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MoveRequest 移动文件夹或文档；FolderID 为 nil 表示移到根目录
+type MoveRequest struct {
+	FolderID *int64 `json:"folder_id"`
+}
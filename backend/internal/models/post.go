@@ -9,7 +9,8 @@ type Post struct {
 	ID            int64     `json:"id"`
 	UserID        int64     `json:"user_id"`
 	Title         string    `json:"title"`
-	Content       string    `json:"content"` // Markdown 原文
+	Content       string    `json:"content"`                 // Markdown 原文
+	RenderedHTML  string    `json:"rendered_html,omitempty"` // 服务端渲染并清洗后的 HTML（rendered_html=1 时返回）
 	MediaType     *string   `json:"media_type,omitempty"`
 	MediaURL      *string   `json:"media_url,omitempty"`
 	LikesCount    int       `json:"likes_count"`
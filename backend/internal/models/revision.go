@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentRevision 文档的一次保存快照；列表接口不返回 Content。
+type DocumentRevision struct {
+	ID         int64     `json:"id"`
+	DocumentID int64     `json:"document_id"`
+	UserID     int64     `json:"user_id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content,omitempty"`
+	FileSize   int64     `json:"file_size"`
+	Source     string    `json:"source"`  // create | update | restore | collab
+	Version    int       `json:"version"` // 该次保存后的文档版本号
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// DocumentShare 文档对某个用户的授权
+type DocumentShare struct {
+	ID         int64     `json:"id"`
+	DocumentID int64     `json:"document_id"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"` // viewer / commenter / editor
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ShareLink 文档分享链接；Token 由服务端签名生成，凭其可匿名只读访问
+type ShareLink struct {
+	ID          int64      `json:"id"`
+	DocumentID  int64      `json:"document_id"`
+	Token       string     `json:"token"`
+	HasPassword bool       `json:"has_password"`
+	ExpiresAt   *time.Time `json:"expires_at"` // nil 表示永不过期
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SharedDocument 他人共享给我的文档（不含内容）
+type SharedDocument struct {
+	Document
+	Owner string `json:"owner"`
+	Role  string `json:"role"`
+}
+
+// ShareRequest 授权用户访问文档；已授权时更新角色
+type ShareRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// CreateShareLinkRequest 创建分享链接；ExpiresInHours 为 0 表示永不过期，Password 为空表示无需密码
+type CreateShareLinkRequest struct {
+	ExpiresInHours int    `json:"expires_in_hours"`
+	Password       string `json:"password"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SyncChange 是变更流中的一条记录；Data 为实体的当前状态（document / tag / task），删除或 document_tag 时为空
+type SyncChange struct {
+	Seq       int64       `json:"seq"`
+	Entity    string      `json:"entity"` // document / tag / document_tag / task
+	Op        string      `json:"op"`     // upsert / delete
+	ID        int64       `json:"id"`     // document_tag 为文档 ID
+	TagID     int64       `json:"tag_id,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// SyncTask 是同步接口返回的任务，附带标签 ID
+type SyncTask struct {
+	Task
+	TagIDs []int64 `json:"tag_ids"`
+}
+
+// SyncPushRequest 批量推送离线变更，服务端按顺序逐条应用
+type SyncPushRequest struct {
+	Changes []SyncPushChange `json:"changes" binding:"required,min=1,max=100,dive"`
+}
+
+// SyncPushChange 是一条离线变更。id 为 0 的 upsert 表示新建，需带 client_id（客户端为该记录生成的唯一标识，
+// 重复推送同一 client_id 不会重复新建）；base_version 是客户端修改所基于的文档、标签或任务版本，用于冲突检测
+type SyncPushChange struct {
+	Ref         string          `json:"ref"` // 客户端引用，结果中原样返回；新建的文档、标签可被后续 document_tag 以 *_ref 引用
+	Entity      string          `json:"entity" binding:"required,oneof=document tag document_tag task"`
+	Op          string          `json:"op" binding:"required,oneof=upsert delete"`
+	ID          int64           `json:"id"`
+	ClientID    string          `json:"client_id"`
+	BaseVersion int             `json:"base_version"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// SyncDocumentData 文档变更内容；未传的字段保持不变，folder_id 为 0 表示移到根目录
+type SyncDocumentData struct {
+	Title    *string `json:"title"`
+	Content  *string `json:"content"`
+	FolderID *int64  `json:"folder_id"`
+}
+
+// SyncTagData 标签变更内容
+type SyncTagData struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// SyncTaskData 任务变更内容，为任务的完整状态；tag_ids 为 null 时不修改标签
+type SyncTaskData struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Priority    string     `json:"priority"`
+	DueDate     *time.Time `json:"due_date"`
+	TagIDs      []int64    `json:"tag_ids"`
+}
+
+// SyncDocumentTagData 文档-标签关联；document_ref / tag_ref 引用同一批次中先前新建的文档、标签
+type SyncDocumentTagData struct {
+	DocumentID  int64  `json:"document_id"`
+	TagID       int64  `json:"tag_id"`
+	DocumentRef string `json:"document_ref"`
+	TagRef      string `json:"tag_ref"`
+}
+
+// SyncResult 是一条推送变更的处理结果。
+// status：applied 已应用 / conflict 基于的状态已过期（data 为服务器当前记录）/
+// not_found 记录不存在 / rejected 请求无效 / locked 文档被他人加了编辑锁（data 为锁）/ error 服务器错误
+type SyncResult struct {
+	Ref    string      `json:"ref,omitempty"`
+	Entity string      `json:"entity"`
+	Op     string      `json:"op"`
+	ID     int64       `json:"id,omitempty"`
+	Status string      `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
@@ -7,6 +7,7 @@ type Tag struct {
 	UserID    int       `json:"user_id" db:"user_id"`
 	Name      string    `json:"name" db:"name"`
 	Color     string    `json:"color" db:"color"`
+	Version   int       `json:"version" db:"version"` // 每次修改 +1，同步推送以此检测冲突
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -27,6 +28,7 @@ type Task struct {
 	Priority    string    `json:"priority" db:"priority"`
 	DueDate     *time.Time `json:"due_date" db:"due_date"`
 	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	Version     int       `json:"version" db:"version"` // 每次修改 +1，同步推送以此检测冲突
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
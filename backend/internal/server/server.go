@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -11,23 +12,29 @@ import (
 	"markdown-editor-backend/internal/config"
 	"markdown-editor-backend/internal/handlers"
 	"markdown-editor-backend/internal/middleware"
+	"markdown-editor-backend/internal/storage"
 	"markdown-editor-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// trashPurgeInterval 是回收站过期文档的清理周期
+const trashPurgeInterval = time.Hour
+
 type Server struct {
 	cfg    *config.Config
 	db     *sql.DB
 	cache  *cache.Cache
+	store  storage.Storage
 	router *gin.Engine
 }
 
-func NewServer(cfg *config.Config, db *sql.DB, c *cache.Cache) *Server {
+func NewServer(cfg *config.Config, db *sql.DB, c *cache.Cache, store storage.Storage) *Server {
 	server := &Server{
 		cfg:   cfg,
 		db:    db,
 		cache: c,
+		store: store,
 	}
 	server.setupRouter()
 	return server
@@ -46,7 +53,7 @@ func (s *Server) setupRouter() {
 			param.TimeStamp.Format(time.RFC1123),
 			param.ClientIP,
 			param.Method,
-			param.Path,
+			middleware.RedactURI(param.Path),
 			param.Request.Proto,
 			param.StatusCode,
 			param.Latency,
@@ -90,9 +97,12 @@ func (s *Server) setupRouter() {
 	// 处理器
 	authHandler := handlers.NewAuthHandler(s.db, jwt, s.cache)
 	postHandler := handlers.NewPostHandler(s.db, s.cache)
-	documentHandler := handlers.NewDocumentHandler(s.db, s.cache)
-	tagHandler := handlers.NewTagHandler(s.db)
+	documentHandler := handlers.NewDocumentHandler(s.db, s.cache, s.cfg.Revision, s.cfg.Trash, s.cfg.Share.Secret, s.store)
+	tagHandler := handlers.NewTagHandler(s.db, documentHandler)
+	folderHandler := handlers.NewFolderHandler(s.db, s.cache, documentHandler)
 	taskHandler := handlers.NewTaskHandler(s.db)
+	syncHandler := handlers.NewSyncHandler(s.db, documentHandler)
+	adminHandler := handlers.NewAdminHandler(s.db, s.store, s.cfg.UploadGC)
 
 	// jwtAuth 中间件（带 Redis 双重校验）
 	jwtAuth := middleware.JWTAuth(jwt, s.cache)
@@ -123,11 +133,21 @@ func (s *Server) setupRouter() {
 			posts.GET("/:id", postHandler.GetPost)
 			posts.POST("/:id/like", jwtAuth, postHandler.LikePost)
 			posts.DELETE("/:id/like", jwtAuth, postHandler.UnlikePost) // 取消点赞
+			posts.POST("/:id/fork", jwtAuth, documentHandler.ForkPost) // 复刻到自己的文档
 		}
 	}
 
-	// 上传图片静态目录（供图片链接访问）
-	router.Static("/uploads", "./uploads")
+	// 上传的图片（?w= 取缩小尺寸）与其他附件
+	router.GET("/uploads/images/:name", documentHandler.ServeImage)
+	router.HEAD("/uploads/images/:name", documentHandler.ServeImage)
+	router.GET("/uploads/files/:name", documentHandler.ServeFile)
+	router.HEAD("/uploads/files/:name", documentHandler.ServeFile)
+
+	// 分享链接：匿名只读访问，无需登录
+	api.GET("/share/:token", documentHandler.ViewShareLink)
+
+	// 协同编辑 WebSocket：浏览器无法设置握手头，token 走查询参数
+	api.GET("/documents/:id/collab", middleware.TokenFromQuery("token"), jwtAuth, documentHandler.CollabSocket)
 
 	// 文档相关路由（带路径的路由放在 /:id 之前）
 	documents := api.Group("/documents")
@@ -138,13 +158,61 @@ func (s *Server) setupRouter() {
 		documents.GET("/list", documentHandler.GetDocuments)
 		documents.GET("/stats", documentHandler.GetDocumentStats)
 		documents.GET("/search", documentHandler.SearchDocuments)
+		documents.GET("/export.zip", documentHandler.ExportDocuments)
+		documents.POST("/import", documentHandler.ImportDocuments)
+		documents.GET("/shared", documentHandler.ListSharedDocuments)
+		documents.GET("/templates", documentHandler.ListTemplates)
+		documents.GET("/meta/keys", documentHandler.ListMetaKeys)
+		documents.GET("/links/unresolved", documentHandler.GetUnresolvedLinks)
+		documents.GET("/graph", documentHandler.GetLinkGraph)
+		documents.POST("/from-template/:id", documentHandler.CreateFromTemplate)
 		documents.GET("/:id", documentHandler.GetDocument)
 		documents.PUT("/:id", documentHandler.UpdateDocument)
+		documents.PATCH("/:id", documentHandler.PatchDocument)
 		documents.DELETE("/:id", documentHandler.DeleteDocument)
+		documents.POST("/:id/duplicate", documentHandler.DuplicateDocument)
+		documents.GET("/:id/attachments", documentHandler.ListDocumentAttachments)
 		documents.GET("/:id/tags", tagHandler.GetDocumentTags)
 		documents.POST("/:id/tags", tagHandler.AddDocumentTag)
 		documents.DELETE("/:id/tags/:tagId", tagHandler.RemoveDocumentTag)
 		documents.PUT("/:id/tags", tagHandler.UpdateDocumentTags)
+		documents.PUT("/:id/folder", documentHandler.MoveDocument)
+		documents.PUT("/:id/template", documentHandler.SetTemplate)
+		documents.GET("/:id/lock", documentHandler.GetLock)
+		documents.POST("/:id/lock", documentHandler.AcquireLock)
+		documents.PUT("/:id/lock", documentHandler.RenewLock)
+		documents.DELETE("/:id/lock", documentHandler.ReleaseLock)
+		documents.GET("/:id/meta", documentHandler.GetDocumentMeta)
+		documents.GET("/:id/backlinks", documentHandler.GetBacklinks)
+		documents.GET("/:id/outline", documentHandler.GetOutline)
+		documents.GET("/:id/outline.opml", documentHandler.ExportOutlineOPML)
+		documents.POST("/:id/publish", documentHandler.PublishDocument)
+		documents.POST("/:id/unpublish", documentHandler.UnpublishDocument)
+		documents.GET("/:id/render", documentHandler.RenderDocument)
+		documents.GET("/:id/shares", documentHandler.ListShares)
+		documents.POST("/:id/shares", documentHandler.ShareDocument)
+		documents.DELETE("/:id/shares/:userId", documentHandler.RevokeShare)
+		documents.POST("/:id/share-links", documentHandler.CreateShareLink)
+		documents.DELETE("/:id/share-links/:linkId", documentHandler.RevokeShareLink)
+		documents.GET("/:id/comments", documentHandler.ListComments)
+		documents.POST("/:id/comments", documentHandler.CreateComment)
+		documents.DELETE("/:id/comments/:commentId", documentHandler.DeleteComment)
+		documents.GET("/:id/revisions", documentHandler.ListRevisions)
+		documents.GET("/:id/revisions/diff", documentHandler.DiffRevisions)
+		documents.GET("/:id/revisions/:revId", documentHandler.GetRevision)
+		documents.POST("/:id/revisions/:revId/restore", documentHandler.RestoreRevision)
+	}
+
+	// 附件相关路由
+	attachments := api.Group("/attachments")
+	attachments.Use(jwtAuth)
+	{
+		attachments.GET("", documentHandler.ListAttachments)
+		attachments.POST("", documentHandler.UploadAttachment)
+		attachments.GET("/:id", documentHandler.GetAttachment)
+		attachments.DELETE("/:id", documentHandler.DeleteAttachment)
+		attachments.POST("/:id/documents", documentHandler.LinkAttachment)
+		attachments.DELETE("/:id/documents/:docId", documentHandler.UnlinkAttachment)
 	}
 
 	// 标签相关路由
@@ -157,6 +225,27 @@ func (s *Server) setupRouter() {
 		tags.DELETE("/:id", tagHandler.DeleteTag)
 	}
 
+	// 文件夹相关路由
+	folders := api.Group("/folders")
+	folders.Use(jwtAuth)
+	{
+		folders.GET("", folderHandler.GetFolders)
+		folders.POST("", folderHandler.CreateFolder)
+		folders.PUT("/:id", folderHandler.RenameFolder)
+		folders.PUT("/:id/move", folderHandler.MoveFolder)
+		folders.DELETE("/:id", folderHandler.DeleteFolder)
+	}
+
+	// 回收站相关路由
+	trash := api.Group("/trash")
+	trash.Use(jwtAuth)
+	{
+		trash.GET("", documentHandler.ListTrash)
+		trash.DELETE("", documentHandler.EmptyTrash)
+		trash.POST("/:id/restore", documentHandler.RestoreTrash)
+		trash.DELETE("/:id", documentHandler.DeleteTrash)
+	}
+
 	// 任务相关路由
 	tasks := api.Group("/tasks")
 	tasks.Use(jwtAuth)
@@ -167,6 +256,21 @@ func (s *Server) setupRouter() {
 		tasks.DELETE("/:id", taskHandler.DeleteTask)
 	}
 
+	// 离线同步：拉取变更流与批量推送
+	sync := api.Group("/sync")
+	sync.Use(jwtAuth)
+	{
+		sync.GET("", syncHandler.Pull)
+		sync.POST("", syncHandler.Push)
+	}
+
+	// 管理接口：仅 ADMIN_USER_IDS 中的用户
+	admin := api.Group("/admin")
+	admin.Use(jwtAuth, middleware.RequireAdmin(s.cfg.Admin.UserIDs))
+	{
+		admin.POST("/uploads/gc", adminHandler.CollectUploads)
+	}
+
 	// 404 处理（放在静态和 API 之后）
 	router.NoRoute(func(c *gin.Context) {
 		c.JSON(404, gin.H{
@@ -193,7 +297,13 @@ func (s *Server) Run() error {
 		s.cfg.Database.Host,
 		s.cfg.Database.Port,
 		s.cfg.Database.DBName)
+	log.Printf("Storage:  %s", s.cfg.Storage.Driver)
 	log.Println("========================================")
 
+	// 后台定时永久清除过期的回收站文档
+	go handlers.RunTrashPurge(context.Background(), s.db, s.cfg.Trash.RetentionDays, trashPurgeInterval)
+	// 后台定时清理孤儿上传文件
+	go handlers.RunUploadGC(context.Background(), s.db, s.store, s.cfg.UploadGC)
+
 	return s.router.Run(":" + port)
 }
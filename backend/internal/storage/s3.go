@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"markdown-editor-backend/internal/config"
+)
+
+// s3UnsignedPayload 表示请求体不参与签名，上传时不必为计算哈希先把整个文件读进内存
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 把对象存入 S3 兼容的对象存储（AWS S3、MinIO 等），请求使用 AWS Signature Version 4 签名
+type S3 struct {
+	cfg      config.S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 校验配置并创建 S3 存储
+func NewS3(cfg config.S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 存储需要配置 S3_ENDPOINT 与 S3_BUCKET")
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("无效的 S3_ENDPOINT %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	if cfg.Prefix != "" {
+		cfg.Prefix += "/"
+	}
+	// 不设整体超时：大文件会边下载边转发给浏览器
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Minute
+	return &S3{cfg: cfg, endpoint: u, client: &http.Client{Transport: transport}}, nil
+}
+
+// s3Error 是 S3 返回的错误响应
+type s3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 请求失败：HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("S3 请求失败：HTTP %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// objectURL 返回对象（key 为空时为 bucket）的请求地址
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		p += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	p += "/" + key
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	u.RawQuery = s3Query(query)
+	return &u
+}
+
+// do 签名并发送请求，返回 2xx 响应；其他状态码转为 *s3Error（404 为 ErrNotExist）
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, ErrNotExist
+	}
+	e := &s3Error{Status: resp.StatusCode}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 4096)); err == nil {
+		_ = xml.Unmarshal(data, e)
+	}
+	return nil, e
+}
+
+// Put 单次 PUT 上传（S3 单个 PUT 上限 5GB，远大于附件上限）；长度未知时先读入内存
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	if size < 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	header := http.Header{}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		header.Set("Content-Type", ct)
+	}
+	if size == 0 {
+		r = http.NoBody
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.cfg.Prefix+key, nil, r, size, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get 读取整个对象；返回的 ReadCloser 实现 io.ReadSeeker（见 s3Reader），可用于 http.ServeContent 处理 Range 请求
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.cfg.Prefix+key, nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := s3Info(key, resp)
+	r := &s3Reader{ctx: ctx, s: s, key: s.cfg.Prefix + key, etag: resp.Header.Get("ETag"), size: info.Size, body: resp.Body}
+	return &Object{ReadCloser: r, Info: info}, nil
+}
+
+// s3Reader 是可定位的对象内容。先读 Get 返回的整个响应体；Seek 到别处后下次 Read 用带 Range 的 GET 从新位置读起，
+// 并用 If-Match 确保读到的仍是同一版本（对象被覆盖时返回 412 错误）
+type s3Reader struct {
+	ctx     context.Context
+	s       *S3
+	key     string // 含前缀的完整键
+	etag    string
+	size    int64
+	off     int64         // 当前读取位置
+	body    io.ReadCloser // 正在读的响应体，读到 bodyOff
+	bodyOff int64
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil || r.bodyOff != r.off {
+		if r.body != nil {
+			r.body.Close()
+			r.body = nil
+		}
+		header := http.Header{"Range": {"bytes=" + strconv.FormatInt(r.off, 10) + "-"}}
+		if r.etag != "" {
+			header.Set("If-Match", r.etag)
+		}
+		resp, err := r.s.do(r.ctx, http.MethodGet, r.key, nil, nil, 0, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return 0, fmt.Errorf("S3 未按 Range 返回：HTTP %d", resp.StatusCode)
+		}
+		r.body, r.bodyOff = resp.Body, r.off
+	}
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	r.bodyOff += int64(n)
+	if err == io.EOF && r.off < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek 只记录位置，不发请求；http.ServeContent 取长度时 Seek 到末尾也无需访问存储
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("无效的 whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("定位到负数位置")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if !ValidKey(key) {
+		return Info{}, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.cfg.Prefix+key, nil, nil, 0, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+	return s3Info(key, resp), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.cfg.Prefix+key, nil, nil, 0, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ListResult 是 ListObjectsV2 的响应
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List 用 ListObjectsV2 分页遍历，每页最多 1000 个
+func (s *S3) List(ctx context.Context, prefix string, fn func(Info) error) error {
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix + prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		var res s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("解析 S3 列表响应失败: %w", err)
+		}
+		for _, c := range res.Contents {
+			key := strings.TrimPrefix(c.Key, s.cfg.Prefix)
+			if !ValidKey(key) { // 目录占位对象（以 / 结尾）等
+				continue
+			}
+			if err := fn(Info{Key: key, Size: c.Size, ModTime: c.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// s3Info 从响应头读取对象元信息
+func s3Info(key string, resp *http.Response) Info {
+	info := Info{Key: key, Size: resp.ContentLength}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+// sign 按 AWS Signature Version 4 为请求加上 Authorization 头，签名 host、x-amz-content-sha256、x-amz-date 及已有的 Range 等头
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-type" || lk == "content-md5" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		s3Query(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3Query 按 SigV4 规范编码查询参数：键排序，键和值都按 s3Escape 编码
+func s3Query(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape 按 SigV4 的 URI 编码规则编码：只保留 A-Z a-z 0-9 - _ . ~，encodeSlash 为 false 时保留 /
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+var _ Storage = (*S3)(nil)
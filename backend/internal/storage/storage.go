@@ -0,0 +1,99 @@
+// Package storage 是上传文件的存储后端：本机目录（local）或 S3 兼容的对象存储（s3）。
+// 对象以键寻址，键为斜杠分隔的相对路径，如 images/3e3b200b0faecc57.png，与访问 URL /uploads/<键> 一一对应
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"markdown-editor-backend/internal/config"
+)
+
+var (
+	// ErrNotExist 对象不存在
+	ErrNotExist = errors.New("对象不存在")
+	// ErrInvalidKey 键为空、以 / 开头或包含 .、.. 等路径段
+	ErrInvalidKey = errors.New("无效的对象键")
+)
+
+// Info 是对象的元信息
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object 是读取中的对象，用完须 Close。本机存储与 S3 的 ReadCloser 都同时实现 io.ReadSeeker，可直接用于 http.ServeContent
+type Object struct {
+	io.ReadCloser
+	Info
+}
+
+// Storage 上传文件的存储后端
+type Storage interface {
+	// Put 写入对象，已存在时覆盖；size 为 r 的长度，未知时传 -1。写入是原子的，读者不会看到半个对象
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get 读取对象，不存在时返回 ErrNotExist
+	Get(ctx context.Context, key string) (*Object, error)
+	// Stat 返回对象元信息，不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete 删除对象，不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// List 按键的字典序遍历以 prefix 开头的对象，fn 返回错误时停止并返回该错误
+	List(ctx context.Context, prefix string, fn func(Info) error) error
+}
+
+// New 按配置创建存储后端
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.LocalDir), nil
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("未知的存储驱动 %q（可选 local、s3）", cfg.Driver)
+	}
+}
+
+// ValidKey 判断 key 是否为合法的对象键
+func ValidKey(key string) bool {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKeyRe 匹配 HashKey 生成的键的最后一段
+var hashKeyRe = regexp.MustCompile(`(?:^|/)[0-9a-f]{64}(?:\.[A-Za-z0-9]+)?$`)
+
+// HashKey 返回 dir 下按内容 SHA-256 命名的对象键（内容寻址），如 images/<64 位 hex>.png：相同内容得到相同的键，
+// 对象一经写入内容不再变化
+func HashKey(dir string, sum []byte, ext string) string {
+	return dir + "/" + hex.EncodeToString(sum) + ext
+}
+
+// IsHashKey 判断 key 是否为 HashKey 生成的键
+func IsHashKey(key string) bool {
+	return hashKeyRe.MatchString(key)
+}
+
+// Copy 把 src 中的对象 key 复制到 dst
+func Copy(ctx context.Context, dst, src Storage, key string) error {
+	obj, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	return dst.Put(ctx, key, obj, obj.Size)
+}
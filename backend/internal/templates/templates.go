@@ -0,0 +1,222 @@
+// Package templates 实现文档模板的占位符替换与内置系统模板。
+//
+// 模板标题与正文中的 {{name}} 会在创建文档时被替换：内置变量见 Builtins，
+// 其余名称为自定义变量，由用户在创建时填写。未提供值的占位符保持原样。
+package templates
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholderRe 匹配 {{ name }}，名称两侧空白忽略，名称内不含花括号与换行
+var placeholderRe = regexp.MustCompile(`\{\{\s*([^{}\s][^{}\n]*?)\s*\}\}`)
+
+// 内置变量名
+const (
+	VarDate     = "date"     // 2006-01-02
+	VarTime     = "time"     // 15:04
+	VarDatetime = "datetime" // 2006-01-02 15:04
+	VarYear     = "year"
+	VarMonth    = "month"
+	VarDay      = "day"
+	VarWeekday  = "weekday" // 星期一……星期日
+	VarWeek     = "week"    // ISO 周数
+	VarUsername = "username"
+	VarTitle    = "title" // 新文档标题
+)
+
+var weekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// IsBuiltin 判断是否为内置变量
+func IsBuiltin(name string) bool {
+	switch name {
+	case VarDate, VarTime, VarDatetime, VarYear, VarMonth, VarDay, VarWeekday, VarWeek, VarUsername, VarTitle:
+		return true
+	}
+	return false
+}
+
+// Builtins 返回 now 时刻与 username 对应的内置变量（不含 title，由调用方在确定标题后补上）
+func Builtins(now time.Time, username string) map[string]string {
+	_, week := now.ISOWeek()
+	return map[string]string{
+		VarDate:     now.Format("2006-01-02"),
+		VarTime:     now.Format("15:04"),
+		VarDatetime: now.Format("2006-01-02 15:04"),
+		VarYear:     strconv.Itoa(now.Year()),
+		VarMonth:    now.Format("01"),
+		VarDay:      now.Format("02"),
+		VarWeekday:  weekdays[now.Weekday()],
+		VarWeek:     strconv.Itoa(week),
+		VarUsername: username,
+	}
+}
+
+// Expand 用 vars 替换文本中的占位符；vars 中没有的占位符保持原样
+func Expand(text string, vars map[string]string) string {
+	return placeholderRe.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// Variables 按首次出现顺序返回各文本中的自定义变量名（去重，不含内置变量）
+func Variables(texts ...string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, m := range placeholderRe.FindAllStringSubmatch(text, -1) {
+			name := m[1]
+			if IsBuiltin(name) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasVariable 判断文本中是否含有名为 name 的占位符
+func HasVariable(text, name string) bool {
+	for _, m := range placeholderRe.FindAllStringSubmatch(text, -1) {
+		if m[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Template 内置系统模板
+type Template struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Content     string   `json:"-"`
+}
+
+// System 是随服务端发布的系统模板，对所有用户可用
+var System = []Template{
+	{
+		ID:          "meeting-notes",
+		Title:       "会议纪要 {{date}}",
+		Description: "会议时间、参会人、议题、结论与待办",
+		Tags:        []string{"会议"},
+		Content: `# {{title}}
+
+- **时间**：{{datetime}}
+- **记录人**：{{username}}
+- **参会人**：
+- **议题**：{{topic}}
+
+## 讨论内容
+
+1.
+
+## 结论
+
+-
+
+## 待办事项
+
+- [ ] 事项 —— 负责人，截止日期
+`,
+	},
+	{
+		ID:          "weekly-report",
+		Title:       "周报 {{date}}（第 {{week}} 周）",
+		Description: "本周进展、问题与下周计划",
+		Tags:        []string{"周报"},
+		Content: `# {{title}}
+
+> {{username}} · {{date}}
+
+## 本周完成
+
+-
+
+## 进行中
+
+-
+
+## 问题与风险
+
+-
+
+## 下周计划
+
+- [ ]
+`,
+	},
+	{
+		ID:          "daily-journal",
+		Title:       "{{date}} {{weekday}}",
+		Description: "每日记录：今日要事、笔记与复盘",
+		Tags:        []string{"日记"},
+		Content: `# {{title}}
+
+## 今日要事
+
+- [ ]
+
+## 笔记
+
+## 复盘
+`,
+	},
+	{
+		ID:          "project-plan",
+		Title:       "{{project}} 项目计划",
+		Description: "项目背景、目标、里程碑与分工",
+		Tags:        []string{"项目"},
+		Content: `# {{title}}
+
+- **负责人**：{{username}}
+- **创建日期**：{{date}}
+
+## 背景
+
+## 目标
+
+## 里程碑
+
+| 阶段 | 内容 | 截止日期 |
+| --- | --- | --- |
+|  |  |  |
+
+## 分工
+
+## 风险
+`,
+	},
+}
+
+// Lookup 按 ID 查找系统模板
+func Lookup(id string) (Template, bool) {
+	for _, t := range System {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// Normalize 去掉自定义变量值两侧空白，并丢弃名称为空或与内置变量同名的项（内置变量不可覆盖）
+func Normalize(vars map[string]string) map[string]string {
+	out := make(map[string]string, len(vars))
+	for k, v := range vars {
+		k = strings.TrimSpace(k)
+		if k == "" || IsBuiltin(k) {
+			continue
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out
+}
@@ -24,3 +24,12 @@ func Error(c *gin.Context, statusCode int, message string) {
 		Error:   message,
 	})
 }
+
+// ErrorWithData 返回错误并附带数据，如 409 冲突时附带服务器当前版本
+func ErrorWithData(c *gin.Context, statusCode int, message string, data interface{}) {
+	c.JSON(statusCode, Response{
+		Success: false,
+		Error:   message,
+		Data:    data,
+	})
+}
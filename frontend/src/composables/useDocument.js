@@ -45,8 +45,8 @@ export function useDocument() {
     loading.value = true
     try {
       const res = await documentAPI.list()
-      if (res && res.success !== false && Array.isArray(res.data)) {
-        documents.value = res.data
+      if (res && res.success !== false && Array.isArray(res.data?.list)) {
+        documents.value = res.data.list
       } else {
         documents.value = []
       }
@@ -161,6 +161,19 @@ export const authAPI = {
 
 export const healthAPI = { check: () => api.get('/health') }
 
+/** 按 next_cursor 翻完游标分页列表的全部页，返回与单页相同结构的 { success, data: { list } } */
+const listAll = async (url, params = {}) => {
+  const list = []
+  let cursor
+  do {
+    const res = await api.get(url, { params: { ...params, limit: 200, cursor } })
+    if (!res || res.success === false) return res
+    list.push(...(res.data?.list || []))
+    cursor = res.data?.next_cursor
+  } while (cursor)
+  return { success: true, data: { list } }
+}
+
 export const documentAPI = {
   upload: (data) => api.post('/api/documents/upload', data),
   uploadImage: (formData) => {
@@ -174,22 +187,44 @@ export const documentAPI = {
       }]
     })
   },
-  list: () => api.get('/api/documents/list'),
+  list: () => listAll('/api/documents/list'),
   get: (id) => api.get(`/api/documents/${id}`),
   update: (id, data) => api.put(`/api/documents/${id}`, data),
+  patch: (id, data) => api.patch(`/api/documents/${id}`, data),
+  getLock: (id) => api.get(`/api/documents/${id}/lock`),
+  acquireLock: (id, ttlSeconds) => api.post(`/api/documents/${id}/lock`, { ttl_seconds: ttlSeconds }),
+  renewLock: (id, ttlSeconds) => api.put(`/api/documents/${id}/lock`, { ttl_seconds: ttlSeconds }),
+  releaseLock: (id, force = false) => api.delete(`/api/documents/${id}/lock`, { params: force ? { force: 1 } : {} }),
   delete: (id) => api.delete(`/api/documents/${id}`),
+  duplicate: (id, data = {}) => api.post(`/api/documents/${id}/duplicate`, data),
   search: (q) => api.get('/api/documents/search', { params: { q } }),
   stats: () => api.get('/api/documents/stats')
 }
 
+export const attachmentAPI = {
+  upload: (formData) => api.post('/api/attachments', formData, {
+    transformRequest: [(data, headers) => {
+      if (data instanceof FormData) delete headers['Content-Type']
+      return data
+    }]
+  }),
+  list: (params = {}) => listAll('/api/attachments', params),
+  get: (id) => api.get(`/api/attachments/${id}`),
+  delete: (id) => api.delete(`/api/attachments/${id}`),
+  link: (id, documentId) => api.post(`/api/attachments/${id}/documents`, { document_id: documentId }),
+  unlink: (id, documentId) => api.delete(`/api/attachments/${id}/documents/${documentId}`),
+  listForDocument: (documentId) => api.get(`/api/documents/${documentId}/attachments`)
+}
+
 export const postAPI = {
   list: (params = {}) => api.get('/api/posts', { params: { page: params.page || 1, limit: params.limit || 20 } }),
   get: (id) => api.get(`/api/posts/${id}`),
-  like: (id) => api.post(`/api/posts/${id}/like`)
+  like: (id) => api.post(`/api/posts/${id}/like`),
+  fork: (id, data = {}) => api.post(`/api/posts/${id}/fork`, data)
 }
 
 export const tagAPI = {
-  list: () => api.get('/api/tags'),
+  list: () => listAll('/api/tags'),
   create: (data) => api.post('/api/tags', data),
   update: (id, data) => api.put(`/api/tags/${id}`, data),
   delete: (id) => api.delete(`/api/tags/${id}`),
@@ -199,11 +234,16 @@ export const tagAPI = {
 }
 
 export const taskAPI = {
-  list: (params = {}) => api.get('/api/tasks', { params }),
+  list: (params = {}) => listAll('/api/tasks', params),
   create: (data) => api.post('/api/tasks', data),
   update: (id, data) => api.put(`/api/tasks/${id}`, data),
   delete: (id) => api.delete(`/api/tasks/${id}`),
   updateStatus: (id, status) => api.put(`/api/tasks/${id}`, { status })
 }
 
+export const syncAPI = {
+  pull: (since = 0, limit) => api.get('/api/sync', { params: { since, limit } }),
+  push: (changes) => api.post('/api/sync', { changes })
+}
+
 export default api